@@ -9,11 +9,16 @@ require (
 	github.com/Azure/go-autorest/autorest/azure/auth v0.3.0
 	github.com/Azure/go-autorest/autorest/to v0.3.0
 	github.com/Azure/go-autorest/autorest/validation v0.2.0 // indirect
+	github.com/gorilla/mux v1.7.3
 	github.com/labbsr0x/bindman-dns-webhook v1.0.2
+	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/peterbourgon/diskv v2.0.1+incompatible
+	github.com/prometheus/client_golang v1.1.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.3.0
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20190418165655-df01cb2cc480
 )
@@ -0,0 +1,433 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/version"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+type Builder struct {
+	// Address is the TCP address the administration API listens on; the API is disabled when empty
+	Address string
+	// Token is the bearer token the calls must present in their Authorization header; required unless Address is a loopback one
+	Token string
+}
+
+// ZoneStatusReporter is implemented by the DNSUpdaters telling the status of the zones they manage
+type ZoneStatusReporter interface {
+	ZoneStatuses() []azure.ZoneStatus
+}
+
+// Server serves the administration API of Bindman, which the webhook API leaves out
+type Server struct {
+	*Builder
+	Manager *manager.Manager
+	Zones   ZoneStatusReporter
+
+	router *mux.Router
+	server *http.Server
+}
+
+// Status is the payload of the status endpoint
+type Status struct {
+	Version string `json:"version"`
+	// Healthy tells if no managed zone failed its check
+	Healthy bool               `json:"healthy"`
+	Zones   []azure.ZoneStatus `json:"zones"`
+}
+
+// OperationRequest is the payload of the submission of an asynchronous write
+type OperationRequest struct {
+	// Action is add to add the value of the record to its record set, or update to replace all its values
+	Action string              `json:"action"`
+	Record hookTypes.DNSRecord `json:"record"`
+}
+
+// New creates a new Server instance
+func (b *Builder) New(m *manager.Manager, zones ZoneStatusReporter) (*Server, error) {
+	if m == nil {
+		return nil, errors.New("not possible to start the administration API; it expects a valid non-nil Manager")
+	}
+	if zones == nil {
+		return nil, errors.New("not possible to start the administration API; it expects a valid non-nil ZoneStatusReporter")
+	}
+	if b.Address != "" && b.Token == "" && !loopback(b.Address) {
+		return nil, fmt.Errorf("not possible to start the administration API; a token is required to listen on the address '%s', reachable from other hosts", b.Address)
+	}
+	result := &Server{Builder: b, Manager: m, Zones: zones, router: mux.NewRouter()}
+	if b.Token != "" {
+		result.router.Use(result.authenticate)
+	}
+	result.router.HandleFunc("/status", result.GetStatus).Methods(http.MethodGet)
+	result.router.HandleFunc("/reconcile", result.GetReconcileReport).Methods(http.MethodGet)
+	result.router.HandleFunc("/reconcile", result.Reconcile).Methods(http.MethodPost)
+	result.router.HandleFunc("/gc", result.GetGCReport).Methods(http.MethodGet)
+	result.router.HandleFunc("/gc", result.CollectGarbage).Methods(http.MethodPost)
+	result.router.HandleFunc("/records", result.GetRecords).Methods(http.MethodGet)
+	result.router.HandleFunc("/removals", result.GetRemovals).Methods(http.MethodGet)
+	result.router.HandleFunc("/removals/{name}/{type}", result.CancelRemoval).Methods(http.MethodDelete)
+	result.router.HandleFunc("/removals/{name}/{type}/force", result.ForceRemoval).Methods(http.MethodPost)
+	result.router.HandleFunc("/audit", result.GetAudit).Methods(http.MethodGet)
+	result.router.HandleFunc("/history/{name}/{type}", result.GetHistory).Methods(http.MethodGet)
+	result.router.HandleFunc("/history/{name}/{type}/rollback", result.RollbackRecord).Methods(http.MethodPost)
+	result.router.HandleFunc("/rollback", result.RollbackZone).Methods(http.MethodPost)
+	result.router.HandleFunc("/operations", result.GetOperations).Methods(http.MethodGet)
+	result.router.HandleFunc("/operations", result.SubmitOperation).Methods(http.MethodPost)
+	result.router.HandleFunc("/operations/{id}", result.GetOperation).Methods(http.MethodGet)
+	result.server = &http.Server{Addr: b.Address, Handler: result.router}
+	return result, nil
+}
+
+// Handler returns the handler of the administration API
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// ListenAndServe serves the administration API until Shutdown is called
+func (s *Server) ListenAndServe() error {
+	logrus.Infof("Initialized the administration API on %s", s.Address)
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the administration API, waiting for the requests in progress until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// authenticate answers 401 Unauthorized to the requests not bearing the Token in their Authorization header
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONResponse(&hookTypes.Error{Message: "a valid token is required to call the administration API", Code: http.StatusUnauthorized},
+				http.StatusUnauthorized, w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopback tells if the TCP address only listens on the loopback interface
+func loopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// GetStatus tells the version of Bindman and the status of the managed zones.
+// Answers 503 Service Unavailable when a zone failed its check
+func (s *Server) GetStatus(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	status := Status{Version: version.Version, Healthy: true, Zones: s.Zones.ZoneStatuses()}
+	for _, zone := range status.Zones {
+		if zone.Failed() {
+			status.Healthy = false
+		}
+	}
+	code := http.StatusOK
+	if !status.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSONResponse(status, code, w)
+}
+
+// GetReconcileReport returns the report of the last reconciliation of the stored records with the DNS server
+func (s *Server) GetReconcileReport(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	report := s.Manager.LastReconcileReport()
+	if report == nil {
+		hookTypes.PanicIfError(hookTypes.NotFoundError("No reconciliation has run yet", nil))
+	}
+	writeJSONResponse(report, http.StatusOK, w)
+}
+
+// Reconcile reconciles the stored records with the DNS server right away, returning the report.
+// The differences are only reported when the dryRun query parameter is true
+func (s *Server) Reconcile(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	report, err := s.Manager.Reconcile(r.Context(), dryRun(r))
+	if err != nil {
+		hookTypes.PanicIfError(hookTypes.InternalServerError("Not possible to reconcile the records with the DNS server", err, err.Error()))
+	}
+	writeJSONResponse(report, http.StatusOK, w)
+}
+
+// GetGCReport returns the report of the last garbage collection of the orphaned records
+func (s *Server) GetGCReport(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	report := s.Manager.LastGCReport()
+	if report == nil {
+		hookTypes.PanicIfError(hookTypes.NotFoundError("No garbage collection has run yet", nil))
+	}
+	writeJSONResponse(report, http.StatusOK, w)
+}
+
+// CollectGarbage removes the orphaned records from the DNS server right away, returning the report.
+// The orphaned records are only reported when the dryRun query parameter is true
+func (s *Server) CollectGarbage(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	report, err := s.Manager.CollectGarbage(r.Context(), dryRun(r))
+	if err != nil {
+		hookTypes.PanicIfError(hookTypes.InternalServerError("Not possible to collect the orphaned records", err, err.Error()))
+	}
+	writeJSONResponse(report, http.StatusOK, w)
+}
+
+// GetRecords lists the stored records matched by the type, prefix and zone query parameters, along with the times they were
+// written. The olderThan and newerThan query parameters match the records by the time elapsed since their last write
+func (s *Server) GetRecords(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	params := r.URL.Query()
+	query := manager.RecordQuery{Type: params.Get("type"), Prefix: params.Get("prefix"), Zone: params.Get("zone"), Owner: params.Get("owner"),
+		CreatedBefore: timestamp(r, "createdBefore"), CreatedAfter: timestamp(r, "createdAfter")}
+	now := time.Now()
+	if olderThan := duration(r, "olderThan"); olderThan > 0 {
+		query.UpdatedBefore = now.Add(-olderThan)
+	}
+	if newerThan := duration(r, "newerThan"); newerThan > 0 {
+		query.UpdatedAfter = now.Add(-newerThan)
+	}
+	records, err := s.Manager.QueryRecords(query)
+	panicIfError("Not possible to query the stored records", err)
+	writeJSONResponse(records, http.StatusOK, w)
+}
+
+// GetRemovals lists the delayed removals in progress, the soonest due first
+func (s *Server) GetRemovals(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	removals, err := s.Manager.PendingRemovals()
+	if err != nil {
+		hookTypes.PanicIfError(hookTypes.InternalServerError("Not possible to list the pending removals", err, err.Error()))
+	}
+	if removals == nil {
+		removals = []manager.Removal{}
+	}
+	writeJSONResponse(removals, http.StatusOK, w)
+}
+
+// CancelRemoval cancels the delayed removal in progress of the record set, returning it
+func (s *Server) CancelRemoval(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	vars := mux.Vars(r)
+	removal, err := s.Manager.CancelRemoval(vars["name"], vars["type"])
+	panicIfError("Not possible to cancel the removal", err)
+	writeJSONResponse(removal, http.StatusOK, w)
+}
+
+// ForceRemoval removes the record set from the DNS server right away, whether its delayed removal is in progress
+// or it is still stored, returning the removal applied
+func (s *Server) ForceRemoval(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	vars := mux.Vars(r)
+	removal, err := s.Manager.ForceRemoval(r.Context(), vars["name"], vars["type"])
+	panicIfError("Not possible to remove the record set from the DNS server", err)
+	writeJSONResponse(removal, http.StatusOK, w)
+}
+
+// GetAudit lists the audit entries matched by the name and type query parameters, the oldest first.
+// The since and until query parameters bound the time of the entries, as RFC 3339 times
+func (s *Server) GetAudit(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	params := r.URL.Query()
+	query := manager.AuditQuery{Name: params.Get("name"), Type: params.Get("type"), Source: params.Get("source"), Since: timestamp(r, "since"), Until: timestamp(r, "until")}
+	entries, err := s.Manager.QueryAudit(query)
+	panicIfError("Not possible to query the audit log", err)
+	writeJSONResponse(entries, http.StatusOK, w)
+}
+
+// GetHistory lists the versions of the record set, the oldest first
+func (s *Server) GetHistory(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	vars := mux.Vars(r)
+	history, err := s.Manager.GetHistory(vars["name"], vars["type"])
+	panicIfError("Not possible to read the history of the record set", err)
+	writeJSONResponse(history, http.StatusOK, w)
+}
+
+// RollbackRecord writes back the values the record set held at the version query parameter, returning the version
+func (s *Server) RollbackRecord(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil || version < 1 {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("The version query parameter must be a version number of the history", err))
+	}
+	result, err := s.Manager.RollbackRecord(r.Context(), vars["name"], vars["type"], version)
+	panicIfError("Not possible to roll the record set back", err)
+	writeJSONResponse(result, http.StatusOK, w)
+}
+
+// RollbackZone rolls the record sets of the zone query parameter back to the values they held at the at query parameter,
+// an RFC 3339 time, returning the report. All the managed zones are rolled back when no zone is given.
+// The changes are only reported when the dryRun query parameter is true
+func (s *Server) RollbackZone(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	at := timestamp(r, "at")
+	if at.IsZero() {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("The at query parameter is required", nil))
+	}
+	report, err := s.Manager.RollbackZone(r.Context(), r.URL.Query().Get("zone"), at, dryRun(r))
+	panicIfError("Not possible to roll the zone back", err)
+	writeJSONResponse(report, http.StatusOK, w)
+}
+
+// GetOperations lists the asynchronous writes matched by the name, type and status query parameters, in the order they were submitted
+func (s *Server) GetOperations(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	params := r.URL.Query()
+	query := manager.OperationQuery{Name: params.Get("name"), Type: params.Get("type"), Status: params.Get("status")}
+	switch query.Status {
+	case "", manager.OperationPending, manager.OperationApplied, manager.OperationFailed:
+	default:
+		hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("The status query parameter must be %s, %s or %s",
+			manager.OperationPending, manager.OperationApplied, manager.OperationFailed), nil))
+	}
+	operations, err := s.Manager.ListOperations(query)
+	panicIfError("Not possible to list the operations", err)
+	writeJSONResponse(operations, http.StatusOK, w)
+}
+
+// GetOperation returns the asynchronous write identified by the id, telling its status
+func (s *Server) GetOperation(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	operation, err := s.Manager.GetOperation(mux.Vars(r)["id"])
+	panicIfError("Not possible to read the operation", err)
+	writeJSONResponse(operation, http.StatusOK, w)
+}
+
+// SubmitOperation queues the write of the record described by the OperationRequest body, answering 202 Accepted
+// with the operation right away
+func (s *Server) SubmitOperation(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+
+	var req OperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted operation on request body", err))
+	}
+	if errs := req.Record.Check(); errs != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted record on request body", nil, errs...))
+	}
+	var operation *manager.Operation
+	var err error
+	switch req.Action {
+	case manager.AuditAdd:
+		operation, err = s.Manager.SubmitAddDNSRecord(req.Record)
+	case manager.AuditUpdate:
+		operation, err = s.Manager.SubmitUpdateDNSRecord(req.Record)
+	default:
+		hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("The action must be %s or %s", manager.AuditAdd, manager.AuditUpdate), nil))
+	}
+	panicIfError("Not possible to submit the operation", err)
+	writeJSONResponse(operation, http.StatusAccepted, w)
+}
+
+// panicIfError raises err as is when it tells its HTTP status code, or as an internal server error with the message otherwise
+func panicIfError(message string, err error) {
+	if err == nil {
+		return
+	}
+	if e, ok := err.(*hookTypes.Error); ok {
+		hookTypes.PanicIfError(e)
+	}
+	hookTypes.PanicIfError(hookTypes.InternalServerError(message, err, err.Error()))
+}
+
+// duration reads the query parameter of the request as a duration, zero when absent
+func duration(r *http.Request, name string) time.Duration {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil || result < 0 {
+		hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("The %s query parameter must be a positive duration, e.g. 24h", name), err))
+	}
+	return result
+}
+
+// timestamp reads the query parameter of the request as an RFC 3339 time, zero when absent
+func timestamp(r *http.Request, name string) time.Time {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}
+	}
+	result, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("The %s query parameter must be an RFC 3339 time, e.g. 2019-10-01T12:00:00Z", name), err))
+	}
+	return result
+}
+
+// dryRun reads the dryRun query parameter of the request, false when absent
+func dryRun(r *http.Request) bool {
+	value := r.URL.Query().Get("dryRun")
+	if value == "" {
+		return false
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("The dryRun query parameter must be true or false", err))
+	}
+	return result
+}
+
+// writeJSONResponse writes the payload as the JSON body of the response
+func writeJSONResponse(payload interface{}, statusCode int, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if payload != nil {
+		hookTypes.PanicIfError(json.NewEncoder(w).Encode(payload))
+	}
+}
+
+// handleError recovers from a panic, answering with the error it was raised with
+func handleError(w http.ResponseWriter) {
+	r := recover()
+	if r != nil {
+		err := hookTypes.InternalServerError("An internal server error occurred, please contact the system administrator.", nil)
+		if e, ok := r.(*hookTypes.Error); ok {
+			err = e
+		}
+		logrus.Error(err)
+		writeJSONResponse(err, err.Code, w)
+	}
+}
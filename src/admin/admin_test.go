@@ -0,0 +1,355 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// MockDNSUpdater defines a mock AzUpdater of an empty zone reporting fixed zone statuses
+type MockDNSUpdater struct {
+	Statuses []azure.ZoneStatus
+}
+
+func (m *MockDNSUpdater) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	return nil
+}
+
+func (m *MockDNSUpdater) UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	return nil
+}
+
+func (m *MockDNSUpdater) SetRR(ctx context.Context, name, recordType string, values []string, ttl time.Duration) error {
+	return nil
+}
+
+func (m *MockDNSUpdater) RemoveRR(ctx context.Context, name, recordType, value string) error {
+	return nil
+}
+
+func (m *MockDNSUpdater) ListRecordSets(ctx context.Context) ([]azure.ZoneRecordSet, error) {
+	return nil, nil
+}
+
+func (m *MockDNSUpdater) ZoneStatuses() []azure.ZoneStatus {
+	return m.Statuses
+}
+
+// newTestServer creates a Server of a Manager storing its records in a temporary directory
+func newTestServer(t *testing.T, updater *MockDNSUpdater) (*Server, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "bindman-admin")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	m, err := (&manager.Builder{InstanceID: "blue"}).New(updater, dir)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	server, err := new(Builder).New(m, updater)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return server, func() { _ = os.RemoveAll(dir) }
+}
+
+// serve sends the request to the server, returning the response
+func serve(server *Server, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestBuilder_New(t *testing.T) {
+	if _, err := new(Builder).New(nil, new(MockDNSUpdater)); err == nil {
+		t.Errorf("Expecting New to fail without a Manager")
+	}
+	m, _ := new(manager.Builder).New(new(MockDNSUpdater), os.TempDir())
+	if _, err := new(Builder).New(m, nil); err == nil {
+		t.Errorf("Expecting New to fail without a ZoneStatusReporter")
+	}
+	for _, address := range []string{"0.0.0.0:7071", ":7071", "10.0.0.1:7071"} {
+		if _, err := (&Builder{Address: address}).New(m, new(MockDNSUpdater)); err == nil {
+			t.Errorf("Expecting New to require a token to listen on '%s'", address)
+		}
+		if _, err := (&Builder{Address: address, Token: "secret"}).New(m, new(MockDNSUpdater)); err != nil {
+			t.Errorf("Expecting New to listen on '%s' with a token. Got err '%v'", address, err)
+		}
+	}
+	for _, address := range []string{"127.0.0.1:7071", "localhost:7071", "[::1]:7071"} {
+		if _, err := (&Builder{Address: address}).New(m, new(MockDNSUpdater)); err != nil {
+			t.Errorf("Expecting New to listen on the loopback address '%s' without a token. Got err '%v'", address, err)
+		}
+	}
+}
+
+func TestServer_Authenticate(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	server, err := (&Builder{Address: "0.0.0.0:7071", Token: "secret"}).New(server.Manager, new(MockDNSUpdater))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	api := httptest.NewServer(server.Handler())
+	defer api.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		_, err := (&Client{URL: api.URL, Token: token}).PendingRemovals()
+		if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusUnauthorized {
+			t.Errorf("Expecting the call with the token '%s' to fail with the HTTP status code 401. Got err '%v'", token, err)
+		}
+	}
+	if _, err := (&Client{URL: api.URL, Token: "secret"}).PendingRemovals(); err != nil {
+		t.Errorf("Expecting the call bearing the token to succeed. Got err '%v'", err)
+	}
+}
+
+func TestServer_GetStatus(t *testing.T) {
+	checkedAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	ok := azure.ZoneStatus{Zone: "test.com", Type: azure.PublicZone, ResourceGroup: "rg", SubscriptionID: "sub", Checked: true, CheckedAt: &checkedAt, Exists: true, Writable: true, NameServers: []string{"ns1-01.azure-dns.com."}}
+	failed := azure.ZoneStatus{Zone: "other.com", Type: azure.PublicZone, ResourceGroup: "rg", SubscriptionID: "sub", Checked: true, CheckedAt: &checkedAt, Error: `The public zone "other.com" was not found`}
+	unchecked := azure.ZoneStatus{Zone: "third.com", Type: azure.PublicZone, ResourceGroup: "rg", SubscriptionID: "sub"}
+
+	testCases := []struct {
+		name         string
+		zones        []azure.ZoneStatus
+		expectedCode int
+	}{
+		{"healthy", []azure.ZoneStatus{ok}, http.StatusOK},
+		{"unchecked", []azure.ZoneStatus{ok, unchecked}, http.StatusOK},
+		{"failed", []azure.ZoneStatus{ok, failed}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cleanup := newTestServer(t, &MockDNSUpdater{Statuses: tt.zones})
+			defer cleanup()
+			w := serve(server, http.MethodGet, "/status")
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expecting status code %d. Got %d", tt.expectedCode, w.Code)
+			}
+			var status Status
+			if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+				t.Fatalf("Expecting a JSON body. Got err '%v'", err)
+			}
+			if status.Healthy != (tt.expectedCode == http.StatusOK) {
+				t.Errorf("Expecting healthy to be %v", !status.Healthy)
+			}
+			if !reflect.DeepEqual(status.Zones, tt.zones) {
+				t.Errorf("Expecting the zone statuses %+v. Got %+v", tt.zones, status.Zones)
+			}
+		})
+	}
+}
+
+func TestServer_Reconcile(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+
+	if w := serve(server, http.MethodGet, "/reconcile"); w.Code != http.StatusNotFound {
+		t.Errorf("Expecting no report before the first reconciliation. Got status code %d", w.Code)
+	}
+	if w := serve(server, http.MethodPost, "/reconcile?dryRun=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid dryRun to be rejected. Got status code %d", w.Code)
+	}
+
+	w := serve(server, http.MethodPost, "/reconcile?dryRun=true")
+	var report manager.ReconcileReport
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&report) != nil || !report.DryRun {
+		t.Fatalf("Expecting the reconciliation to run in dry-run mode. Got status code %d and report %+v", w.Code, report)
+	}
+
+	w = serve(server, http.MethodGet, "/reconcile")
+	var last manager.ReconcileReport
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&last) != nil || !last.StartedAt.Equal(report.StartedAt) {
+		t.Errorf("Expecting the report of the last reconciliation. Got status code %d and report %+v", w.Code, last)
+	}
+}
+
+func TestServer_CollectGarbage(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+
+	if w := serve(server, http.MethodGet, "/gc"); w.Code != http.StatusNotFound {
+		t.Errorf("Expecting no report before the first garbage collection. Got status code %d", w.Code)
+	}
+	if w := serve(server, http.MethodPost, "/gc?dryRun=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid dryRun to be rejected. Got status code %d", w.Code)
+	}
+
+	w := serve(server, http.MethodPost, "/gc?dryRun=true")
+	var report manager.GCReport
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&report) != nil || !report.DryRun {
+		t.Fatalf("Expecting the garbage collection to run in dry-run mode. Got status code %d and report %+v", w.Code, report)
+	}
+
+	w = serve(server, http.MethodGet, "/gc")
+	var last manager.GCReport
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&last) != nil || !last.StartedAt.Equal(report.StartedAt) {
+		t.Errorf("Expecting the report of the last garbage collection. Got status code %d and report %+v", w.Code, last)
+	}
+}
+
+func TestServer_GetRecords(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	for _, record := range []hookTypes.DNSRecord{
+		{Name: "www.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "www.test.com", Type: "TXT", Value: "v=spf1 -all"},
+		{Name: "api.test.com", Type: "A", Value: "10.0.0.2"},
+	} {
+		if err := server.Manager.AddDNSRecord(record); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+
+	w := serve(server, http.MethodGet, "/records?type=A&prefix=www.")
+	var records []manager.StoredRecord
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&records) != nil {
+		t.Fatalf("Expecting the records to be listed. Got status code %d", w.Code)
+	}
+	if len(records) != 1 || records[0].Name != "www.test.com" || records[0].Type != "A" {
+		t.Errorf("Expecting only the record of the type and prefix. Got %+v", records)
+	}
+	if w := serve(server, http.MethodGet, "/records?olderThan=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid duration to be rejected. Got status code %d", w.Code)
+	}
+	if w := serve(server, http.MethodGet, "/records?olderThan=24h"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting the filters by age to be rejected by the diskv store. Got status code %d", w.Code)
+	}
+	if w := serve(server, http.MethodGet, "/records?createdAfter=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid time to be rejected. Got status code %d", w.Code)
+	}
+
+	for owner, expected := range map[string]int{"blue": 3, "green": 0} {
+		w = serve(server, http.MethodGet, "/records?owner="+owner)
+		records = nil
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&records) != nil || len(records) != expected {
+			t.Errorf("Expecting %d records stored by '%s'. Got status code %d and %+v", expected, owner, w.Code, records)
+		}
+	}
+}
+
+func TestServer_GetAudit(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	for _, record := range []hookTypes.DNSRecord{
+		{Name: "www.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "www.test.com", Type: "TXT", Value: "v=spf1 -all"},
+		{Name: "api.test.com", Type: "A", Value: "10.0.0.2"},
+	} {
+		if err := server.Manager.AddDNSRecord(record); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+
+	w := serve(server, http.MethodGet, "/audit?name=www.test.com&type=A")
+	var entries []manager.AuditEntry
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&entries) != nil {
+		t.Fatalf("Expecting the audit entries to be listed. Got status code %d", w.Code)
+	}
+	if len(entries) != 1 || entries[0].Action != manager.AuditAdd || entries[0].Name != "www.test.com" || entries[0].Type != "A" ||
+		entries[0].Source != manager.SourceWebhook {
+		t.Errorf("Expecting only the entry of the name and type. Got %+v", entries)
+	}
+	if w := serve(server, http.MethodGet, "/audit?source=gc"); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("Expecting no entry of another source. Got status code %d and body %s", w.Code, w.Body)
+	}
+	if w := serve(server, http.MethodGet, "/audit?until=2000-01-01T00:00:00Z"); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("Expecting no entry before the until time. Got status code %d and body %s", w.Code, w.Body)
+	}
+	if w := serve(server, http.MethodGet, "/audit?since=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid time to be rejected. Got status code %d", w.Code)
+	}
+}
+
+func TestServer_Rollback(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+
+	if w := serve(server, http.MethodGet, "/history/www.test.com/A"); w.Code != http.StatusNotFound {
+		t.Errorf("Expecting the history of an unknown record set to be missing. Got status code %d", w.Code)
+	}
+	if err := server.Manager.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	w := serve(server, http.MethodGet, "/history/www.test.com/A")
+	var history []manager.RecordVersion
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&history) != nil || len(history) != 1 || history[0].Action != manager.AuditAdd {
+		t.Errorf("Expecting the history to be listed. Got status code %d and history %+v", w.Code, history)
+	}
+	if w := serve(server, http.MethodPost, "/history/www.test.com/A/rollback?version=first"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid version to be rejected. Got status code %d", w.Code)
+	}
+	if w := serve(server, http.MethodPost, "/rollback"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting a rollback without time to be rejected. Got status code %d", w.Code)
+	}
+	w = serve(server, http.MethodPost, "/rollback?at=2000-01-01T00:00:00Z&dryRun=true")
+	var report manager.RollbackReport
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&report) != nil || !report.DryRun || len(report.Removed) != 1 {
+		t.Errorf("Expecting the record set created since the time to be reported. Got status code %d and report %+v", w.Code, report)
+	}
+	if !server.Manager.HasDNSRecord("www.test.com", "A") {
+		t.Errorf("Expecting a dry run to leave the record set untouched")
+	}
+}
+
+func TestServer_Operations(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	defer server.Manager.Shutdown()
+	submit := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/operations", strings.NewReader(body)))
+		return w
+	}
+	body := `{"action":"add","record":{"name":"www.test.com","type":"A","value":"10.0.0.1"}}`
+
+	if w := submit(body); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting the submission to be rejected while the asynchronous writes are disabled. Got status code %d", w.Code)
+	}
+	server.Manager.AsyncWrites = true
+	if err := server.Manager.StartOperationWorkers(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if w := submit(`{"action":"remove","record":{"name":"www.test.com","type":"A","value":"10.0.0.1"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an unknown action to be rejected. Got status code %d", w.Code)
+	}
+	if w := submit(`{"action":"add","record":{"name":"www.test.com"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid record to be rejected. Got status code %d", w.Code)
+	}
+	w := submit(body)
+	var operation manager.Operation
+	if w.Code != http.StatusAccepted || json.NewDecoder(w.Body).Decode(&operation) != nil || operation.ID == "" {
+		t.Fatalf("Expecting the operation to be accepted. Got status code %d", w.Code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for operation.Status == manager.OperationPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		w = serve(server, http.MethodGet, "/operations/"+operation.ID)
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&operation) != nil {
+			t.Fatalf("Expecting the operation to be found. Got status code %d", w.Code)
+		}
+	}
+	if operation.Status != manager.OperationApplied || !server.Manager.HasDNSRecord("www.test.com", "A") {
+		t.Errorf("Expecting the operation to be applied. Got %+v", operation)
+	}
+	if w := serve(server, http.MethodGet, "/operations/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("Expecting an unknown operation to be missing. Got status code %d", w.Code)
+	}
+	if w := serve(server, http.MethodGet, "/operations?status=done"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an unknown status to be rejected. Got status code %d", w.Code)
+	}
+}
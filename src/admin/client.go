@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// Client calls the administration API of a running Bindman
+type Client struct {
+	// URL is the base URL of the administration API
+	URL string
+	// Timeout bounds each call; no bound when zero
+	Timeout time.Duration
+	// Token is sent as a bearer token in the Authorization header of each call when set
+	Token string
+}
+
+// PendingRemovals lists the delayed removals in progress, the soonest due first
+func (c *Client) PendingRemovals() (removals []manager.Removal, err error) {
+	err = c.call(http.MethodGet, "/removals", &removals)
+	return
+}
+
+// CancelRemoval cancels the delayed removal in progress of the record set
+func (c *Client) CancelRemoval(name, recordType string) (removal *manager.Removal, err error) {
+	err = c.call(http.MethodDelete, removalPath(name, recordType), &removal)
+	return
+}
+
+// ForceRemoval removes the record set from the DNS server right away
+func (c *Client) ForceRemoval(name, recordType string) (removal *manager.Removal, err error) {
+	err = c.call(http.MethodPost, removalPath(name, recordType)+"/force", &removal)
+	return
+}
+
+// Audit lists the audit entries matched by the query, the oldest first
+func (c *Client) Audit(q manager.AuditQuery) (entries []manager.AuditEntry, err error) {
+	params := url.Values{}
+	if q.Name != "" {
+		params.Set("name", q.Name)
+	}
+	if q.Type != "" {
+		params.Set("type", q.Type)
+	}
+	if q.Source != "" {
+		params.Set("source", q.Source)
+	}
+	if !q.Since.IsZero() {
+		params.Set("since", q.Since.Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		params.Set("until", q.Until.Format(time.RFC3339Nano))
+	}
+	err = c.call(http.MethodGet, "/audit?"+params.Encode(), &entries)
+	return
+}
+
+// History lists the versions of the record set, the oldest first
+func (c *Client) History(name, recordType string) (history []manager.RecordVersion, err error) {
+	err = c.call(http.MethodGet, historyPath(name, recordType), &history)
+	return
+}
+
+// RollbackRecord writes back the values the record set held at the version of its history
+func (c *Client) RollbackRecord(name, recordType string, version int) (result *manager.RecordVersion, err error) {
+	err = c.call(http.MethodPost, fmt.Sprintf("%s/rollback?version=%d", historyPath(name, recordType), version), &result)
+	return
+}
+
+// RollbackZone rolls the record sets of the zone back to the values they held at the time; all the zones when zone is empty
+func (c *Client) RollbackZone(zone string, at time.Time, dryRun bool) (report *manager.RollbackReport, err error) {
+	params := url.Values{}
+	params.Set("at", at.Format(time.RFC3339Nano))
+	params.Set("dryRun", strconv.FormatBool(dryRun))
+	if zone != "" {
+		params.Set("zone", zone)
+	}
+	err = c.call(http.MethodPost, "/rollback?"+params.Encode(), &report)
+	return
+}
+
+// Operations lists the asynchronous writes matched by the query, in the order they were submitted
+func (c *Client) Operations(q manager.OperationQuery) (operations []manager.Operation, err error) {
+	params := url.Values{}
+	if q.Name != "" {
+		params.Set("name", q.Name)
+	}
+	if q.Type != "" {
+		params.Set("type", q.Type)
+	}
+	if q.Status != "" {
+		params.Set("status", q.Status)
+	}
+	err = c.call(http.MethodGet, "/operations?"+params.Encode(), &operations)
+	return
+}
+
+// Operation reads the asynchronous write identified by id
+func (c *Client) Operation(id string) (operation *manager.Operation, err error) {
+	err = c.call(http.MethodGet, "/operations/"+url.PathEscape(id), &operation)
+	return
+}
+
+// call sends a request to the administration API, decoding the JSON body of the response into result.
+// The errors answered by the API are returned as *hookTypes.Error
+func (c *Client) call(method, path string, result interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := (&http.Client{Timeout: c.Timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &hookTypes.Error{}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Message == "" {
+			return fmt.Errorf("the administration API answered with the HTTP status code %d", resp.StatusCode)
+		}
+		return e
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// historyPath returns the path of the history of the record set
+func historyPath(name, recordType string) string {
+	return "/history/" + url.PathEscape(name) + "/" + url.PathEscape(recordType)
+}
+
+// removalPath returns the path of the delayed removal of the record set
+func removalPath(name, recordType string) string {
+	return "/removals/" + url.PathEscape(name) + "/" + url.PathEscape(recordType)
+}
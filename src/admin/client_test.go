@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestClient_Removals(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	defer server.Manager.Shutdown()
+	server.Manager.RemovalDelay = time.Hour
+	for _, name := range []string{"first.test.com", "second.test.com"} {
+		if err := server.Manager.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if err := server.Manager.RemoveDNSRecord(name, "A"); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	api := httptest.NewServer(server.Handler())
+	defer api.Close()
+	client := &Client{URL: api.URL + "/"}
+
+	removals, err := client.PendingRemovals()
+	if err != nil || len(removals) != 2 || removals[0].Name != "first.test.com" || removals[0].DueAt.IsZero() {
+		t.Fatalf("Expecting the pending removals to be listed. Got %v and err '%v'", removals, err)
+	}
+
+	removal, err := client.CancelRemoval("first.test.com", "A")
+	if err != nil || removal.Name != "first.test.com" || !server.Manager.HasDNSRecord("first.test.com", "A") {
+		t.Errorf("Expecting the removal to be cancelled. Got %v and err '%v'", removal, err)
+	}
+	_, err = client.CancelRemoval("first.test.com", "A")
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusNotFound {
+		t.Errorf("Expecting the cancellation of a removal no longer pending to fail with the HTTP status code 404. Got err '%v'", err)
+	}
+
+	removal, err = client.ForceRemoval("second.test.com", "A")
+	if err != nil || removal.Name != "second.test.com" {
+		t.Errorf("Expecting the record set to be removed right away. Got %v and err '%v'", removal, err)
+	}
+	if removals, err = client.PendingRemovals(); err != nil || len(removals) != 0 {
+		t.Errorf("Expecting no pending removal left. Got %v and err '%v'", removals, err)
+	}
+}
+
+func TestClient_Audit(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	start := time.Now().Add(-time.Second)
+	for _, name := range []string{"first.test.com", "second.test.com"} {
+		if err := server.Manager.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	api := httptest.NewServer(server.Handler())
+	defer api.Close()
+	client := &Client{URL: api.URL}
+
+	entries, err := client.Audit(manager.AuditQuery{Name: "second.test.com", Type: "A", Since: start, Until: time.Now().Add(time.Minute)})
+	if err != nil || len(entries) != 1 || entries[0].Name != "second.test.com" || entries[0].Outcome != manager.AuditSucceeded {
+		t.Errorf("Expecting the audit entries of the record to be listed. Got %v and err '%v'", entries, err)
+	}
+	if entries, err = client.Audit(manager.AuditQuery{}); err != nil || len(entries) != 2 {
+		t.Errorf("Expecting all the audit entries to be listed. Got %v and err '%v'", entries, err)
+	}
+	if entries, err = client.Audit(manager.AuditQuery{Source: manager.SourceAdmin}); err != nil || len(entries) != 0 {
+		t.Errorf("Expecting no audit entry of the administration API. Got %v and err '%v'", entries, err)
+	}
+}
+
+func TestClient_Rollback(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	defer server.Manager.Shutdown()
+	server.Manager.RemovalDelay = time.Hour
+	if err := server.Manager.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	at := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	for _, value := range []string{"10.0.0.2", "10.0.0.3"} {
+		if err := server.Manager.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	api := httptest.NewServer(server.Handler())
+	defer api.Close()
+	client := &Client{URL: api.URL}
+
+	history, err := client.History("www.test.com", "A")
+	if err != nil || len(history) != 3 || history[2].Values[0] != "10.0.0.3" {
+		t.Fatalf("Expecting the history of the record set to be listed. Got %v and err '%v'", history, err)
+	}
+	version, err := client.RollbackRecord("www.test.com", "A", 2)
+	if r, _ := server.Manager.GetRecord("www.test.com", "A"); err != nil || version.Version != 2 || r.Values[0] != "10.0.0.2" {
+		t.Errorf("Expecting the record set to be rolled back to the version 2. Got %v and err '%v'", r, err)
+	}
+	if _, err = client.RollbackRecord("www.test.com", "A", 9); err == nil {
+		t.Errorf("Expecting the rollback to an unknown version to fail")
+	}
+
+	report, err := client.RollbackZone("", at, false)
+	if err != nil || len(report.Restored) != 1 || report.Restored[0].Values[0] != "10.0.0.1" {
+		t.Errorf("Expecting the record sets to be rolled back to the time. Got %+v and err '%v'", report, err)
+	}
+	if r, _ := server.Manager.GetRecord("www.test.com", "A"); r.Values[0] != "10.0.0.1" {
+		t.Errorf("Expecting the record set to hold its first value back. Got %v", r)
+	}
+}
+
+func TestClient_Operations(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	defer server.Manager.Shutdown()
+	server.Manager.AsyncWrites = true
+	operation, err := server.Manager.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	api := httptest.NewServer(server.Handler())
+	defer api.Close()
+	client := &Client{URL: api.URL}
+
+	if operation, err = client.Operation(operation.ID); err != nil || operation.Status != manager.OperationPending {
+		t.Errorf("Expecting the operation to wait for the workers. Got %v and err '%v'", operation, err)
+	}
+	operations, err := client.Operations(manager.OperationQuery{Name: "www.test.com", Type: "A", Status: manager.OperationPending})
+	if err != nil || len(operations) != 1 || operations[0].ID != operation.ID {
+		t.Errorf("Expecting the pending operation to be listed. Got %v and err '%v'", operations, err)
+	}
+	if operations, err = client.Operations(manager.OperationQuery{Status: manager.OperationFailed}); err != nil || len(operations) != 0 {
+		t.Errorf("Expecting no failed operation. Got %v and err '%v'", operations, err)
+	}
+}
@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	adminAddress        = "admin-address"
+	adminURL            = "admin-url"
+	adminTimeout        = "admin-timeout"
+	adminToken          = "admin-token"
+	defaultAdminAddress = "127.0.0.1:7071"
+	defaultAdminURL     = "http://localhost:7071"
+	defaultAdminTimeout = 5 * time.Minute
+)
+
+// AddFlags adds flags for Builder.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.String(adminAddress, defaultAdminAddress, "TCP address the administration API listens on, apart from the webhook API. Empty disables it")
+	flags.String(adminToken, "", "Token the calls to the administration API must bear in their Authorization header. Required when it listens on another address than the loopback one")
+}
+
+// InitFromViper initializes Builder with properties retrieved from Viper.
+func (b *Builder) InitFromViper(v *viper.Viper) *Builder {
+	b.Address = v.GetString(adminAddress)
+	b.Token = v.GetString(adminToken)
+	return b
+}
+
+// AddClientFlags adds flags for Client.
+func AddClientFlags(flags *pflag.FlagSet) {
+	flags.String(adminURL, defaultAdminURL, "Base URL of the administration API of the running Bindman")
+	flags.Duration(adminTimeout, defaultAdminTimeout, "Maximum time to wait for each call to the administration API. Zero means no limit")
+	flags.String(adminToken, "", "Token the administration API of the running Bindman requires, if any")
+}
+
+// InitFromViper initializes Client with properties retrieved from Viper.
+func (c *Client) InitFromViper(v *viper.Viper) *Client {
+	c.URL = v.GetString(adminURL)
+	c.Timeout = v.GetDuration(adminTimeout)
+	c.Token = v.GetString(adminToken)
+	return c
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBingFlags(t *testing.T) {
+	v := viper.New()
+	command := cobra.Command{}
+	AddFlags(command.Flags())
+	_ = v.BindPFlags(command.Flags())
+
+	err := command.ParseFlags([]string{
+		fmt.Sprintf("--%s=127.0.0.1:9000", adminAddress),
+		fmt.Sprintf("--%s=secret", adminToken),
+	})
+	require.NoError(t, err)
+
+	b := &Builder{}
+	b.InitFromViper(v)
+
+	assert.Equal(t, "127.0.0.1:9000", b.Address)
+	assert.Equal(t, "secret", b.Token)
+}
+
+func TestDefaultValues(t *testing.T) {
+	v := viper.New()
+	command := cobra.Command{}
+	AddFlags(command.Flags())
+	_ = v.BindPFlags(command.Flags())
+
+	b := &Builder{}
+	b.InitFromViper(v)
+
+	assert.Equal(t, defaultAdminAddress, b.Address)
+	assert.Equal(t, "", b.Token)
+}
+
+func TestBindClientFlags(t *testing.T) {
+	v := viper.New()
+	command := cobra.Command{}
+	AddClientFlags(command.Flags())
+	_ = v.BindPFlags(command.Flags())
+
+	err := command.ParseFlags([]string{
+		fmt.Sprintf("--%s=http://bindman:9000", adminURL),
+		fmt.Sprintf("--%s=10s", adminTimeout),
+		fmt.Sprintf("--%s=secret", adminToken),
+	})
+	require.NoError(t, err)
+
+	c := &Client{}
+	c.InitFromViper(v)
+
+	assert.Equal(t, "http://bindman:9000", c.URL)
+	assert.Equal(t, 10*time.Second, c.Timeout)
+	assert.Equal(t, "secret", c.Token)
+}
+
+func TestClientDefaultValues(t *testing.T) {
+	v := viper.New()
+	command := cobra.Command{}
+	AddClientFlags(command.Flags())
+	_ = v.BindPFlags(command.Flags())
+
+	c := &Client{}
+	c.InitFromViper(v)
+
+	assert.Equal(t, defaultAdminURL, c.URL)
+	assert.Equal(t, defaultAdminTimeout, c.Timeout)
+}
@@ -0,0 +1,122 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/labbsr0x/bindman-dns-webhook/src/hook"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookAddress is the TCP address the webhook API listens on, the one of the bindman-dns-webhook library
+	WebhookAddress = "0.0.0.0:7070"
+	// OperationHeader is the header of the responses to the additions and updates of records telling the ID of the
+	// operation queued to apply them, when the writes are asynchronous
+	OperationHeader = "X-Bindman-Operation"
+)
+
+// Instrument wraps the handler of a route, e.g. to measure it; the HandleFunc of the metrics of the bindman-dns-webhook library
+type Instrument func(path string, next http.HandlerFunc) (string, http.HandlerFunc)
+
+// Webhook serves the webhook API of the bindman-dns-webhook library in place of its hook package, extending its routes
+type Webhook struct {
+	hook.DNSWebhook
+	Manager *manager.Manager
+
+	router *mux.Router
+	server *http.Server
+}
+
+// NewWebhook creates the webhook API of the Manager, listening on WebhookAddress, each route being wrapped by instrument
+func NewWebhook(m *manager.Manager, instrument Instrument) *Webhook {
+	result := &Webhook{DNSWebhook: hook.DNSWebhook{DNSManager: m}, Manager: m, router: mux.NewRouter()}
+	result.router.HandleFunc(instrument("/records", result.GetDNSRecords)).Methods(http.MethodGet)
+	result.router.HandleFunc(instrument("/records/{name}/{type}", result.GetDNSRecord)).Methods(http.MethodGet)
+	result.router.HandleFunc(instrument("/records/{name}/{type}", result.RemoveDNSRecord)).Methods(http.MethodDelete)
+	result.router.HandleFunc(instrument("/records", result.AddDNSRecord)).Methods(http.MethodPost)
+	result.router.HandleFunc(instrument("/records", result.UpdateDNSRecord)).Methods(http.MethodPut)
+	result.router.Handle("/metrics", promhttp.Handler())
+	result.server = &http.Server{Addr: WebhookAddress, Handler: result.router}
+	return result
+}
+
+// Handler returns the handler of the webhook API
+func (wh *Webhook) Handler() http.Handler {
+	return wh.router
+}
+
+// ListenAndServe serves the webhook API until Shutdown is called
+func (wh *Webhook) ListenAndServe() error {
+	logrus.Info("Initialized DNS Manager Webhook")
+	if err := wh.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the webhook API, waiting for the requests in progress until ctx is done
+func (wh *Webhook) Shutdown(ctx context.Context) error {
+	return wh.server.Shutdown(ctx)
+}
+
+// AddDNSRecord adds the value of the record to its record set, answering 204 No Content.
+// With asynchronous writes, the ID of the operation queued is told by the OperationHeader
+func (wh *Webhook) AddDNSRecord(w http.ResponseWriter, r *http.Request) {
+	if !wh.Manager.AsyncWrites {
+		wh.DNSWebhook.AddDNSRecord(w, r)
+		return
+	}
+	defer handleError(w)
+	logrus.Infof("AddDNSRecord call. Http Request: %v", r)
+	wh.submit(w, r, wh.Manager.SubmitAddDNSRecord)
+}
+
+// UpdateDNSRecord replaces all the values of the record set by the value of the record, answering 204 No Content.
+// With asynchronous writes, the ID of the operation queued is told by the OperationHeader
+func (wh *Webhook) UpdateDNSRecord(w http.ResponseWriter, r *http.Request) {
+	if !wh.Manager.AsyncWrites {
+		wh.DNSWebhook.UpdateDNSRecord(w, r)
+		return
+	}
+	defer handleError(w)
+	logrus.Infof("UpdateDNSRecord call. Http Request: %v", r)
+	wh.submit(w, r, wh.Manager.SubmitUpdateDNSRecord)
+}
+
+// submit queues the write of the record of the request body
+func (wh *Webhook) submit(w http.ResponseWriter, r *http.Request, do func(record hookTypes.DNSRecord) (*manager.Operation, error)) {
+	var record hookTypes.DNSRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted record on request body", err))
+	}
+	if errs := record.Check(); errs != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted record on request body", nil, errs...))
+	}
+	operation, err := do(record)
+	panicIfError("Not possible to submit the operation", err)
+	w.Header().Set(OperationHeader, operation.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveDNSRecord removes the record set, or only the value query parameter from it so that the other values of a
+// round-robin record set are kept, answering 204 No Content
+func (wh *Webhook) RemoveDNSRecord(w http.ResponseWriter, r *http.Request) {
+	value := r.URL.Query().Get("value")
+	if value == "" {
+		wh.DNSWebhook.RemoveDNSRecord(w, r)
+		return
+	}
+	defer handleError(w)
+	logrus.Infof("RemoveDNSRecordValue call. Http Request: %v", r)
+
+	vars := mux.Vars(r)
+	err := wh.Manager.RemoveDNSRecordValue(vars["name"], vars["type"], value)
+	panicIfError("Not possible to remove the value of the record set", err)
+	w.WriteHeader(http.StatusNoContent)
+}
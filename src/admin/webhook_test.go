@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// noInstrument leaves the routes of the webhook API as they are
+func noInstrument(path string, next http.HandlerFunc) (string, http.HandlerFunc) {
+	return path, next
+}
+
+func TestWebhook_AsyncWrites(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	server.Manager.AsyncWrites = true
+	webhook := NewWebhook(server.Manager, noInstrument)
+	call := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		webhook.Handler().ServeHTTP(w, httptest.NewRequest(method, "/records", strings.NewReader(body)))
+		return w
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		w := call(method, `{"name":"www.test.com","type":"A","value":"10.0.0.1"}`)
+		if w.Code != http.StatusNoContent || w.Header().Get(OperationHeader) == "" {
+			t.Fatalf("Expecting the %s call to answer 204 with the ID of its operation. Got %d: %s", method, w.Code, w.Body.String())
+		}
+		if op, err := server.Manager.GetOperation(w.Header().Get(OperationHeader)); err != nil || op.Record.Name != "www.test.com" {
+			t.Errorf("Expecting the operation of the %s call to be queued. Got %v and err '%v'", method, op, err)
+		}
+	}
+	if w := call(http.MethodPost, `{"name":"www.test.com","type":"MX","value":"mail.test.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid record to be rejected right away. Got %d", w.Code)
+	}
+}
+
+func TestWebhook_RemoveDNSRecordValue(t *testing.T) {
+	server, cleanup := newTestServer(t, new(MockDNSUpdater))
+	defer cleanup()
+	webhook := NewWebhook(server.Manager, noInstrument)
+	call := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		webhook.Handler().ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if w := call(http.MethodPost, "/records", `{"name":"www.test.com","type":"A","value":"`+value+`"}`); w.Code != http.StatusNoContent {
+			t.Fatalf("Expecting the value '%s' to be added. Got %d: %s", value, w.Code, w.Body.String())
+		}
+	}
+	if w := call(http.MethodDelete, "/records/www.test.com/A?value=10.0.0.1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expecting the value to be removed. Got %d: %s", w.Code, w.Body.String())
+	}
+	if r, err := server.Manager.GetRecord("www.test.com", "A"); err != nil || !reflect.DeepEqual(r.Values, []string{"10.0.0.2"}) {
+		t.Errorf("Expecting the other value of the record set to be kept. Got %v and err '%v'", r, err)
+	}
+	if w := call(http.MethodDelete, "/records/www.test.com/A?value=10.0.0.3", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expecting the removal of an unknown value to answer 404. Got %d", w.Code)
+	}
+
+	if w := call(http.MethodDelete, "/records/www.test.com/A", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expecting the record set to be removed. Got %d: %s", w.Code, w.Body.String())
+	}
+	if server.Manager.HasDNSRecord("www.test.com", "A") {
+		t.Errorf("Expecting the removal without value to remove the whole record set")
+	}
+	if _, err := server.Manager.GetDNSRecord("www.test.com", "A"); err.(*hookTypes.Error).Code != http.StatusNotFound {
+		t.Errorf("Expecting the record set to be missing. Got err '%v'", err)
+	}
+}
@@ -0,0 +1,215 @@
+package azure
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// Authentication modes
+const (
+	// AuthModeClientSecret authenticates as a service principal with a client secret
+	AuthModeClientSecret = "client-secret"
+	// AuthModeClientCertificate authenticates as a service principal with a PFX or PEM client certificate
+	AuthModeClientCertificate = "client-certificate"
+	// AuthModeManagedIdentity authenticates with the system assigned managed identity, or the user assigned one when a client ID is set
+	AuthModeManagedIdentity = "managed-identity"
+	// AuthModeWorkloadIdentity authenticates with a federated token file, as projected by the AKS workload identity
+	AuthModeWorkloadIdentity = "workload-identity"
+	// AuthModeEnvironment authenticates with the AZURE_* environment variables read by the Azure SDK
+	AuthModeEnvironment = "environment"
+)
+
+// clientAssertionType is the type of the client assertion holding a federated token
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// authMode returns the authentication mode of the Builder, inferring it from the credentials when none is set
+func (b *Builder) authMode() string {
+	if b.AuthMode != "" {
+		return b.AuthMode
+	}
+	if b.ClientID != "" && b.ClientSecret != "" && b.TenantID != "" {
+		return AuthModeClientSecret
+	}
+	return AuthModeEnvironment
+}
+
+// checkAuth tests if the settings required by the authentication mode are ok; returns a set of error strings in case something is not right
+func (b *Builder) checkAuth() (errs []string) {
+	mode := b.authMode()
+	required := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Sprintf(`The "%v" must be specified when using the "%v" authentication mode`, name, mode))
+		}
+	}
+	readable := func(name, path string) {
+		if strings.TrimSpace(path) == "" {
+			return
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			errs = append(errs, fmt.Sprintf(`The %v "%v" of the "%v" authentication mode is not a readable file`, name, path, mode))
+		}
+	}
+
+	switch mode {
+	case AuthModeClientSecret:
+		required("ClientID", b.ClientID)
+		required("ClientSecret", b.ClientSecret)
+		required("TenantID", b.TenantID)
+	case AuthModeClientCertificate:
+		required("ClientID", b.ClientID)
+		required("TenantID", b.TenantID)
+		required("CertificatePath", b.CertificatePath)
+		readable("certificate", b.CertificatePath)
+	case AuthModeWorkloadIdentity:
+		required("ClientID", b.ClientID)
+		required("TenantID", b.TenantID)
+		required("FederatedTokenFile", b.FederatedTokenFile)
+		readable("federated token file", b.FederatedTokenFile)
+	case AuthModeManagedIdentity, AuthModeEnvironment:
+	default:
+		errs = append(errs, fmt.Sprintf(`The authentication mode "%v" is not supported; use one of %v, %v, %v, %v or %v`, mode,
+			AuthModeClientSecret, AuthModeClientCertificate, AuthModeManagedIdentity, AuthModeWorkloadIdentity, AuthModeEnvironment))
+	}
+	return
+}
+
+func getAuthorizer(config *Builder, env azure.Environment) (autorest.Authorizer, error) {
+	if config.authMode() == AuthModeEnvironment {
+		settings, err := auth.GetSettingsFromEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		settings.Environment = env
+		settings.Values[auth.Resource] = env.ResourceManagerEndpoint
+		return settings.GetAuthorizer()
+	}
+
+	spt, err := newServicePrincipalToken(config, env)
+	if err != nil {
+		return nil, err
+	}
+	spt.SetSender(config.HTTPClient)
+	return autorest.NewBearerAuthorizer(spt), nil
+}
+
+// newServicePrincipalToken creates the token of the authentication mode of the Builder
+func newServicePrincipalToken(config *Builder, env azure.Environment) (*adal.ServicePrincipalToken, error) {
+	resource := env.ResourceManagerEndpoint
+	if config.authMode() == AuthModeManagedIdentity {
+		msiEndpoint, err := adal.GetMSIVMEndpoint()
+		if err != nil {
+			return nil, err
+		}
+		if config.ClientID != "" {
+			return adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(msiEndpoint, resource, config.ClientID)
+		}
+		return adal.NewServicePrincipalTokenFromMSI(msiEndpoint, resource)
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, config.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	switch config.authMode() {
+	case AuthModeClientSecret:
+		return adal.NewServicePrincipalToken(*oauthConfig, config.ClientID, config.ClientSecret, resource)
+	case AuthModeClientCertificate:
+		certificate, privateKey, err := loadCertificate(config.CertificatePath, config.CertificatePassword)
+		if err != nil {
+			return nil, err
+		}
+		return adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, config.ClientID, certificate, privateKey, resource)
+	case AuthModeWorkloadIdentity:
+		return adal.NewServicePrincipalTokenWithSecret(*oauthConfig, config.ClientID, resource, &federatedTokenSecret{path: config.FederatedTokenFile})
+	default:
+		return nil, fmt.Errorf("authentication mode %s not supported", config.authMode())
+	}
+}
+
+// loadCertificate reads the certificate and its RSA private key from a PEM file, or from a PFX file otherwise
+func loadCertificate(path, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading the certificate '%s': %v", path, err)
+	}
+
+	var certificate *x509.Certificate
+	var key interface{}
+	if block, _ := pem.Decode(data); block != nil {
+		certificate, key, err = decodePEM(data)
+	} else {
+		key, certificate, err = pkcs12.Decode(data, password)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding the certificate '%s': %v", path, err)
+	}
+
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("error decoding the certificate '%s': the private key must be a RSA key", path)
+	}
+	return certificate, privateKey, nil
+}
+
+// decodePEM decodes the first certificate and the first private key found in the PEM data
+func decodePEM(data []byte) (certificate *x509.Certificate, key interface{}, err error) {
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			if certificate == nil {
+				if certificate, err = x509.ParseCertificate(block.Bytes); err != nil {
+					return
+				}
+			}
+		case "RSA PRIVATE KEY":
+			if key == nil {
+				if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+					return
+				}
+			}
+		case "PRIVATE KEY":
+			if key == nil {
+				if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+					return
+				}
+			}
+		}
+	}
+	if certificate == nil {
+		return nil, nil, errors.New("no certificate found")
+	}
+	if key == nil {
+		return nil, nil, errors.New("no private key found")
+	}
+	return
+}
+
+// federatedTokenSecret authenticates with a federated token read from a file as client assertion.
+// The file is read on every token refresh since the token gets rotated by the platform
+type federatedTokenSecret struct {
+	path string
+}
+
+// SetAuthenticationValues sets the client assertion of the token request
+func (secret *federatedTokenSecret) SetAuthenticationValues(_ *adal.ServicePrincipalToken, v *url.Values) error {
+	token, err := ioutil.ReadFile(secret.path)
+	if err != nil {
+		return fmt.Errorf("error reading the federated token file '%s': %v", secret.path, err)
+	}
+	v.Set("client_assertion", strings.TrimSpace(string(token)))
+	v.Set("client_assertion_type", clientAssertionType)
+	return nil
+}
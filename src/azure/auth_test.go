@@ -0,0 +1,197 @@
+package azure
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestBuilder_checkAuth(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	tokenFile := writeFile(t, dir, "token", "federated-token")
+
+	testCases := []struct {
+		name     string
+		builder  Builder
+		expected []string
+	}{
+		{"inferred environment", Builder{}, nil},
+		{"inferred client secret", Builder{ClientID: "id", ClientSecret: "secret", TenantID: "tenant"}, nil},
+		{"client secret", Builder{AuthMode: AuthModeClientSecret, ClientID: "id"}, []string{
+			`The "ClientSecret" must be specified when using the "client-secret" authentication mode`,
+			`The "TenantID" must be specified when using the "client-secret" authentication mode`,
+		}},
+		{"client certificate", Builder{AuthMode: AuthModeClientCertificate, TenantID: "tenant", CertificatePath: filepath.Join(dir, "missing.pfx")}, []string{
+			`The "ClientID" must be specified when using the "client-certificate" authentication mode`,
+			fmt.Sprintf(`The certificate "%s" of the "client-certificate" authentication mode is not a readable file`, filepath.Join(dir, "missing.pfx")),
+		}},
+		{"client certificate path required", Builder{AuthMode: AuthModeClientCertificate, ClientID: "id", TenantID: "tenant"}, []string{
+			`The "CertificatePath" must be specified when using the "client-certificate" authentication mode`,
+		}},
+		{"system assigned managed identity", Builder{AuthMode: AuthModeManagedIdentity}, nil},
+		{"user assigned managed identity", Builder{AuthMode: AuthModeManagedIdentity, ClientID: "id"}, nil},
+		{"workload identity", Builder{AuthMode: AuthModeWorkloadIdentity, ClientID: "id", TenantID: "tenant", FederatedTokenFile: tokenFile}, nil},
+		{"workload identity token file", Builder{AuthMode: AuthModeWorkloadIdentity, ClientID: "id", TenantID: "tenant", FederatedTokenFile: dir}, []string{
+			fmt.Sprintf(`The federated token file "%s" of the "workload-identity" authentication mode is not a readable file`, dir),
+		}},
+		{"unknown", Builder{AuthMode: "password"}, []string{
+			`The authentication mode "password" is not supported; use one of client-secret, client-certificate, managed-identity, workload-identity or environment`,
+		}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if errs := test.builder.checkAuth(); !reflect.DeepEqual(errs, test.expected) {
+				t.Errorf("got = %v, want %v", errs, test.expected)
+			}
+		})
+	}
+}
+
+func TestLoadCertificate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key, certificate := generateCertificate(t)
+	pemData := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	c, k, err := loadCertificate(writeFile(t, dir, "cert.pem", pemData), "")
+	if err != nil {
+		t.Fatalf("Expecting the PEM certificate to be loaded. Got err '%v'", err)
+	}
+	if c == nil || k == nil || k.N.Cmp(key.N) != 0 {
+		t.Errorf("Expecting the certificate and its private key to be loaded")
+	}
+
+	if _, _, err := loadCertificate(writeFile(t, dir, "nokey.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))), ""); err == nil {
+		t.Errorf("Expecting an error for a PEM file without private key")
+	}
+	if _, _, err := loadCertificate(writeFile(t, dir, "cert.pfx", "not a pfx"), "password"); err == nil {
+		t.Errorf("Expecting an error for an invalid PFX file")
+	}
+	if _, _, err := loadCertificate(filepath.Join(dir, "missing.pfx"), ""); err == nil {
+		t.Errorf("Expecting an error for a missing file")
+	}
+}
+
+func TestNewServicePrincipalToken(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key, certificate := generateCertificate(t)
+	certFile := writeFile(t, dir, "cert.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))+
+		string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})))
+	tokenFile := writeFile(t, dir, "token", "federated-token\n")
+
+	testCases := []struct {
+		name     string
+		builder  Builder
+		expected map[string]string
+	}{
+		{"client secret", Builder{AuthMode: AuthModeClientSecret, ClientID: "id", ClientSecret: "secret", TenantID: "tenant"},
+			map[string]string{"client_id": "id", "client_secret": "secret", "grant_type": "client_credentials"}},
+		{"client certificate", Builder{AuthMode: AuthModeClientCertificate, ClientID: "id", TenantID: "tenant", CertificatePath: certFile},
+			map[string]string{"client_id": "id", "client_assertion_type": clientAssertionType, "grant_type": "client_credentials"}},
+		{"workload identity", Builder{AuthMode: AuthModeWorkloadIdentity, ClientID: "id", TenantID: "tenant", FederatedTokenFile: tokenFile},
+			map[string]string{"client_id": "id", "client_assertion": "federated-token", "client_assertion_type": clientAssertionType, "grant_type": "client_credentials"}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var form map[string][]string
+			aad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				form = r.PostForm
+				writeJSON(w, http.StatusOK, map[string]string{
+					"access_token": "access-token",
+					"token_type":   "Bearer",
+					"expires_in":   "3600",
+					"expires_on":   fmt.Sprint(time.Now().Add(time.Hour).Unix()),
+					"resource":     r.PostForm.Get("resource"),
+				})
+			}))
+			defer aad.Close()
+
+			env := azure.PublicCloud
+			env.ActiveDirectoryEndpoint = aad.URL + "/"
+			spt, err := newServicePrincipalToken(&test.builder, env)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			spt.SetSender(aad.Client())
+			if err := spt.Refresh(); err != nil {
+				t.Fatalf("Expecting the token to be refreshed. Got err '%v'", err)
+			}
+			for k, v := range test.expected {
+				if got := form[k]; len(got) != 1 || got[0] != v {
+					t.Errorf("Expecting the token request to hold %s=%s. Got %v", k, v, got)
+				}
+			}
+			if spt.OAuthToken() != "access-token" {
+				t.Errorf("Expecting the access token to be read from the token response. Got %s", spt.OAuthToken())
+			}
+		})
+	}
+}
+
+func TestNewServicePrincipalTokenManagedIdentity(t *testing.T) {
+	for _, clientID := range []string{"", "user-assigned-id"} {
+		spt, err := newServicePrincipalToken(&Builder{AuthMode: AuthModeManagedIdentity, ClientID: clientID}, azure.PublicCloud)
+		if err != nil || spt == nil {
+			t.Errorf("Expecting a managed identity token to be created. Got err '%v'", err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "bindman-azure")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return path
+}
+
+func generateCertificate(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bindman"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return key, certificate
+}
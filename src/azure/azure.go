@@ -3,14 +3,13 @@ package azure
 import (
 	"context"
 	"fmt"
-	"github.com/Azure/azure-sdk-for-go/profiles/2019-03-01/dns/mgmt/dns"
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
 	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/Azure/go-autorest/autorest/to"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
@@ -18,28 +17,76 @@ import (
 
 type Builder struct {
 	Zone string
+	// Zones are the zones managed besides Zone, each one optionally held by its own resource group and subscription
+	Zones []ZoneConfig
+	// ZoneType tells if the managed zones are public or private DNS zones; public when empty
+	ZoneType string
 
 	ClientID     string
 	ClientSecret string
 	TenantID     string
 
+	// AuthMode selects how to authenticate against Azure; inferred from the credentials when empty
+	AuthMode string
+	// CertificatePath is the path of the PFX or PEM certificate of the client-certificate auth mode
+	CertificatePath string
+	// CertificatePassword is the password of the PFX certificate
+	CertificatePassword string
+	// FederatedTokenFile is the path of the federated token of the workload-identity auth mode
+	FederatedTokenFile string
+
 	SubscriptionID string
 	ResourceGroup  string
 
+	// Environment is the name of the Azure cloud to use, e.g. AzurePublicCloud, AzureChinaCloud or AzureUSGovernmentCloud
+	Environment string
+	// ResourceManagerEndpoint overrides the Azure Resource Manager base URI of the environment
+	ResourceManagerEndpoint string
+
+	// InstanceID identifies this Bindman instance in the metadata of the record sets it writes; when set, the record sets
+	// written by other instances are taken as foreign
+	InstanceID string
+	// AdoptForeignRecords allows taking over the record sets existing in Azure without the ownership marker of Bindman
+	AdoptForeignRecords bool
+
+	// Retry defines how the requests failing with transient errors are retried
+	Retry RetryPolicy
+
+	// SkipZoneCheck leaves out the check of the managed zones and of the write permission on them at startup
+	SkipZoneCheck bool
+
 	HTTPClient *http.Client
 }
 
 // AzUpdater holds the information necessary to successfully run update requests
 type AzUpdater struct {
 	Builder
-	client *dns.RecordSetsClient
+	// clients holds the client of the record sets of each managed zone, keyed by the zone name
+	clients map[string]recordSets
+	// etags holds the ETag of the last write of each record set, keyed by recordSetKey
+	etags sync.Map
+
+	// statuses holds the result of the last check of each managed zone, keyed by the zone name
+	statuses   map[string]ZoneStatus
+	statusLock sync.RWMutex
 }
 
-// DNSUpdater defines an interface to communicate with DNS Server via update commands
+// DNSUpdater defines an interface to communicate with DNS Server via update commands.
+// The calls give up as soon as ctx is done
 type DNSUpdater interface {
-	RemoveRR(name, recordType string) (err error)
-	AddRR(record hookTypes.DNSRecord, ttl time.Duration) (err error)
-	UpdateRR(record hookTypes.DNSRecord, ttl time.Duration) (err error)
+	RemoveRR(ctx context.Context, name, recordType, value string) (err error)
+	AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error)
+	UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error)
+	// SetRR replaces all the values and the TTL of the record set in a single write
+	SetRR(ctx context.Context, name, recordType string, values []string, ttl time.Duration) (err error)
+}
+
+// ZoneRouter is implemented by the DNSUpdaters managing many zones, telling which zone holds each record
+type ZoneRouter interface {
+	// ZoneOf returns the managed zone the record name belongs to; false when it belongs to none
+	ZoneOf(name string) (string, bool)
+	// ManagedZones returns the names of all the managed zones
+	ManagedZones() []string
 }
 
 // New constructs a new AzUpdater instance from environment variables
@@ -53,122 +100,288 @@ func (b *Builder) New() (*AzUpdater, error) {
 		b.HTTPClient = http.DefaultClient
 	}
 
-	authorizer, err := getAuthorizer(b)
+	env, err := b.environment()
+	if err != nil {
+		return nil, err
+	}
+
+	authorizer, err := getAuthorizer(b, env)
 	if err != nil {
 		return nil, err
 	}
 
-	// just one instance
-	rsc := dns.NewRecordSetsClient(b.SubscriptionID)
-	rsc.Authorizer = authorizer
-	result.client = &rsc
+	// just one instance per zone
+	result.clients = newRecordSetsClients(b, env, authorizer)
 
 	return result, nil
 }
 
-func getAuthorizer(config *Builder) (autorest.Authorizer, error) {
-	if config.ClientID != "" && config.ClientSecret != "" && config.TenantID != "" {
-		oauthConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, config.TenantID)
-		if err != nil {
-			return nil, err
-		}
+// newRecordSetsClients creates the clients of the record sets of all the managed zones
+func newRecordSetsClients(b *Builder, env azure.Environment, authorizer autorest.Authorizer) map[string]recordSets {
+	clients := map[string]recordSets{}
+	for _, zone := range b.zones() {
+		clients[zone.Name] = newRecordSetsClient(b, zone, env, authorizer)
+	}
+	return clients
+}
 
-		spt, err := adal.NewServicePrincipalToken(*oauthConfig, config.ClientID, config.ClientSecret, azure.PublicCloud.ResourceManagerEndpoint)
-		if err != nil {
-			return nil, err
-		}
+// zone returns the managed zone the name belongs to along with the client of its record sets
+func (azu *AzUpdater) zone(name string) (ZoneConfig, recordSets, error) {
+	zone, err := azu.checkName(name)
+	if err != nil {
+		return zone, nil, err
+	}
+	return zone, azu.clients[zone.Name], nil
+}
 
-		spt.SetSender(config.HTTPClient)
-		return autorest.NewBearerAuthorizer(spt), nil
+// environment returns the Azure cloud environment named by the Builder; AzurePublicCloud when none is set
+func (b *Builder) environment() (azure.Environment, error) {
+	if strings.TrimSpace(b.Environment) == "" {
+		return azure.PublicCloud, nil
 	}
-	return auth.NewAuthorizerFromEnvironment()
+	return azure.EnvironmentFromName(b.Environment)
 }
 
-// RemoveRR removes a Resource Record
-func (azu *AzUpdater) RemoveRR(name, recordType string) (err error) {
-	err = azu.checkName(name)
-	relative := toRelativeRecord(name, ToFqdn(azu.Zone))
-	_, err = azu.client.Delete(context.Background(), azu.ResourceGroup, azu.Zone, relative, dns.RecordType(recordType), "")
+// resourceManagerEndpoint returns the base URI of the Azure Resource Manager to send the requests to
+func (b *Builder) resourceManagerEndpoint(env azure.Environment) string {
+	if b.ResourceManagerEndpoint != "" {
+		return b.ResourceManagerEndpoint
+	}
+	return env.ResourceManagerEndpoint
+}
+
+// RemoveRR removes a value from a Resource Record set.
+// The whole record set is removed when value is empty or when it is the last value of the set
+func (azu *AzUpdater) RemoveRR(ctx context.Context, name, recordType, value string) (err error) {
+	zone, client, err := azu.zone(name)
 	if err != nil {
-		err = fmt.Errorf("azure: %v", err)
 		return
 	}
+	ctx = azu.Retry.withRetries(ctx)
+	relative := toRelativeRecord(name, ToFqdn(zone.Name))
+	key := recordSetKey(zone.Name, relative, recordType)
+	ifMatch, tracked := azu.trackedETag(key)
+	// the record set is read unless Bindman wrote it and the whole set goes away
+	if value != "" || !tracked {
+		if value != "" {
+			if value, err = normalizeValue(recordType, value); err != nil {
+				return
+			}
+		}
+		var current *dns.RecordSet
+		current, err = getRecordSet(ctx, client, relative, recordType)
+		if err != nil {
+			return
+		}
+		if current == nil {
+			return
+		}
+		if err = azu.checkOwnership(ctx, key, name, recordType, current); err != nil {
+			return
+		}
+		if value != "" {
+			values := removeValue(recordSetValues(recordType, current.RecordSetProperties), value)
+			if len(values) > 0 {
+				return azu.write(ctx, client, key, name, relative, recordType, values, to.Int64(current.TTL), current)
+			}
+		}
+		if ifMatch, _, err = azu.preconditions(ctx, key, name, recordType, current); err != nil {
+			return
+		}
+	}
+	err = client.delete(ctx, relative, recordType, ifMatch)
+	if err != nil {
+		return wrapError(name, recordType, err)
+	}
+	azu.etags.Delete(key)
 	return
 }
 
-// AddRR adds a Resource Record
-func (azu *AzUpdater) AddRR(record hookTypes.DNSRecord, ttl time.Duration) (err error) {
-	return azu.createOrUpdate(record, ttl)
+// AddRR adds a value to a Resource Record set, keeping the values already there
+func (azu *AzUpdater) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error) {
+	if record.Value, err = normalizeValue(record.Type, record.Value); err != nil {
+		return
+	}
+	return azu.createOrUpdate(ctx, record, ttl, func(values []string) []string {
+		return AddValue(record.Type, values, record.Value)
+	})
 }
 
-// UpdateRR updates a DNS Resource Record
-func (azu *AzUpdater) UpdateRR(record hookTypes.DNSRecord, ttl time.Duration) (err error) {
-	return azu.createOrUpdate(record, ttl)
+// UpdateRR updates a DNS Resource Record set replacing all its values by the record value
+func (azu *AzUpdater) UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error) {
+	if record.Value, err = normalizeValue(record.Type, record.Value); err != nil {
+		return
+	}
+	return azu.createOrUpdate(ctx, record, ttl, func([]string) []string {
+		return []string{record.Value}
+	})
 }
 
-func (azu *AzUpdater) createOrUpdate(record hookTypes.DNSRecord, ttl time.Duration) (err error) {
-	err = azu.checkName(record.Name)
+// SetRR replaces all the values and the TTL of a DNS Resource Record set in a single write
+func (azu *AzUpdater) SetRR(ctx context.Context, name, recordType string, values []string, ttl time.Duration) (err error) {
+	if len(values) == 0 {
+		return hookTypes.BadRequestError(fmt.Sprintf("no value to write to the record set '%s' of type '%s'", name, recordType), nil)
+	}
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		if value, err = normalizeValue(recordType, value); err != nil {
+			return
+		}
+		normalized = append(normalized, value)
+	}
+	return azu.createOrUpdate(ctx, hookTypes.DNSRecord{Name: name, Type: recordType, Value: normalized[0]}, ttl, func([]string) []string {
+		return normalized
+	})
+}
+
+// createOrUpdate writes the record set of the record with the values computed from the ones currently in Azure
+func (azu *AzUpdater) createOrUpdate(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration, merge func(values []string) []string) (err error) {
+	zone, client, err := azu.zone(record.Name)
 	if err != nil {
 		return
 	}
-	relative := toRelativeRecord(record.Name, ToFqdn(azu.Zone))
-	recordSetProperties, err := recordSetProperties(record)
+	if isAlias(record.Type, record.Value) && !client.supportsAliases() {
+		return hookTypes.BadRequestError(fmt.Sprintf("the value '%s' is not allowed: alias records are not supported by %s zones", record.Value, azu.zoneType()), nil)
+	}
+	ctx = azu.Retry.withRetries(ctx)
+	relative := toRelativeRecord(record.Name, ToFqdn(zone.Name))
+	current, err := getRecordSet(ctx, client, relative, record.Type)
+	if err != nil {
+		return
+	}
+	key := recordSetKey(zone.Name, relative, record.Type)
+	if err = azu.checkOwnership(ctx, key, record.Name, record.Type, current); err != nil {
+		return
+	}
+	var values []string
+	if current != nil {
+		values = recordSetValues(record.Type, current.RecordSetProperties)
+	}
+	return azu.write(ctx, client, key, record.Name, relative, record.Type, merge(values), int64(ttl.Seconds()), current)
+}
+
+// write replaces the record set identified by the relative name and type, failing with a ConflictError
+// when the current record set was changed in the meantime
+func (azu *AzUpdater) write(ctx context.Context, client recordSets, key, name, relative, recordType string, values []string, ttl int64, current *dns.RecordSet) (err error) {
+	recordSetProperties, err := recordSetProperties(recordType, values)
 	if err != nil {
 		err = fmt.Errorf("azure: %v", err)
 		return
 	}
-	recordSetProperties.TTL = to.Int64Ptr(int64(ttl.Seconds()))
+	recordSetProperties.TTL = to.Int64Ptr(ttl)
+	recordSetProperties.Metadata = azu.stamp(current, time.Now())
 	rec := dns.RecordSet{
 		Name:                &relative,
 		RecordSetProperties: recordSetProperties,
 	}
 
-	_, err = azu.client.CreateOrUpdate(context.Background(), azu.ResourceGroup, azu.Zone, relative, dns.RecordType(record.Type), rec, "", "")
+	ifMatch, ifNoneMatch, err := azu.preconditions(ctx, key, name, recordType, current)
 	if err != nil {
-		err = fmt.Errorf("azure: %v", err)
 		return
 	}
+	result, err := client.createOrUpdate(ctx, relative, recordType, rec, ifMatch, ifNoneMatch)
+	if err != nil {
+		return wrapError(name, recordType, err)
+	}
+	azu.etags.Store(key, to.String(result.Etag))
 	return
 }
 
-func recordSetProperties(record hookTypes.DNSRecord) (*dns.RecordSetProperties, error) {
-	var properties *dns.RecordSetProperties
-	switch record.Type {
-	case "A":
-		properties = &dns.RecordSetProperties{
-			ARecords: &[]dns.ARecord{{Ipv4Address: &record.Value}},
-		}
-	case "AAAA":
-		properties = &dns.RecordSetProperties{
-			AaaaRecords: &[]dns.AaaaRecord{{Ipv6Address: &record.Value}},
-		}
-	case "CNAME":
-		properties = &dns.RecordSetProperties{
-			CnameRecord: &dns.CnameRecord{Cname: &record.Value},
-		}
-	case "MX":
-		properties = &dns.RecordSetProperties{
-			MxRecords: &[]dns.MxRecord{{Exchange: &record.Value}},
-		}
-	case "NS":
-		properties = &dns.RecordSetProperties{
-			NsRecords: &[]dns.NsRecord{{Nsdname: &record.Value}},
+// preconditions returns the If-Match and If-None-Match values protecting the current record set from concurrent changes.
+// The ETag of the current record set, the one the write was computed from, is always matched, so writes interleaving
+// with it fail. The ETag of the last write tells apart the changes made by someone else since then, unless ctx was made
+// by WithOverwrite, failing with a ConflictError when it differs from the current one. Once the ETag is lost, e.g. after
+// a restart, the current record set must hold the values set by WithStoredValues instead
+func (azu *AzUpdater) preconditions(ctx context.Context, key, name, recordType string, current *dns.RecordSet) (ifMatch, ifNoneMatch string, err error) {
+	if current == nil {
+		return "", "*", nil
+	}
+	etag := to.String(current.Etag)
+	if overwriting(ctx) {
+		return etag, "", nil
+	}
+	if tracked, ok := azu.trackedETag(key); ok {
+		if tracked != etag {
+			return "", "", &ConflictError{Name: name, Type: recordType, Err: fmt.Errorf("found the ETag %s instead of %s of the last write", etag, tracked)}
 		}
-	case "PTR":
-		properties = &dns.RecordSetProperties{
-			PtrRecords: &[]dns.PtrRecord{{Ptrdname: &record.Value}},
+		return etag, "", nil
+	}
+	if stored, ok := storedValues(ctx); ok {
+		if values := recordSetValues(recordType, current.RecordSetProperties); !SameValues(recordType, values, stored) {
+			return "", "", &ConflictError{Name: name, Type: recordType, Err: fmt.Errorf("found the values %v instead of %v", values, stored)}
 		}
-	case "TXT":
-		properties = &dns.RecordSetProperties{
-			TxtRecords: &[]dns.TxtRecord{{Value: &[]string{record.Value}}},
+	}
+	return etag, "", nil
+}
+
+// overwriteKey is the key of the context value set by WithOverwrite
+type overwriteKey struct{}
+
+// WithOverwrite returns a context making the DNSUpdater replace the record sets changed by someone else since Bindman
+// last wrote them, e.g. to repair them. Record sets changed between their read and their write are still protected
+func WithOverwrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overwriteKey{}, true)
+}
+
+// overwriting tells if ctx was made by WithOverwrite
+func overwriting(ctx context.Context) bool {
+	overwrite, _ := ctx.Value(overwriteKey{}).(bool)
+	return overwrite
+}
+
+// storedValuesKey is the key of the context value set by WithStoredValues
+type storedValuesKey struct{}
+
+// WithStoredValues returns a context telling the DNSUpdater the values Bindman last wrote to the record set, as kept by
+// its local storage, so that the changes made by someone else are detected even when the ETag of the last write is lost,
+// e.g. after a restart. No values tell nothing
+func WithStoredValues(ctx context.Context, values []string) context.Context {
+	if values == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, storedValuesKey{}, values)
+}
+
+// storedValues returns the values set by WithStoredValues; false when none were set
+func storedValues(ctx context.Context) ([]string, bool) {
+	values, ok := ctx.Value(storedValuesKey{}).([]string)
+	return values, ok
+}
+
+// trackedETag returns the ETag of the last write of the record set
+func (azu *AzUpdater) trackedETag(key string) (string, bool) {
+	etag, ok := azu.etags.Load(key)
+	if !ok || etag.(string) == "" {
+		return "", false
+	}
+	return etag.(string), true
+}
+
+// getRecordSet retrieves the record set identified by the relative name and type; nil when it does not exist
+func getRecordSet(ctx context.Context, client recordSets, relative, recordType string) (*dns.RecordSet, error) {
+	if err := client.checkRecordType(recordType); err != nil {
+		return nil, fmt.Errorf("azure: %v", err)
+	}
+	rs, err := client.get(ctx, relative, recordType)
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return nil, nil
 		}
-	default:
-		return nil, fmt.Errorf("record type %s not supported", record.Type)
+		return nil, fmt.Errorf("azure: %v", err)
 	}
-	return properties, nil
+	return &rs, nil
 }
 
-// Returns the relative record to the domain
+// recordSetKey identifies a record set by its zone, relative name and type
+func recordSetKey(zone, relative, recordType string) string {
+	return UnFqdn(zone) + "/" + relative + "/" + recordType
+}
+
+// Returns the relative record to the domain; "@" for the zone apex
 func toRelativeRecord(domain, zone string) string {
-	return UnFqdn(strings.TrimSuffix(domain, zone))
+	domain, zone = UnFqdn(domain), UnFqdn(zone)
+	if domain == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(domain, "."+zone)
 }
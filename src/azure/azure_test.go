@@ -0,0 +1,535 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// fakeARM is a stand-in for the Azure Resource Manager DNS API keeping the record sets in memory
+type fakeARM struct {
+	sync.Mutex
+	recordSets map[string]dns.RecordSet
+	requests   []string
+	version    int
+	// zones is the path segment of the zone resource type, e.g. dnsZones or privateDnsZones
+	zones string
+	// afterGet is called once a GET request is answered, to simulate changes made by someone else
+	afterGet func()
+	// nameServers are the name servers of the zone; the zone is taken as missing when nil
+	nameServers []string
+}
+
+func newFakeARM() *fakeARM {
+	return &fakeARM{recordSets: map[string]dns.RecordSet{}, zones: "dnsZones", nameServers: []string{"ns1-01.azure-dns.com.", "ns2-01.azure-dns.net."}}
+}
+
+func newFakePrivateARM() *fakeARM {
+	return &fakeARM{recordSets: map[string]dns.RecordSet{}, zones: "privateDnsZones", nameServers: []string{}}
+}
+
+func (f *fakeARM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	afterGet := f.afterGet
+	f.serve(w, r)
+	f.Unlock()
+	if r.Method == http.MethodGet && afterGet != nil {
+		afterGet()
+	}
+}
+
+func (f *fakeARM) serve(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if r.Method == http.MethodGet && r.URL.Path == f.zonePath() && f.nameServers != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": "test.com", "location": "global", "properties": map[string]interface{}{"nameServers": f.nameServers}})
+		return
+	}
+	if r.Method == http.MethodGet && (r.URL.Path == f.zonePath()+"/recordsets" || r.URL.Path == f.zonePath()+"/ALL") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": f.list()})
+		return
+	}
+
+	rs, found := f.recordSets[r.URL.Path]
+	if !checkPreconditions(r, rs, found) {
+		writeCloudError(w, http.StatusPreconditionFailed, "PreconditionFailed", "The condition specified using HTTP conditional header(s) is not met")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !found {
+			writeCloudError(w, http.StatusNotFound, "NotFound", "The resource record was not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, rs)
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		var rs dns.RecordSet
+		if err := json.Unmarshal(body, &rs); err != nil {
+			writeCloudError(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		f.store(r.URL.Path, rs)
+		writeJSON(w, http.StatusOK, f.recordSets[r.URL.Path])
+	case http.MethodDelete:
+		delete(f.recordSets, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// store saves the record set with a new ETag
+func (f *fakeARM) store(path string, rs dns.RecordSet) {
+	f.version++
+	rs.Etag = to.StringPtr(fmt.Sprintf("etag-%d", f.version))
+	f.recordSets[path] = rs
+}
+
+// list returns all the record sets of the zone, sorted by path, along with their read-only name and type
+func (f *fakeARM) list() []map[string]interface{} {
+	var paths []string
+	for path := range f.recordSets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	result := []map[string]interface{}{}
+	for _, path := range paths {
+		segments := strings.Split(strings.TrimPrefix(path, f.zonePath()+"/"), "/")
+		rs := f.recordSets[path]
+		result = append(result, map[string]interface{}{
+			"name":       segments[1],
+			"type":       "Microsoft.Network/" + f.zones + "/" + segments[0],
+			"etag":       rs.Etag,
+			"properties": rs.RecordSetProperties,
+		})
+	}
+	return result
+}
+
+// modify changes the record set as someone else would do
+func (f *fakeARM) modify(relative, recordType string, values []string) {
+	f.Lock()
+	defer f.Unlock()
+	properties, _ := recordSetProperties(recordType, values)
+	properties.TTL = to.Int64Ptr(300)
+	f.store(f.recordSetPath(relative, recordType), dns.RecordSet{Name: &relative, RecordSetProperties: properties})
+}
+
+// edit changes the values of the record set as someone else would do in the Azure portal, keeping its TTL and metadata
+func (f *fakeARM) edit(relative, recordType string, values []string) {
+	f.Lock()
+	defer f.Unlock()
+	path := f.recordSetPath(relative, recordType)
+	rs := f.recordSets[path]
+	properties, _ := recordSetProperties(recordType, values)
+	properties.TTL, properties.Metadata = rs.TTL, rs.Metadata
+	f.store(path, dns.RecordSet{Name: &relative, RecordSetProperties: properties})
+}
+
+// checkPreconditions tells if the If-Match and If-None-Match headers of the request are satisfied
+func checkPreconditions(r *http.Request, rs dns.RecordSet, found bool) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!found || to.String(rs.Etag) != ifMatch) {
+		return false
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch == "*" && found {
+		return false
+	}
+	return true
+}
+
+// recordSet returns the record set stored for the relative name and type
+func (f *fakeARM) recordSet(relative, recordType string) (dns.RecordSet, bool) {
+	f.Lock()
+	defer f.Unlock()
+	rs, found := f.recordSets[f.recordSetPath(relative, recordType)]
+	return rs, found
+}
+
+func (f *fakeARM) recordSetPath(relative, recordType string) string {
+	return f.zonePath() + "/" + recordType + "/" + relative
+}
+
+func (f *fakeARM) zonePath() string {
+	return "/subscriptions/sub-value/resourceGroups/rg-value/providers/Microsoft.Network/" + f.zones + "/test.com"
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeCloudError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{"error": map[string]string{"code": code, "message": message}})
+}
+
+// newTestUpdater creates an AzUpdater sending its requests to the server
+func newTestUpdater(t *testing.T, server *httptest.Server) *AzUpdater {
+	t.Helper()
+	return newTestUpdaterOfZoneType(t, server, PublicZone)
+}
+
+// newTestUpdaterOfZoneType creates an AzUpdater of a zone of the given type sending its requests to the server
+func newTestUpdaterOfZoneType(t *testing.T, server *httptest.Server, zoneType string) *AzUpdater {
+	t.Helper()
+	b := &Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com", ZoneType: zoneType, ResourceManagerEndpoint: server.URL}
+	result, err := newUpdaterWithAuthorizer(b, autorest.NullAuthorizer{})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return result
+}
+
+func newUpdaterWithAuthorizer(b *Builder, authorizer autorest.Authorizer) (*AzUpdater, error) {
+	env, err := b.environment()
+	if err != nil {
+		return nil, err
+	}
+	return &AzUpdater{Builder: *b, clients: newRecordSetsClients(b, env, authorizer)}, nil
+}
+
+func TestAzUpdater_AddAndRemoveRR(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}, time.Minute); err != nil {
+			t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+		}
+	}
+	rs, found := arm.recordSet("www", "A")
+	if !found {
+		t.Fatalf("Expecting the record set to be written to the resource manager endpoint. Requests: %v", arm.requests)
+	}
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expecting the values to be merged. Got %v", got)
+	}
+	if *rs.TTL != 60 {
+		t.Errorf("Expecting the TTL to be 60 seconds. Got %v", *rs.TTL)
+	}
+
+	if err := azu.RemoveRR(context.Background(), "www.test.com", "A", "10.0.0.1"); err != nil {
+		t.Fatalf("Expecting RemoveRR to succeed. Got err '%v'", err)
+	}
+	rs, _ = arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.2"}) {
+		t.Errorf("Expecting only the removed value to be deleted. Got %v", got)
+	}
+
+	if err := azu.RemoveRR(context.Background(), "www.test.com", "A", "10.0.0.2"); err != nil {
+		t.Fatalf("Expecting RemoveRR to succeed. Got err '%v'", err)
+	}
+	if _, found := arm.recordSet("www", "A"); found {
+		t.Errorf("Expecting the record set to be deleted along with its last value")
+	}
+}
+
+func TestAzUpdater_UpdateRR(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}, time.Minute); err != nil {
+			t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+		}
+	}
+	if err := azu.UpdateRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.3"}, time.Minute); err != nil {
+		t.Fatalf("Expecting UpdateRR to succeed. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.3"}) {
+		t.Errorf("Expecting the values to be replaced. Got %v", got)
+	}
+
+	err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.other.com", Type: "A", Value: "10.0.0.1"}, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("Expecting names outside the zone to be rejected. Got err '%v'", err)
+	}
+}
+
+func TestAzUpdater_SetRR(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+	}
+	arm.requests = nil
+	if err := azu.SetRR(context.Background(), "www.test.com", "A", []string{"10.0.0.2", "10.0.0.3"}, time.Hour); err != nil {
+		t.Fatalf("Expecting SetRR to succeed. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.2", "10.0.0.3"}) || to.Int64(rs.TTL) != 3600 {
+		t.Errorf("Expecting the values and the TTL to be replaced. Got %v with TTL %v", got, to.Int64(rs.TTL))
+	}
+	puts := 0
+	for _, request := range arm.requests {
+		if strings.HasPrefix(request, http.MethodPut) {
+			puts++
+		}
+	}
+	if puts != 1 {
+		t.Errorf("Expecting the record set to be written at once. Got requests %v", arm.requests)
+	}
+
+	if err := azu.SetRR(context.Background(), "mail.test.com", "MX", []string{"10 mail.test.com", "mail.test.com"}, time.Hour); err == nil {
+		t.Errorf("Expecting SetRR to reject invalid values")
+	}
+	if err := azu.SetRR(context.Background(), "www.test.com", "A", nil, time.Hour); err == nil {
+		t.Errorf("Expecting SetRR to reject an empty record set")
+	}
+}
+
+func TestAzUpdater_ConflictOnChangesMadeBySomeoneElse(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+	record := hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}
+
+	if err := azu.AddRR(context.Background(), record, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+	}
+	arm.modify("www", "A", []string{"10.0.0.9"})
+
+	err := azu.UpdateRR(context.Background(), record, time.Minute)
+	if !IsConflict(err) {
+		t.Errorf("Expecting UpdateRR to fail with a conflict. Got err '%v'", err)
+	}
+	if err := azu.RemoveRR(context.Background(), "www.test.com", "A", ""); !IsConflict(err) {
+		t.Errorf("Expecting RemoveRR to fail with a conflict. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.9"}) {
+		t.Errorf("Expecting the changes made by someone else to be kept. Got %v", got)
+	}
+}
+
+func TestAzUpdater_ConflictAfterRestart(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	record := hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}
+
+	if err := newTestUpdater(t, server).AddRR(context.Background(), record, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+	}
+	arm.edit("www", "A", []string{"10.0.0.9"})
+
+	// the ETag of the last write is lost, the stored values telling the change apart
+	restarted := newTestUpdater(t, server)
+	ctx := WithStoredValues(context.Background(), []string{"10.0.0.1"})
+	if err := restarted.UpdateRR(ctx, hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}, time.Minute); !IsConflict(err) {
+		t.Errorf("Expecting UpdateRR to fail with a conflict. Got err '%v'", err)
+	}
+	if err := restarted.RemoveRR(ctx, "www.test.com", "A", ""); !IsConflict(err) {
+		t.Errorf("Expecting RemoveRR to fail with a conflict. Got err '%v'", err)
+	}
+	if err := restarted.UpdateRR(WithOverwrite(ctx), record, time.Minute); err != nil {
+		t.Errorf("Expecting UpdateRR to overwrite the change when asked to. Got err '%v'", err)
+	}
+
+	restarted = newTestUpdater(t, server)
+	if err := restarted.AddRR(ctx, hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed when the record set holds the stored values. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expecting the value to be added. Got %v", got)
+	}
+}
+
+func TestAzUpdater_ConflictOnConcurrentCreation(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	arm.afterGet = func() {
+		arm.afterGet = nil
+		arm.modify("www", "A", []string{"10.0.0.9"})
+	}
+	err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute)
+	if !IsConflict(err) {
+		t.Errorf("Expecting AddRR to fail with a conflict when the record set is created in the meantime. Got err '%v'", err)
+	}
+}
+
+func TestAzUpdater_ConflictOnInterleavedWrites(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+	if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	// another write of the same updater lands between the read and the write of the value
+	arm.afterGet = func() {
+		arm.afterGet = nil
+		if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}, time.Minute); err != nil {
+			t.Errorf("Expecting the interleaved AddRR to succeed. Got err '%v'", err)
+		}
+	}
+	err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.3"}, time.Minute)
+	if !IsConflict(err) {
+		t.Errorf("Expecting AddRR to fail with a conflict when the record set is written in the meantime. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expecting the interleaved value to be kept. Got %v", got)
+	}
+}
+
+func TestAzUpdater_ForeignRecords(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+	record := hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}
+
+	// a record set created by hand is left untouched
+	arm.modify("www", "A", []string{"10.0.0.9"})
+	if err := azu.AddRR(context.Background(), record, time.Minute); !IsForeign(err) {
+		t.Errorf("Expecting AddRR to refuse a foreign record set. Got err '%v'", err)
+	}
+	if err := azu.RemoveRR(context.Background(), "www.test.com", "A", ""); !IsForeign(err) {
+		t.Errorf("Expecting RemoveRR to refuse a foreign record set. Got err '%v'", err)
+	}
+	if _, found := arm.recordSet("www", "A"); !found {
+		t.Fatalf("Expecting the foreign record set to be kept")
+	}
+
+	azu.AdoptForeignRecords = true
+	if err := azu.AddRR(context.Background(), record, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to adopt the foreign record set. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.9", "10.0.0.1"}) {
+		t.Errorf("Expecting the values of the adopted record set to be kept. Got %v", got)
+	}
+	if metadataValue(rs.Metadata, MetadataManagedBy) != "bindman" || metadataValue(rs.Metadata, MetadataCreatedAt) == "" {
+		t.Errorf("Expecting the adopted record set to be stamped. Got %v", rs.Metadata)
+	}
+
+	// the ownership marker is enough once the ETags are lost, e.g. after a restart
+	restarted := newTestUpdater(t, server)
+	if err := restarted.UpdateRR(context.Background(), record, time.Minute); err != nil {
+		t.Fatalf("Expecting UpdateRR to succeed. Got err '%v'", err)
+	}
+	if err := restarted.RemoveRR(context.Background(), "www.test.com", "A", ""); err != nil {
+		t.Fatalf("Expecting RemoveRR to succeed. Got err '%v'", err)
+	}
+	if _, found := arm.recordSet("www", "A"); found {
+		t.Errorf("Expecting the record set to be removed")
+	}
+}
+
+func TestAzUpdater_TakesOverStoredRecordSets(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+	azu.InstanceID = "blue"
+
+	// written by an earlier Bindman, before the ownership marker existed
+	arm.modify("www", "A", []string{"10.0.0.1"})
+	record := hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}
+	if err := azu.AddRR(WithStoredValues(context.Background(), []string{"10.0.0.9"}), record, time.Minute); !IsForeign(err) {
+		t.Errorf("Expecting AddRR to refuse a record set holding other values than the stored ones. Got err '%v'", err)
+	}
+	if err := azu.AddRR(WithStoredValues(context.Background(), []string{"10.0.0.1"}), record, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to take over the record set holding the stored values. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if metadataValue(rs.Metadata, MetadataManagedBy) != "bindman" || metadataValue(rs.Metadata, MetadataInstance) != "blue" {
+		t.Errorf("Expecting the record set taken over to be stamped. Got %v", rs.Metadata)
+	}
+
+	// the record sets of other instances are foreign whatever their values
+	other := newTestUpdater(t, server)
+	other.InstanceID = "green"
+	if err := other.RemoveRR(WithStoredValues(context.Background(), []string{"10.0.0.1", "10.0.0.2"}), "www.test.com", "A", ""); !IsForeign(err) {
+		t.Errorf("Expecting RemoveRR to refuse a record set of another instance. Got err '%v'", err)
+	}
+}
+
+func TestAzUpdater_StampsRecordSets(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+	azu.InstanceID = "blue"
+	record := hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}
+
+	if err := azu.AddRR(context.Background(), record, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	createdAt := metadataValue(rs.Metadata, MetadataCreatedAt)
+	if metadataValue(rs.Metadata, MetadataManagedBy) != "bindman" || metadataValue(rs.Metadata, MetadataInstance) != "blue" ||
+		createdAt == "" || metadataValue(rs.Metadata, MetadataUpdatedAt) != createdAt {
+		t.Errorf("Expecting the record set to be stamped with the ownership marker. Got %v", rs.Metadata)
+	}
+
+	time.Sleep(time.Second)
+	if err := azu.UpdateRR(context.Background(), record, time.Minute); err != nil {
+		t.Fatalf("Expecting UpdateRR to succeed. Got err '%v'", err)
+	}
+	rs, _ = arm.recordSet("www", "A")
+	if metadataValue(rs.Metadata, MetadataCreatedAt) != createdAt || metadataValue(rs.Metadata, MetadataUpdatedAt) == createdAt {
+		t.Errorf("Expecting only the update time to change. Got %v", rs.Metadata)
+	}
+
+	// the record sets of other instances are foreign
+	other := newTestUpdater(t, server)
+	other.InstanceID = "green"
+	if err := other.RemoveRR(context.Background(), "www.test.com", "A", ""); !IsForeign(err) {
+		t.Errorf("Expecting RemoveRR to refuse a record set of another instance. Got err '%v'", err)
+	}
+}
+
+func TestAzUpdater_GivesUpWhenContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	azu := newTestUpdater(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := azu.AddRR(ctx, hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute)
+	if err == nil {
+		t.Errorf("Expecting AddRR to fail once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expecting AddRR to give up right when the context is done. Took %v", elapsed)
+	}
+}
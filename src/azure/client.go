@@ -0,0 +1,106 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+const (
+	// PublicZone is the type of the Azure DNS zones resolved from the Internet
+	PublicZone = "public"
+	// PrivateZone is the type of the Azure Private DNS zones resolved from the linked virtual networks
+	PrivateZone = "private"
+)
+
+// recordSets abstracts the record sets API of a zone.
+// The record sets of both public and private zones are handled as the ones of the public DNS API
+type recordSets interface {
+	get(ctx context.Context, relative, recordType string) (dns.RecordSet, error)
+	createOrUpdate(ctx context.Context, relative, recordType string, rs dns.RecordSet, ifMatch, ifNoneMatch string) (dns.RecordSet, error)
+	delete(ctx context.Context, relative, recordType, ifMatch string) error
+	// list reads all the record sets of the zone
+	list(ctx context.Context) ([]dns.RecordSet, error)
+	// getZone reads the zone, returning the name servers it is delegated to; none for private zones
+	getZone(ctx context.Context) (nameServers []string, err error)
+	// checkRecordType checks if record sets of the type can be written to the zone
+	checkRecordType(recordType string) error
+	// supportsAliases tells if record sets may point to Azure resources
+	supportsAliases() bool
+}
+
+// zoneType returns the type of the zone named by the Builder; PublicZone when none is set
+func (b *Builder) zoneType() string {
+	if b.ZoneType == "" {
+		return PublicZone
+	}
+	return b.ZoneType
+}
+
+// newRecordSetsClient creates the client of the record sets API of the zone matching the zone type
+func newRecordSetsClient(b *Builder, zone ZoneConfig, env azure.Environment, authorizer autorest.Authorizer) recordSets {
+	if b.zoneType() == PrivateZone {
+		return newPrivateRecordSets(b, zone, env, authorizer)
+	}
+	client := dns.NewRecordSetsClientWithBaseURI(b.resourceManagerEndpoint(env), zone.SubscriptionID)
+	client.Authorizer = authorizer
+	zones := dns.NewZonesClientWithBaseURI(b.resourceManagerEndpoint(env), zone.SubscriptionID)
+	zones.Authorizer = authorizer
+	return &publicRecordSets{client: client, zones: zones, resourceGroup: zone.ResourceGroup, zone: UnFqdn(zone.Name)}
+}
+
+// publicRecordSets handles the record sets of a public Azure DNS zone
+type publicRecordSets struct {
+	client        dns.RecordSetsClient
+	zones         dns.ZonesClient
+	resourceGroup string
+	zone          string
+}
+
+func (p *publicRecordSets) get(ctx context.Context, relative, recordType string) (dns.RecordSet, error) {
+	return p.client.Get(ctx, p.resourceGroup, p.zone, relative, dns.RecordType(recordType))
+}
+
+func (p *publicRecordSets) createOrUpdate(ctx context.Context, relative, recordType string, rs dns.RecordSet, ifMatch, ifNoneMatch string) (dns.RecordSet, error) {
+	return p.client.CreateOrUpdate(ctx, p.resourceGroup, p.zone, relative, dns.RecordType(recordType), rs, ifMatch, ifNoneMatch)
+}
+
+func (p *publicRecordSets) delete(ctx context.Context, relative, recordType, ifMatch string) error {
+	_, err := p.client.Delete(ctx, p.resourceGroup, p.zone, relative, dns.RecordType(recordType), ifMatch)
+	return err
+}
+
+func (p *publicRecordSets) list(ctx context.Context) (result []dns.RecordSet, err error) {
+	iter, err := p.client.ListByDNSZoneComplete(ctx, p.resourceGroup, p.zone, nil, "")
+	for ; err == nil && iter.NotDone(); err = iter.NextWithContext(ctx) {
+		result = append(result, iter.Value())
+	}
+	return
+}
+
+func (p *publicRecordSets) getZone(ctx context.Context) ([]string, error) {
+	zone, err := p.zones.Get(ctx, p.resourceGroup, p.zone)
+	if err != nil || zone.ZoneProperties == nil || zone.NameServers == nil {
+		return nil, err
+	}
+	return *zone.NameServers, nil
+}
+
+func (p *publicRecordSets) checkRecordType(recordType string) error {
+	return checkRecordType(recordType)
+}
+
+func (p *publicRecordSets) supportsAliases() bool {
+	return true
+}
+
+// checkZoneType checks if the zone type is known
+func checkZoneType(zoneType string) error {
+	if zoneType != PublicZone && zoneType != PrivateZone {
+		return fmt.Errorf("zone type %s not supported", zoneType)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// ConflictError reports a record set changed in Azure by someone else since Bindman last read or wrote it
+type ConflictError struct {
+	Name string
+	Type string
+	Err  error
+}
+
+// Error gives a string representing the conflict
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("azure: the record set '%s' of type '%s' was changed by someone else: %v", e.Name, e.Type, e.Err)
+}
+
+// IsConflict tells if err reports a record set changed by someone else
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// statusCode returns the HTTP status code of the response Azure failed with; 0 when there is none
+func statusCode(err error) int {
+	if derr, ok := err.(autorest.DetailedError); ok {
+		if code, ok := derr.StatusCode.(int); ok {
+			return code
+		}
+	}
+	return 0
+}
+
+// serviceErrorCode returns the error code Azure failed with, e.g. ResourceGroupNotFound; empty when there is none
+func serviceErrorCode(err error) string {
+	if derr, ok := err.(autorest.DetailedError); ok {
+		if rerr, ok := derr.Original.(*azure.RequestError); ok && rerr.ServiceError != nil {
+			return rerr.ServiceError.Code
+		}
+	}
+	return ""
+}
+
+// wrapError adds context to an error returned by Azure, turning failed preconditions into a ConflictError
+func wrapError(name, recordType string, err error) error {
+	if statusCode(err) == http.StatusPreconditionFailed {
+		return &ConflictError{Name: name, Type: recordType, Err: err}
+	}
+	return fmt.Errorf("azure: %v", err)
+}
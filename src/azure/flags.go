@@ -1,6 +1,8 @@
 package azure
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -11,7 +13,28 @@ const (
 	azureResourceGroup  = "azure-resource-group"
 	azureSubscriptionID = "azure-subscription-id"
 	azureTenantID       = "azure-tenant-id"
+	azureAuthMode       = "azure-auth-mode"
+	azureCertPath       = "azure-certificate-path"
+	azureCertPassword   = "azure-certificate-password"
+	azureFederatedToken = "azure-federated-token-file"
+	azureEnvironment    = "azure-environment"
+	azureARMEndpoint    = "azure-resource-manager-endpoint"
 	managedZone         = "zone"
+	managedZones        = "zones"
+	zoneType            = "azure-zone-type"
+	instanceID          = "azure-instance-id"
+	adoptForeignRecords = "azure-adopt-foreign-records"
+	retryAttempts       = "azure-retry-attempts"
+	retryMinBackoff     = "azure-retry-min-backoff"
+	retryMaxBackoff     = "azure-retry-max-backoff"
+	retryJitter         = "azure-retry-jitter"
+	skipZoneCheck       = "azure-skip-zone-check"
+
+	defaultAzureEnvironment = "AzurePublicCloud"
+	defaultRetryAttempts    = 5
+	defaultRetryMinBackoff  = time.Second
+	defaultRetryMaxBackoff  = 30 * time.Second
+	defaultRetryJitter      = 0.2
 )
 
 // AddFlags adds flags for Builder.
@@ -21,7 +44,22 @@ func AddFlags(flags *pflag.FlagSet) {
 	flags.String(azureResourceGroup, "", "Resource group")
 	flags.String(azureSubscriptionID, "", "Subscription ID")
 	flags.String(azureTenantID, "", "Tenant ID")
+	flags.String(azureAuthMode, "", "Authentication mode: client-secret, client-certificate, managed-identity, workload-identity or environment. Inferred from the credentials when empty")
+	flags.String(azureCertPath, "", "Path of the PFX or PEM client certificate of the client-certificate authentication mode")
+	flags.String(azureCertPassword, "", "Password of the PFX client certificate")
+	flags.String(azureFederatedToken, "", "Path of the federated token file of the workload-identity authentication mode")
+	flags.String(azureEnvironment, defaultAzureEnvironment, "Azure cloud: AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud or AzureGermanCloud")
+	flags.String(azureARMEndpoint, "", "Azure Resource Manager base URI overriding the one of the Azure cloud")
 	flags.String(managedZone, "", "Managed zone")
+	flags.String(managedZones, "", "Comma separated list of further managed zones, each one written as <zone>[:<resource group>[:<subscription>]]")
+	flags.String(instanceID, "", "ID of this Bindman instance written to the metadata of the record sets; when set, the record sets written by other instances are left untouched")
+	flags.Bool(adoptForeignRecords, false, "Take over the record sets existing in the zone without the ownership marker of Bindman, e.g. created by hand")
+	flags.Int(retryAttempts, defaultRetryAttempts, "Maximum number of attempts of a request to Azure failing with throttling, server or connection errors, the first one included")
+	flags.Duration(retryMinBackoff, defaultRetryMinBackoff, "Delay before the first retry of a request to Azure, doubled on each retry")
+	flags.Duration(retryMaxBackoff, defaultRetryMaxBackoff, "Maximum delay between two attempts of a request to Azure, unless Azure asks for a longer one with Retry-After")
+	flags.Float64(retryJitter, defaultRetryJitter, "Fraction of the delay between two attempts randomly added or subtracted, between 0 and 1")
+	flags.Bool(skipZoneCheck, false, "Skip the check of the managed zones and of the permission to write to them at startup")
+	flags.String(zoneType, PublicZone, "Type of the managed zone: public for an Azure DNS zone or private for an Azure Private DNS zone")
 }
 
 // InitFromViper initializes Builder with properties retrieved from Viper.
@@ -31,6 +69,23 @@ func (b *Builder) InitFromViper(v *viper.Viper) *Builder {
 	b.ResourceGroup = v.GetString(azureResourceGroup)
 	b.SubscriptionID = v.GetString(azureSubscriptionID)
 	b.TenantID = v.GetString(azureTenantID)
+	b.AuthMode = v.GetString(azureAuthMode)
+	b.CertificatePath = v.GetString(azureCertPath)
+	b.CertificatePassword = v.GetString(azureCertPassword)
+	b.FederatedTokenFile = v.GetString(azureFederatedToken)
+	b.Environment = v.GetString(azureEnvironment)
+	b.ResourceManagerEndpoint = v.GetString(azureARMEndpoint)
 	b.Zone = v.GetString(managedZone)
+	b.Zones = ParseZones(v.GetString(managedZones))
+	b.ZoneType = v.GetString(zoneType)
+	b.InstanceID = v.GetString(instanceID)
+	b.AdoptForeignRecords = v.GetBool(adoptForeignRecords)
+	b.Retry = RetryPolicy{
+		Attempts:   v.GetInt(retryAttempts),
+		MinBackoff: v.GetDuration(retryMinBackoff),
+		MaxBackoff: v.GetDuration(retryMaxBackoff),
+		Jitter:     v.GetFloat64(retryJitter),
+	}
+	b.SkipZoneCheck = v.GetBool(skipZoneCheck)
 	return b
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestBingFlags(t *testing.T) {
@@ -21,6 +22,19 @@ func TestBingFlags(t *testing.T) {
 	subscriptionIdValue := "subscription-id-value"
 	tenantIdValue := "tenant-id-value"
 	managedZoneValue := "managed-zone-value"
+	environmentValue := "AzureUSGovernmentCloud"
+	authModeValue := "client-certificate"
+	certPathValue := "/etc/bindman/cert.pfx"
+	certPasswordValue := "cert-password-value"
+	federatedTokenValue := "/var/run/secrets/token"
+	armEndpointValue := "http://localhost:8080"
+	zoneTypeValue := PrivateZone
+	instanceIDValue := "blue"
+	retryAttemptsValue := 3
+	retryMinBackoffValue := 500 * time.Millisecond
+	retryMaxBackoffValue := 10 * time.Second
+	retryJitterValue := 0.5
+	managedZonesValue := "other.com:other-rg, third.com:third-rg:third-sub"
 
 	err := command.ParseFlags([]string{
 		fmt.Sprintf("--%s=%s", azureClientID, clientIdValue),
@@ -29,6 +43,21 @@ func TestBingFlags(t *testing.T) {
 		fmt.Sprintf("--%s=%s", azureSubscriptionID, subscriptionIdValue),
 		fmt.Sprintf("--%s=%s", azureTenantID, tenantIdValue),
 		fmt.Sprintf("--%s=%s", managedZone, managedZoneValue),
+		fmt.Sprintf("--%s=%s", azureEnvironment, environmentValue),
+		fmt.Sprintf("--%s=%s", azureAuthMode, authModeValue),
+		fmt.Sprintf("--%s=%s", azureCertPath, certPathValue),
+		fmt.Sprintf("--%s=%s", azureCertPassword, certPasswordValue),
+		fmt.Sprintf("--%s=%s", azureFederatedToken, federatedTokenValue),
+		fmt.Sprintf("--%s=%s", azureARMEndpoint, armEndpointValue),
+		fmt.Sprintf("--%s=%s", zoneType, zoneTypeValue),
+		fmt.Sprintf("--%s=%s", managedZones, managedZonesValue),
+		fmt.Sprintf("--%s=%s", instanceID, instanceIDValue),
+		fmt.Sprintf("--%s", adoptForeignRecords),
+		fmt.Sprintf("--%s", skipZoneCheck),
+		fmt.Sprintf("--%s=%d", retryAttempts, retryAttemptsValue),
+		fmt.Sprintf("--%s=%s", retryMinBackoff, retryMinBackoffValue),
+		fmt.Sprintf("--%s=%s", retryMaxBackoff, retryMaxBackoffValue),
+		fmt.Sprintf("--%s=%v", retryJitter, retryJitterValue),
 	})
 	require.NoError(t, err)
 
@@ -41,6 +70,18 @@ func TestBingFlags(t *testing.T) {
 	assert.Equal(t, subscriptionIdValue, b.SubscriptionID)
 	assert.Equal(t, tenantIdValue, b.TenantID)
 	assert.Equal(t, managedZoneValue, b.Zone)
+	assert.Equal(t, environmentValue, b.Environment)
+	assert.Equal(t, authModeValue, b.AuthMode)
+	assert.Equal(t, certPathValue, b.CertificatePath)
+	assert.Equal(t, certPasswordValue, b.CertificatePassword)
+	assert.Equal(t, federatedTokenValue, b.FederatedTokenFile)
+	assert.Equal(t, armEndpointValue, b.ResourceManagerEndpoint)
+	assert.Equal(t, zoneTypeValue, b.ZoneType)
+	assert.Equal(t, instanceIDValue, b.InstanceID)
+	assert.True(t, b.AdoptForeignRecords)
+	assert.True(t, b.SkipZoneCheck)
+	assert.Equal(t, RetryPolicy{Attempts: retryAttemptsValue, MinBackoff: retryMinBackoffValue, MaxBackoff: retryMaxBackoffValue, Jitter: retryJitterValue}, b.Retry)
+	assert.Equal(t, []ZoneConfig{{Name: "other.com", ResourceGroup: "other-rg"}, {Name: "third.com", ResourceGroup: "third-rg", SubscriptionID: "third-sub"}}, b.Zones)
 }
 
 func TestDefaultValues(t *testing.T) {
@@ -58,4 +99,16 @@ func TestDefaultValues(t *testing.T) {
 	assert.Equal(t, "", b.SubscriptionID)
 	assert.Equal(t, "", b.TenantID)
 	assert.Equal(t, "", b.Zone)
+	assert.Equal(t, defaultAzureEnvironment, b.Environment)
+	assert.Equal(t, "", b.AuthMode)
+	assert.Equal(t, "", b.CertificatePath)
+	assert.Equal(t, "", b.CertificatePassword)
+	assert.Equal(t, "", b.FederatedTokenFile)
+	assert.Equal(t, "", b.ResourceManagerEndpoint)
+	assert.Equal(t, PublicZone, b.ZoneType)
+	assert.Empty(t, b.Zones)
+	assert.Equal(t, "", b.InstanceID)
+	assert.False(t, b.AdoptForeignRecords)
+	assert.False(t, b.SkipZoneCheck)
+	assert.Equal(t, RetryPolicy{Attempts: defaultRetryAttempts, MinBackoff: defaultRetryMinBackoff, MaxBackoff: defaultRetryMaxBackoff, Jitter: defaultRetryJitter}, b.Retry)
 }
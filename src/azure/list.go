@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// ZoneRecordSet is a record set read from a managed zone
+type ZoneRecordSet struct {
+	// Name is the fully qualified name of the record set, without the trailing dot
+	Name   string
+	Type   string
+	TTL    time.Duration
+	Values []string
+	// Owned tells if the record set carries the ownership marker of this instance
+	Owned bool
+	// UpdatedAt is when Bindman last wrote the record set; zero when unknown
+	UpdatedAt time.Time
+}
+
+// RecordSetLister is implemented by the DNSUpdaters able to read back the record sets of the zones they manage
+type RecordSetLister interface {
+	// ListRecordSets reads the record sets of all the managed zones, failing when any zone cannot be read
+	ListRecordSets(ctx context.Context) ([]ZoneRecordSet, error)
+}
+
+// RecordSetReader is implemented by the DNSUpdaters able to read back a single record set
+type RecordSetReader interface {
+	// GetRecordSet reads the record set identified by name and type; nil when it does not exist
+	GetRecordSet(ctx context.Context, name, recordType string) (*ZoneRecordSet, error)
+}
+
+// GetRecordSet reads the record set identified by name and type from its zone; nil when it does not exist
+func (azu *AzUpdater) GetRecordSet(ctx context.Context, name, recordType string) (*ZoneRecordSet, error) {
+	zone, client, err := azu.zone(name)
+	if err != nil {
+		return nil, err
+	}
+	relative := toRelativeRecord(name, ToFqdn(zone.Name))
+	rs, err := getRecordSet(azu.Retry.withRetries(ctx), client, relative, recordType)
+	if err != nil || rs == nil {
+		return nil, err
+	}
+	return &ZoneRecordSet{
+		Name:      toAbsoluteRecord(relative, zone.Name),
+		Type:      recordType,
+		TTL:       time.Duration(recordSetTTL(rs)) * time.Second,
+		Values:    recordSetValues(recordType, rs.RecordSetProperties),
+		Owned:     azu.owns(rs),
+		UpdatedAt: recordSetUpdatedAt(rs),
+	}, nil
+}
+
+// ListRecordSets reads the record sets of all the managed zones. The record sets of types Bindman does not manage,
+// such as SOA, are left out
+func (azu *AzUpdater) ListRecordSets(ctx context.Context) ([]ZoneRecordSet, error) {
+	ctx = azu.Retry.withRetries(ctx)
+	var result []ZoneRecordSet
+	for _, zone := range azu.zones() {
+		client := azu.clients[zone.Name]
+		recordSets, err := client.list(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("azure: not possible to list the record sets of the zone '%s': %v", zone.Name, err)
+		}
+		for i := range recordSets {
+			rs := &recordSets[i]
+			relative, recordType := to.String(rs.Name), recordSetType(rs)
+			if relative == probeRecord || client.checkRecordType(recordType) != nil {
+				continue
+			}
+			result = append(result, ZoneRecordSet{
+				Name:      toAbsoluteRecord(relative, zone.Name),
+				Type:      recordType,
+				TTL:       time.Duration(recordSetTTL(rs)) * time.Second,
+				Values:    recordSetValues(recordType, rs.RecordSetProperties),
+				Owned:     azu.owns(rs),
+				UpdatedAt: recordSetUpdatedAt(rs),
+			})
+		}
+	}
+	return result, nil
+}
+
+// recordSetType returns the record type of a listed record set, the last segment of its resource type,
+// e.g. A for Microsoft.Network/dnszones/A
+func recordSetType(rs *dns.RecordSet) string {
+	resourceType := to.String(rs.Type)
+	return resourceType[strings.LastIndex(resourceType, "/")+1:]
+}
+
+// recordSetTTL returns the TTL of the record set in seconds
+func recordSetTTL(rs *dns.RecordSet) int64 {
+	if rs.RecordSetProperties == nil {
+		return 0
+	}
+	return to.Int64(rs.TTL)
+}
+
+// recordSetUpdatedAt returns when Bindman last wrote the record set according to its metadata; zero when unknown
+func recordSetUpdatedAt(rs *dns.RecordSet) time.Time {
+	if rs.RecordSetProperties == nil {
+		return time.Time{}
+	}
+	updatedAt, err := time.Parse(time.RFC3339, metadataValue(rs.Metadata, MetadataUpdatedAt))
+	if err != nil {
+		return time.Time{}
+	}
+	return updatedAt
+}
+
+// toAbsoluteRecord returns the name of the record relative to the zone as a fully qualified name, without the trailing dot
+func toAbsoluteRecord(relative, zone string) string {
+	zone = UnFqdn(zone)
+	if relative == "@" || relative == "" {
+		return zone
+	}
+	return relative + "." + zone
+}
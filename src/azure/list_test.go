@@ -0,0 +1,108 @@
+package azure
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestAzUpdater_ListRecordSets(t *testing.T) {
+	for _, zoneType := range []string{PublicZone, PrivateZone} {
+		t.Run(zoneType, func(t *testing.T) {
+			arm := newFakeARM()
+			if zoneType == PrivateZone {
+				arm = newFakePrivateARM()
+			}
+			server := httptest.NewServer(arm)
+			defer server.Close()
+			azu := newTestUpdaterOfZoneType(t, server, zoneType)
+
+			for _, record := range []hookTypes.DNSRecord{
+				{Name: "www.test.com", Type: "A", Value: "10.0.0.1"},
+				{Name: "www.test.com", Type: "A", Value: "10.0.0.2"},
+				{Name: "test.com", Type: "TXT", Value: "v=spf1 -all"},
+			} {
+				if err := azu.AddRR(context.Background(), record, time.Minute); err != nil {
+					t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+				}
+			}
+			arm.modify("legacy", "CNAME", []string{"old.example.com"})
+			arm.Lock()
+			arm.store(arm.recordSetPath("@", "SOA"), dns.RecordSet{RecordSetProperties: &dns.RecordSetProperties{TTL: to.Int64Ptr(3600)}})
+			arm.Unlock()
+
+			recordSets, err := azu.ListRecordSets(context.Background())
+			if err != nil {
+				t.Fatalf("Expecting ListRecordSets to succeed. Got err '%v'", err)
+			}
+			for i := range recordSets {
+				updatedAt := recordSets[i].UpdatedAt
+				if recordSets[i].Owned && (updatedAt.IsZero() || time.Since(updatedAt) > time.Minute) || !recordSets[i].Owned && !updatedAt.IsZero() {
+					t.Errorf("Expecting the time of the last write of the record sets written by Bindman. Got %v for %s", updatedAt, recordSets[i].Name)
+				}
+				recordSets[i].UpdatedAt = time.Time{}
+			}
+			expected := []ZoneRecordSet{
+				{Name: "www.test.com", Type: "A", TTL: time.Minute, Values: []string{"10.0.0.1", "10.0.0.2"}, Owned: true},
+				{Name: "legacy.test.com", Type: "CNAME", TTL: 5 * time.Minute, Values: []string{"old.example.com"}},
+				{Name: "test.com", Type: "TXT", TTL: time.Minute, Values: []string{"v=spf1 -all"}, Owned: true},
+			}
+			if !reflect.DeepEqual(recordSets, expected) {
+				t.Errorf("Expecting the record sets %+v. Got %+v", expected, recordSets)
+			}
+		})
+	}
+}
+
+func TestAzUpdater_WithOverwrite(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+	}
+	arm.modify("www", "A", []string{"10.0.0.9"})
+
+	record := hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}
+	if err := azu.UpdateRR(context.Background(), record, time.Minute); !IsConflict(err) {
+		t.Fatalf("Expecting UpdateRR to fail with a conflict. Got err '%v'", err)
+	}
+	if err := azu.UpdateRR(WithOverwrite(context.Background()), record, time.Minute); err != nil {
+		t.Fatalf("Expecting UpdateRR to overwrite the record set changed by someone else. Got err '%v'", err)
+	}
+	rs, _ := arm.recordSet("www", "A")
+	if got := recordSetValues("A", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Errorf("Expecting the record set to be overwritten. Got %v", got)
+	}
+}
+
+func TestAzUpdater_GetRecordSet(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}, time.Minute); err != nil {
+			t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+		}
+	}
+	rs, err := azu.GetRecordSet(context.Background(), "www.test.com", "A")
+	if err != nil || rs == nil {
+		t.Fatalf("Expecting the record set to be read. Got %v and err '%v'", rs, err)
+	}
+	if rs.Name != "www.test.com" || rs.TTL != time.Minute || !reflect.DeepEqual(rs.Values, []string{"10.0.0.1", "10.0.0.2"}) || !rs.Owned {
+		t.Errorf("Expecting the record set written. Got %+v", rs)
+	}
+	if rs, err = azu.GetRecordSet(context.Background(), "missing.test.com", "A"); err != nil || rs != nil {
+		t.Errorf("Expecting a missing record set to be reported as nil. Got %v and err '%v'", rs, err)
+	}
+}
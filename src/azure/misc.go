@@ -3,30 +3,35 @@ package azure
 import (
 	"fmt"
 	"github.com/labbsr0x/bindman-dns-webhook/src/types"
-	"strings"
+	"net/url"
 )
 
 // check tests if a NSUpdate setup is ok; returns a set of error strings in case something is not right
 func (azu *AzUpdater) check() (success bool, errs []string) {
-	errMsg := `The "%v" must be specified`
-	if strings.TrimSpace(azu.Zone) == "" {
-		errs = append(errs, fmt.Sprintf(errMsg, "DNS zone"))
+	errs = append(errs, azu.checkZones()...)
+	if err := checkZoneType(azu.zoneType()); err != nil {
+		errs = append(errs, fmt.Sprintf(`The zone type "%v" is not known; use one of %v or %v`, azu.ZoneType, PublicZone, PrivateZone))
 	}
-	if strings.TrimSpace(azu.SubscriptionID) == "" {
-		errs = append(errs, fmt.Sprintf(errMsg, "SubscriptionID"))
+	errs = append(errs, azu.checkAuth()...)
+	errs = append(errs, azu.Retry.check()...)
+	if _, err := azu.environment(); err != nil {
+		errs = append(errs, fmt.Sprintf(`The environment "%v" is not a known Azure cloud; use one of AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud or AzureGermanCloud`, azu.Environment))
 	}
-	if strings.TrimSpace(azu.ResourceGroup) == "" {
-		errs = append(errs, fmt.Sprintf(errMsg, "ResourceGroup"))
+	if azu.ResourceManagerEndpoint != "" {
+		if u, err := url.Parse(azu.ResourceManagerEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf(`The resource manager endpoint "%v" must be an absolute http or https URL`, azu.ResourceManagerEndpoint))
+		}
 	}
 	return len(errs) == 0, errs
 }
 
-// checkName checks if the name is in the expected format: subdomain.zone
-func (azu *AzUpdater) checkName(name string) (err error) {
-	if !strings.HasSuffix(name, "."+azu.Zone) {
-		err = types.BadRequestError(fmt.Sprintf("the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.%s'", name, azu.Zone), nil)
+// normalizeValue checks if the value is valid for the record type and returns it in its canonical format
+func normalizeValue(recordType, value string) (string, error) {
+	normalized, err := NormalizeValue(recordType, value)
+	if err != nil {
+		return "", types.BadRequestError(fmt.Sprintf("the value '%s' is not allowed for a record of type '%s'", value, recordType), err, err.Error())
 	}
-	return
+	return normalized, nil
 }
 
 // ToFqdn converts the name into a fqdn appending a trailing dot.
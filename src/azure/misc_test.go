@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/labbsr0x/bindman-dns-webhook/src/types"
 	"testing"
+	"time"
 )
 
 func TestAzUpdater_check(t *testing.T) {
@@ -18,32 +19,60 @@ func TestAzUpdater_check(t *testing.T) {
 	}
 	testCases := []struct {
 		name      string
-		azUpdater AzUpdater
+		azUpdater *AzUpdater
 		expected  returnValue
 	}{
 		{
 			"all OK",
-			AzUpdater{Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com"}, nil},
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com"}},
 			returnValue{true, []string{}},
 		},
 		{
 			"all required fields",
-			AzUpdater{Builder{}, nil},
+			&AzUpdater{Builder: Builder{}},
 			returnValue{false, []string{errorMsgDnsZone, errorMsgSubscription, errorMsgRg}},
 		},
 		{
 			"subscription required",
-			AzUpdater{Builder{ResourceGroup: "rg-value", Zone: "test.com"}, nil},
+			&AzUpdater{Builder: Builder{ResourceGroup: "rg-value", Zone: "test.com"}},
 			returnValue{false, []string{errorMsgSubscription}},
 		},
 		{
 			"resource group required",
-			AzUpdater{Builder{SubscriptionID: "sub-value", Zone: "test.com"}, nil},
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", Zone: "test.com"}},
 			returnValue{false, []string{errorMsgRg}},
 		},
+		{
+			"sovereign cloud",
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com", Environment: "AzureUSGovernmentCloud", ResourceManagerEndpoint: "http://127.0.0.1:8080"}},
+			returnValue{true, []string{}},
+		},
+		{
+			"unknown environment and invalid endpoint",
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com", Environment: "AzureMoonCloud", ResourceManagerEndpoint: "localhost:8080"}},
+			returnValue{false, []string{
+				`The environment "AzureMoonCloud" is not a known Azure cloud; use one of AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud or AzureGermanCloud`,
+				`The resource manager endpoint "localhost:8080" must be an absolute http or https URL`,
+			}},
+		},
+		{
+			"private zone",
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.internal", ZoneType: PrivateZone}},
+			returnValue{true, []string{}},
+		},
+		{
+			"unknown zone type",
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com", ZoneType: "hybrid"}},
+			returnValue{false, []string{`The zone type "hybrid" is not known; use one of public or private`}},
+		},
+		{
+			"invalid retry policy",
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com", Retry: RetryPolicy{Attempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Second, Jitter: 2}}},
+			returnValue{false, []string{"The retry min backoff 1m0s must not be greater than the max backoff 1s", "The retry jitter 2 must be between 0 and 1"}},
+		},
 		{
 			"DNS zone required",
-			AzUpdater{Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value"}, nil},
+			&AzUpdater{Builder: Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value"}},
 			returnValue{false, []string{errorMsgDnsZone}},
 		},
 	}
@@ -68,7 +97,7 @@ func TestAzUpdater_check(t *testing.T) {
 }
 
 func TestAzUpdater_checkName(t *testing.T) {
-	azUpdater := AzUpdater{Builder{Zone: "test.com."}, nil}
+	azUpdater := AzUpdater{Builder: Builder{Zone: "test.com."}}
 	errorMsg := "the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.%s'"
 
 	testCases := []struct {
@@ -77,7 +106,6 @@ func TestAzUpdater_checkName(t *testing.T) {
 	}{
 		{"teste.io.", types.BadRequestError(fmt.Sprintf(errorMsg, "teste.io.", azUpdater.Zone), nil)},
 		{".test.com", types.BadRequestError(fmt.Sprintf(errorMsg, ".test.com", azUpdater.Zone), nil)},
-		{"test.com.", types.BadRequestError(fmt.Sprintf(errorMsg, "test.com.", azUpdater.Zone), nil)},
 		{"subdomain.test.com", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.test.com", azUpdater.Zone), nil)},
 		{"subdomain.test.com.br", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.test.com.br", azUpdater.Zone), nil)},
 		{"subdomain.subdomain.test.com", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.subdomain.test.com", azUpdater.Zone), nil)},
@@ -89,11 +117,12 @@ func TestAzUpdater_checkName(t *testing.T) {
 		{"subdomain.subdomain.test.com.", nil},
 		{"subdomain.test.com.", nil},
 		{"a.test.com.", nil},
+		{"test.com.", nil},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			err := azUpdater.checkName(test.name)
+			_, err := azUpdater.checkName(test.name)
 			if test.expected == nil {
 				if err != nil {
 					t.Errorf("got = %v, want %v", err, test.expected)
@@ -158,3 +187,24 @@ func TestUnFqdn(t *testing.T) {
 		})
 	}
 }
+
+func TestToRelativeRecord(t *testing.T) {
+	testCases := []struct {
+		domain   string
+		zone     string
+		expected string
+	}{
+		{"sub.test.com", "test.com.", "sub"},
+		{"sub.test.com.", "test.com.", "sub"},
+		{"a.sub.test.com", "test.com", "a.sub"},
+		{"test.com.", "test.com.", "@"},
+		{"test.com", "test.com.", "@"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := toRelativeRecord(tt.domain, tt.zone); got != tt.expected {
+				t.Errorf("toRelativeRecord() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
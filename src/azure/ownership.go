@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MetadataManagedBy is the metadata key marking the record sets written by Bindman
+	MetadataManagedBy = "managedBy"
+	// MetadataInstance is the metadata key holding the ID of the Bindman instance that wrote the record set
+	MetadataInstance = "bindmanInstance"
+	// MetadataCreatedAt is the metadata key holding when Bindman first wrote the record set
+	MetadataCreatedAt = "createdAt"
+	// MetadataUpdatedAt is the metadata key holding when Bindman last wrote the record set
+	MetadataUpdatedAt = "updatedAt"
+
+	// managedByBindman is the value of the ownership marker
+	managedByBindman = "bindman"
+)
+
+// ForeignRecordError reports a record set existing in Azure without the ownership marker of Bindman,
+// e.g. created by hand or by another tool
+type ForeignRecordError struct {
+	Name string
+	Type string
+}
+
+// Error gives a string representing the foreign record set
+func (e *ForeignRecordError) Error() string {
+	return fmt.Sprintf("azure: the record set '%s' of type '%s' is not managed by Bindman", e.Name, e.Type)
+}
+
+// IsForeign tells if err reports a record set not managed by Bindman
+func IsForeign(err error) bool {
+	_, ok := err.(*ForeignRecordError)
+	return ok
+}
+
+// checkOwnership checks if Bindman may change the current record set: when Bindman wrote it, when it carries the ownership marker
+// of this instance, when it holds the values set by WithStoredValues without the marker of another instance, as the record sets
+// written before the marker existed do, or when foreign record sets are to be adopted
+func (azu *AzUpdater) checkOwnership(ctx context.Context, key, name, recordType string, current *dns.RecordSet) error {
+	if current == nil {
+		return nil
+	}
+	if _, tracked := azu.trackedETag(key); tracked || azu.owns(current) {
+		return nil
+	}
+	if stored, ok := storedValues(ctx); ok && current.RecordSetProperties != nil && metadataValue(current.Metadata, MetadataInstance) == "" &&
+		SameValues(recordType, recordSetValues(recordType, current.RecordSetProperties), stored) {
+		logrus.Infof("Taking over the record set '%s' of type '%s' stored by Bindman without its ownership marker", name, recordType)
+		return nil
+	}
+	if !azu.AdoptForeignRecords {
+		return &ForeignRecordError{Name: name, Type: recordType}
+	}
+	logrus.Infof("Adopting the record set '%s' of type '%s' not managed by Bindman", name, recordType)
+	return nil
+}
+
+// owns tells if the record set carries the ownership marker of this instance.
+// Every Bindman instance is taken as the owner when no InstanceID is set
+func (b *Builder) owns(rs *dns.RecordSet) bool {
+	if rs.RecordSetProperties == nil {
+		return false
+	}
+	if metadataValue(rs.Metadata, MetadataManagedBy) != managedByBindman {
+		return false
+	}
+	return b.InstanceID == "" || metadataValue(rs.Metadata, MetadataInstance) == b.InstanceID
+}
+
+// stamp returns the metadata of a record set written by Bindman at now, keeping the other entries of the current record set
+func (b *Builder) stamp(current *dns.RecordSet, now time.Time) map[string]*string {
+	metadata := map[string]*string{}
+	createdAt := ""
+	if current != nil && current.RecordSetProperties != nil {
+		for k, v := range current.Metadata {
+			metadata[k] = v
+		}
+		if b.owns(current) {
+			createdAt = metadataValue(current.Metadata, MetadataCreatedAt)
+		}
+	}
+	timestamp := now.UTC().Format(time.RFC3339)
+	if createdAt == "" {
+		createdAt = timestamp
+	}
+	setMetadata(metadata, MetadataManagedBy, managedByBindman)
+	setMetadata(metadata, MetadataCreatedAt, createdAt)
+	setMetadata(metadata, MetadataUpdatedAt, timestamp)
+	if b.InstanceID != "" {
+		setMetadata(metadata, MetadataInstance, b.InstanceID)
+	}
+	return metadata
+}
+
+// metadataValue returns the value of the metadata key, compared case-insensitively as Azure does
+func metadataValue(metadata map[string]*string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return to.String(v)
+		}
+	}
+	return ""
+}
+
+// setMetadata sets the value of the metadata key, replacing the entries differing only by case
+func setMetadata(metadata map[string]*string, key, value string) {
+	for k := range metadata {
+		if strings.EqualFold(k, key) {
+			delete(metadata, k)
+		}
+	}
+	metadata[key] = to.StringPtr(value)
+}
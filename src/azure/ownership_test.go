@@ -0,0 +1,65 @@
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func recordSetWithMetadata(metadata map[string]string) *dns.RecordSet {
+	properties := &dns.RecordSetProperties{Metadata: map[string]*string{}}
+	for k, v := range metadata {
+		properties.Metadata[k] = to.StringPtr(v)
+	}
+	return &dns.RecordSet{RecordSetProperties: properties}
+}
+
+func TestBuilder_owns(t *testing.T) {
+	testCases := []struct {
+		name       string
+		instanceID string
+		metadata   map[string]string
+		expected   bool
+	}{
+		{"no metadata", "", nil, false},
+		{"other tool", "", map[string]string{"managedBy": "terraform"}, false},
+		{"bindman", "", map[string]string{"managedBy": "bindman"}, true},
+		{"keys compared case-insensitively", "", map[string]string{"managedby": "bindman"}, true},
+		{"same instance", "blue", map[string]string{"managedBy": "bindman", "bindmanInstance": "blue"}, true},
+		{"other instance", "blue", map[string]string{"managedBy": "bindman", "bindmanInstance": "green"}, false},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Builder{InstanceID: tt.instanceID}
+			if got := b.owns(recordSetWithMetadata(tt.metadata)); got != tt.expected {
+				t.Errorf("owns() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuilder_stamp(t *testing.T) {
+	now := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	b := &Builder{InstanceID: "blue"}
+
+	metadata := b.stamp(nil, now)
+	for key, expected := range map[string]string{MetadataManagedBy: "bindman", MetadataInstance: "blue", MetadataCreatedAt: "2019-10-01T12:00:00Z", MetadataUpdatedAt: "2019-10-01T12:00:00Z"} {
+		if got := to.String(metadata[key]); got != expected {
+			t.Errorf("Expecting the metadata '%s' to be '%s'. Got '%s'", key, expected, got)
+		}
+	}
+
+	current := recordSetWithMetadata(map[string]string{"owner": "team-a", "managedby": "bindman", "createdAt": "2019-01-01T00:00:00Z"})
+	metadata = b.stamp(current, now)
+	if to.String(metadata["owner"]) != "team-a" {
+		t.Errorf("Expecting the other metadata entries to be kept. Got %v", metadata)
+	}
+	if _, found := metadata["managedby"]; found || to.String(metadata[MetadataManagedBy]) != "bindman" {
+		t.Errorf("Expecting the entries differing only by case to be replaced. Got %v", metadata)
+	}
+	if to.String(metadata[MetadataCreatedAt]) != "2019-10-01T12:00:00Z" {
+		t.Errorf("Expecting the creation time of a record set of another instance to be reset. Got %v", to.String(metadata[MetadataCreatedAt]))
+	}
+}
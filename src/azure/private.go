@@ -0,0 +1,131 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// privateRecordTypes are the record types that can be managed in a private zone
+var privateRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+	"MX":    true,
+	"PTR":   true,
+	"SRV":   true,
+	"TXT":   true,
+}
+
+// privateRecordSets handles the record sets of an Azure Private DNS zone
+type privateRecordSets struct {
+	client        privatedns.RecordSetsClient
+	zones         privatedns.PrivateZonesClient
+	resourceGroup string
+	zone          string
+}
+
+func newPrivateRecordSets(b *Builder, zone ZoneConfig, env azure.Environment, authorizer autorest.Authorizer) *privateRecordSets {
+	client := privatedns.NewRecordSetsClientWithBaseURI(b.resourceManagerEndpoint(env), zone.SubscriptionID)
+	client.Authorizer = authorizer
+	zones := privatedns.NewPrivateZonesClientWithBaseURI(b.resourceManagerEndpoint(env), zone.SubscriptionID)
+	zones.Authorizer = authorizer
+	return &privateRecordSets{client: client, zones: zones, resourceGroup: zone.ResourceGroup, zone: UnFqdn(zone.Name)}
+}
+
+func (p *privateRecordSets) get(ctx context.Context, relative, recordType string) (dns.RecordSet, error) {
+	rs, err := p.client.Get(ctx, p.resourceGroup, p.zone, privatedns.RecordType(recordType), relative)
+	if err != nil {
+		return dns.RecordSet{}, err
+	}
+	return fromPrivateRecordSet(rs)
+}
+
+func (p *privateRecordSets) createOrUpdate(ctx context.Context, relative, recordType string, rs dns.RecordSet, ifMatch, ifNoneMatch string) (dns.RecordSet, error) {
+	parameters, err := toPrivateRecordSet(rs)
+	if err != nil {
+		return dns.RecordSet{}, err
+	}
+	result, err := p.client.CreateOrUpdate(ctx, p.resourceGroup, p.zone, privatedns.RecordType(recordType), relative, parameters, ifMatch, ifNoneMatch)
+	if err != nil {
+		return dns.RecordSet{}, err
+	}
+	return fromPrivateRecordSet(result)
+}
+
+func (p *privateRecordSets) delete(ctx context.Context, relative, recordType, ifMatch string) error {
+	_, err := p.client.Delete(ctx, p.resourceGroup, p.zone, privatedns.RecordType(recordType), relative, ifMatch)
+	return err
+}
+
+func (p *privateRecordSets) list(ctx context.Context) (result []dns.RecordSet, err error) {
+	iter, err := p.client.ListComplete(ctx, p.resourceGroup, p.zone, nil, "")
+	for ; err == nil && iter.NotDone(); err = iter.NextWithContext(ctx) {
+		var rs dns.RecordSet
+		if rs, err = fromPrivateRecordSet(iter.Value()); err != nil {
+			return
+		}
+		result = append(result, rs)
+	}
+	return
+}
+
+func (p *privateRecordSets) getZone(ctx context.Context) ([]string, error) {
+	_, err := p.zones.Get(ctx, p.resourceGroup, p.zone)
+	return nil, err
+}
+
+func (p *privateRecordSets) checkRecordType(recordType string) error {
+	if !privateRecordTypes[recordType] {
+		return fmt.Errorf("record type %s not supported by private zones", recordType)
+	}
+	return nil
+}
+
+func (p *privateRecordSets) supportsAliases() bool {
+	return false
+}
+
+// toPrivateRecordSet converts a record set of the public DNS API into one of the Private DNS API.
+// Both APIs share the JSON layout of the record types supported by private zones
+func toPrivateRecordSet(rs dns.RecordSet) (result privatedns.RecordSet, err error) {
+	result.Etag = rs.Etag
+	if rs.RecordSetProperties == nil {
+		return
+	}
+	if rs.TargetResource != nil {
+		return result, fmt.Errorf("alias record sets not supported by private zones")
+	}
+	result.RecordSetProperties = new(privatedns.RecordSetProperties)
+	err = convertProperties(rs.RecordSetProperties, result.RecordSetProperties)
+	return
+}
+
+// fromPrivateRecordSet converts a record set of the Private DNS API into one of the public DNS API
+func fromPrivateRecordSet(rs privatedns.RecordSet) (result dns.RecordSet, err error) {
+	result.Response = rs.Response
+	result.Etag = rs.Etag
+	result.ID = rs.ID
+	result.Name = rs.Name
+	result.Type = rs.Type
+	if rs.RecordSetProperties == nil {
+		return
+	}
+	result.RecordSetProperties = new(dns.RecordSetProperties)
+	err = convertProperties(rs.RecordSetProperties, result.RecordSetProperties)
+	return
+}
+
+// convertProperties copies the record set properties of one API into the ones of the other through their JSON layout
+func convertProperties(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
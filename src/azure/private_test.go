@@ -0,0 +1,116 @@
+package azure
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestPrivateZone_AddUpdateAndRemoveRR(t *testing.T) {
+	arm := newFakePrivateARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdaterOfZoneType(t, server, PrivateZone)
+
+	for _, value := range []string{"10 mail1.test.com", "20 mail2.test.com"} {
+		if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "test.com", Type: "MX", Value: value}, time.Minute); err != nil {
+			t.Fatalf("Expecting AddRR to succeed. Got err '%v'", err)
+		}
+	}
+	rs, found := arm.recordSet("@", "MX")
+	if !found {
+		t.Fatalf("Expecting the record set to be written to the private zone. Requests: %v", arm.requests)
+	}
+	if got := recordSetValues("MX", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"10 mail1.test.com", "20 mail2.test.com"}) {
+		t.Errorf("Expecting the values to be merged. Got %v", got)
+	}
+
+	if err := azu.UpdateRR(context.Background(), hookTypes.DNSRecord{Name: "test.com", Type: "MX", Value: "30 mail3.test.com"}, time.Minute); err != nil {
+		t.Fatalf("Expecting UpdateRR to succeed. Got err '%v'", err)
+	}
+	rs, _ = arm.recordSet("@", "MX")
+	if got := recordSetValues("MX", rs.RecordSetProperties); !reflect.DeepEqual(got, []string{"30 mail3.test.com"}) {
+		t.Errorf("Expecting the values to be replaced. Got %v", got)
+	}
+
+	arm.modify("@", "MX", []string{"40 mail4.test.com"})
+	if err := azu.RemoveRR(context.Background(), "test.com", "MX", ""); !IsConflict(err) {
+		t.Errorf("Expecting RemoveRR to fail with a conflict. Got err '%v'", err)
+	}
+	azu.etags.Delete(recordSetKey("test.com", "@", "MX"))
+	azu.AdoptForeignRecords = true
+	if err := azu.RemoveRR(context.Background(), "test.com", "MX", "40 mail4.test.com"); err != nil {
+		t.Fatalf("Expecting RemoveRR to succeed. Got err '%v'", err)
+	}
+	if _, found := arm.recordSet("@", "MX"); found {
+		t.Errorf("Expecting the record set to be deleted along with its last value")
+	}
+}
+
+func TestPrivateZone_UnsupportedRecords(t *testing.T) {
+	arm := newFakePrivateARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdaterOfZoneType(t, server, PrivateZone)
+
+	testCases := []struct {
+		name   string
+		record hookTypes.DNSRecord
+		errMsg string
+	}{
+		{"CAA", hookTypes.DNSRecord{Name: "test.com", Type: "CAA", Value: "0 issue letsencrypt.org"}, "not supported by private zones"},
+		{"NS", hookTypes.DNSRecord{Name: "sub.test.com", Type: "NS", Value: "ns1.test.com"}, "not supported by private zones"},
+		{"alias", hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: publicIPID}, "alias records are not supported by private zones"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := azu.AddRR(context.Background(), test.record, time.Minute)
+			if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+				t.Errorf("Expecting AddRR to fail with '%s'. Got err '%v'", test.errMsg, err)
+			}
+		})
+	}
+	if len(arm.requests) != 0 {
+		t.Errorf("Expecting no request to be sent for unsupported records. Got %v", arm.requests)
+	}
+}
+
+func TestToPrivateRecordSet(t *testing.T) {
+	properties, err := recordSetProperties("SRV", []string{"10 5 5060 sip.test.com"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	properties.TTL = to.Int64Ptr(60)
+	properties.Metadata = map[string]*string{"owner": to.StringPtr("bindman")}
+
+	private, err := toPrivateRecordSet(dns.RecordSet{Etag: to.StringPtr("etag-1"), RecordSetProperties: properties})
+	if err != nil {
+		t.Fatalf("Expecting the conversion to succeed. Got err '%v'", err)
+	}
+	if to.String(private.Etag) != "etag-1" || to.Int64(private.TTL) != 60 || to.String(private.Metadata["owner"]) != "bindman" {
+		t.Errorf("Expecting the ETag, TTL and metadata to be kept. Got %+v", private.RecordSetProperties)
+	}
+	if private.SrvRecords == nil || len(*private.SrvRecords) != 1 || to.String((*private.SrvRecords)[0].Target) != "sip.test.com" {
+		t.Errorf("Expecting the SRV records to be kept. Got %+v", private.SrvRecords)
+	}
+
+	back, err := fromPrivateRecordSet(private)
+	if err != nil {
+		t.Fatalf("Expecting the conversion back to succeed. Got err '%v'", err)
+	}
+	if got := recordSetValues("SRV", back.RecordSetProperties); !reflect.DeepEqual(got, []string{"10 5 5060 sip.test.com"}) {
+		t.Errorf("Expecting the values to survive the round trip. Got %v", got)
+	}
+
+	alias := &dns.RecordSetProperties{TargetResource: &dns.SubResource{ID: to.StringPtr(publicIPID)}}
+	if _, err := toPrivateRecordSet(dns.RecordSet{RecordSetProperties: alias}); err == nil {
+		t.Errorf("Expecting alias record sets to be rejected")
+	}
+}
@@ -0,0 +1,222 @@
+package azure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MXValue holds the structured data of a MX record, written as "<preference> <exchange>"
+type MXValue struct {
+	Preference uint16
+	Exchange   string
+}
+
+// SRVValue holds the structured data of a SRV record, written as "<priority> <weight> <port> <target>"
+type SRVValue struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// CAAValue holds the structured data of a CAA record, written as `<flags> <tag> "<value>"`
+type CAAValue struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// ParseMX parses the value of a MX record
+func ParseMX(value string) (mx MXValue, err error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return mx, fmt.Errorf("invalid MX value '%s': must obey the following pattern: '<preference> <exchange>'", value)
+	}
+	if mx.Preference, err = parseUint16("MX preference", fields[0]); err != nil {
+		return
+	}
+	if err = checkDomainName("MX exchange", fields[1], false); err != nil {
+		return
+	}
+	mx.Exchange = fields[1]
+	return
+}
+
+// String formats the MX record value
+func (mx MXValue) String() string {
+	return fmt.Sprintf("%d %s", mx.Preference, mx.Exchange)
+}
+
+// ParseSRV parses the value of a SRV record
+func ParseSRV(value string) (srv SRVValue, err error) {
+	fields := strings.Fields(value)
+	if len(fields) != 4 {
+		return srv, fmt.Errorf("invalid SRV value '%s': must obey the following pattern: '<priority> <weight> <port> <target>'", value)
+	}
+	if srv.Priority, err = parseUint16("SRV priority", fields[0]); err != nil {
+		return
+	}
+	if srv.Weight, err = parseUint16("SRV weight", fields[1]); err != nil {
+		return
+	}
+	if srv.Port, err = parseUint16("SRV port", fields[2]); err != nil {
+		return
+	}
+	if err = checkDomainName("SRV target", fields[3], true); err != nil {
+		return
+	}
+	srv.Target = fields[3]
+	return
+}
+
+// String formats the SRV record value
+func (srv SRVValue) String() string {
+	return fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target)
+}
+
+// ParseCAA parses the value of a CAA record
+func ParseCAA(value string) (caa CAAValue, err error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return caa, fmt.Errorf(`invalid CAA value '%s': must obey the following pattern: '<flags> <tag> "<value>"'`, value)
+	}
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return caa, fmt.Errorf("invalid CAA flags '%s': must be a number between 0 and 255", fields[0])
+	}
+	caa.Flags = uint8(flags)
+	if err = checkCAATag(fields[1]); err != nil {
+		return
+	}
+	caa.Tag = fields[1]
+
+	// the value may hold spaces when quoted
+	rest := strings.TrimSpace(value)
+	for i := 0; i < 2; i++ {
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[i]))
+	}
+	if strings.HasPrefix(rest, `"`) {
+		if len(rest) < 2 || !strings.HasSuffix(rest, `"`) {
+			return caa, fmt.Errorf("invalid CAA value '%s': missing closing quote", rest)
+		}
+		rest = rest[1 : len(rest)-1]
+	} else if len(fields) > 3 {
+		return caa, fmt.Errorf("invalid CAA value '%s': values holding spaces must be quoted", rest)
+	}
+	if strings.Contains(rest, `"`) {
+		return caa, fmt.Errorf("invalid CAA value '%s': quotes are not allowed inside the value", rest)
+	}
+	caa.Value = rest
+	return
+}
+
+// String formats the CAA record value
+func (caa CAAValue) String() string {
+	return fmt.Sprintf("%d %s %q", caa.Flags, caa.Tag, caa.Value)
+}
+
+// NormalizeValue validates the value of a record of the given type and returns it in its canonical format
+func NormalizeValue(recordType, value string) (string, error) {
+	if isAlias(recordType, value) {
+		target := strings.TrimSpace(value)
+		if err := checkResourceID(target); err != nil {
+			return "", err
+		}
+		return target, nil
+	}
+	switch recordType {
+	case "MX":
+		mx, err := ParseMX(value)
+		if err != nil {
+			return "", err
+		}
+		return mx.String(), nil
+	case "SRV":
+		srv, err := ParseSRV(value)
+		if err != nil {
+			return "", err
+		}
+		return srv.String(), nil
+	case "CAA":
+		caa, err := ParseCAA(value)
+		if err != nil {
+			return "", err
+		}
+		return caa.String(), nil
+	default:
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// IsAliasTarget tells if the value is the ID of an Azure resource (e.g. a public IP, a Front Door or a Traffic Manager profile)
+// the record set must point to instead of a literal value
+func IsAliasTarget(value string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "/subscriptions/")
+}
+
+// checkResourceID checks if id obeys the pattern of an Azure resource ID:
+// /subscriptions/<subscription>/resourceGroups/<group>/providers/<namespace>/<type>/<name>
+func checkResourceID(id string) error {
+	segments := strings.Split(strings.TrimPrefix(id, "/"), "/")
+	if len(segments) < 8 || len(segments)%2 != 0 ||
+		!strings.EqualFold(segments[0], "subscriptions") ||
+		!strings.EqualFold(segments[2], "resourceGroups") ||
+		!strings.EqualFold(segments[4], "providers") {
+		return fmt.Errorf("invalid Azure resource ID '%s': must obey the following pattern: '/subscriptions/<subscription>/resourceGroups/<group>/providers/<namespace>/<type>/<name>'", id)
+	}
+	for _, segment := range segments {
+		if strings.TrimSpace(segment) == "" {
+			return fmt.Errorf("invalid Azure resource ID '%s': empty segments are not allowed", id)
+		}
+	}
+	return nil
+}
+
+// parseUint16 parses a numeric field of a record value
+func parseUint16(field, value string) (uint16, error) {
+	n, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': must be a number between 0 and 65535", field, value)
+	}
+	return uint16(n), nil
+}
+
+// checkCAATag checks if the CAA tag is made only of ASCII letters and numbers
+func checkCAATag(tag string) error {
+	if len(tag) > 15 {
+		return fmt.Errorf("invalid CAA tag '%s': must have at most 15 characters", tag)
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return fmt.Errorf("invalid CAA tag '%s': the character '%c' is not allowed", tag, c)
+		}
+	}
+	return nil
+}
+
+// checkDomainName checks if the field of a record value holds a valid domain name.
+// The root domain "." is only accepted when allowRoot is set
+func checkDomainName(field, name string, allowRoot bool) error {
+	if name == "." {
+		if allowRoot {
+			return nil
+		}
+		return fmt.Errorf("invalid %s '%s': the root domain is not allowed", field, name)
+	}
+	unFqdn := UnFqdn(name)
+	if unFqdn == "" || len(unFqdn) > 253 {
+		return fmt.Errorf("invalid %s '%s': must have between 1 and 253 characters", field, name)
+	}
+	for _, label := range strings.Split(unFqdn, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("invalid %s '%s': each label must have between 1 and 63 characters", field, name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("invalid %s '%s': the character '%c' is not allowed", field, name, c)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package azure
+
+import (
+	"testing"
+)
+
+func TestParseMX(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		value    string
+		expected MXValue
+		errMsg   string
+	}{
+		{"valid", "10 mail.test.com.", MXValue{10, "mail.test.com."}, ""},
+		{"extra spaces", "  0   mail.test.com ", MXValue{0, "mail.test.com"}, ""},
+		{"highest preference", "65535 mail.test.com", MXValue{65535, "mail.test.com"}, ""},
+		{"missing preference", "mail.test.com", MXValue{}, "invalid MX value 'mail.test.com': must obey the following pattern: '<preference> <exchange>'"},
+		{"too many fields", "10 mail.test.com extra", MXValue{}, "invalid MX value '10 mail.test.com extra': must obey the following pattern: '<preference> <exchange>'"},
+		{"negative preference", "-1 mail.test.com", MXValue{}, "invalid MX preference '-1': must be a number between 0 and 65535"},
+		{"preference out of range", "65536 mail.test.com", MXValue{}, "invalid MX preference '65536': must be a number between 0 and 65535"},
+		{"root exchange", "10 .", MXValue{}, "invalid MX exchange '.': the root domain is not allowed"},
+		{"invalid exchange", "10 mail..test.com", MXValue{}, "invalid MX exchange 'mail..test.com': each label must have between 1 and 63 characters"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := ParseMX(tt.value)
+			checkParseError(t, err, tt.errMsg)
+			if err == nil && got != tt.expected {
+				t.Errorf("ParseMX() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSRV(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		value    string
+		expected SRVValue
+		errMsg   string
+	}{
+		{"valid", "10 5 5060 sip.test.com.", SRVValue{10, 5, 5060, "sip.test.com."}, ""},
+		{"service not available", "0 0 0 .", SRVValue{0, 0, 0, "."}, ""},
+		{"missing fields", "10 5 sip.test.com", SRVValue{}, "invalid SRV value '10 5 sip.test.com': must obey the following pattern: '<priority> <weight> <port> <target>'"},
+		{"invalid priority", "a 5 5060 sip.test.com", SRVValue{}, "invalid SRV priority 'a': must be a number between 0 and 65535"},
+		{"invalid weight", "10 70000 5060 sip.test.com", SRVValue{}, "invalid SRV weight '70000': must be a number between 0 and 65535"},
+		{"invalid port", "10 5 -5060 sip.test.com", SRVValue{}, "invalid SRV port '-5060': must be a number between 0 and 65535"},
+		{"invalid target", "10 5 5060 sip@test.com", SRVValue{}, "invalid SRV target 'sip@test.com': the character '@' is not allowed"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := ParseSRV(tt.value)
+			checkParseError(t, err, tt.errMsg)
+			if err == nil && got != tt.expected {
+				t.Errorf("ParseSRV() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCAA(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		value    string
+		expected CAAValue
+		errMsg   string
+	}{
+		{"quoted", `0 issue "letsencrypt.org"`, CAAValue{0, "issue", "letsencrypt.org"}, ""},
+		{"unquoted", `128 issuewild ;`, CAAValue{128, "issuewild", ";"}, ""},
+		{"quoted with spaces", `0 iodef "mailto:security@test.com; extra"`, CAAValue{0, "iodef", "mailto:security@test.com; extra"}, ""},
+		{"empty quoted value", `0 issue ""`, CAAValue{0, "issue", ""}, ""},
+		{"missing value", `0 issue`, CAAValue{}, `invalid CAA value '0 issue': must obey the following pattern: '<flags> <tag> "<value>"'`},
+		{"flags out of range", `256 issue "letsencrypt.org"`, CAAValue{}, "invalid CAA flags '256': must be a number between 0 and 255"},
+		{"invalid flags", `x issue "letsencrypt.org"`, CAAValue{}, "invalid CAA flags 'x': must be a number between 0 and 255"},
+		{"invalid tag", `0 is-sue "letsencrypt.org"`, CAAValue{}, "invalid CAA tag 'is-sue': the character '-' is not allowed"},
+		{"tag too long", `0 issueissueissue1 "letsencrypt.org"`, CAAValue{}, "invalid CAA tag 'issueissueissue1': must have at most 15 characters"},
+		{"missing closing quote", `0 issue "letsencrypt.org`, CAAValue{}, `invalid CAA value '"letsencrypt.org': missing closing quote`},
+		{"unquoted spaces", `0 issue lets encrypt`, CAAValue{}, "invalid CAA value 'lets encrypt': values holding spaces must be quoted"},
+		{"inner quotes", `0 issue "lets"encrypt"`, CAAValue{}, `invalid CAA value 'lets"encrypt': quotes are not allowed inside the value`},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := ParseCAA(tt.value)
+			checkParseError(t, err, tt.errMsg)
+			if err == nil && got != tt.expected {
+				t.Errorf("ParseCAA() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCAAValueRoundTrip(t *testing.T) {
+	for _, value := range []string{`0 issue "letsencrypt.org"`, `128 iodef "mailto:security@test.com"`, `0 issue ""`} {
+		caa, err := ParseCAA(value)
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if got := caa.String(); got != value {
+			t.Errorf("String() = %v, want %v", got, value)
+		}
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	testCases := []struct {
+		recordType string
+		value      string
+		expected   string
+	}{
+		{"A", " 10.0.0.1 ", "10.0.0.1"},
+		{"MX", "10   mail.test.com", "10 mail.test.com"},
+		{"SRV", " 10 5  5060 sip.test.com", "10 5 5060 sip.test.com"},
+		{"CAA", "0  issue letsencrypt.org", `0 issue "letsencrypt.org"`},
+		{"A", " " + publicIPID + " ", publicIPID},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.recordType, func(t *testing.T) {
+			got, err := NormalizeValue(tt.recordType, tt.value)
+			if err != nil || got != tt.expected {
+				t.Errorf("NormalizeValue() = %v, %v, want %v", got, err, tt.expected)
+			}
+		})
+	}
+
+	if _, err := NormalizeValue("SRV", "10 5 sip.test.com"); err == nil {
+		t.Errorf("Expecting an error for an invalid SRV value")
+	}
+	if _, err := NormalizeValue("CNAME", "/subscriptions/sub-value/resourceGroups/rg-value"); err == nil {
+		t.Errorf("Expecting an error for an invalid Azure resource ID")
+	}
+}
+
+func TestCheckResourceID(t *testing.T) {
+	testCases := []struct {
+		id    string
+		valid bool
+	}{
+		{publicIPID, true},
+		{"/subscriptions/sub-value/resourceGroups/rg-value/providers/Microsoft.Network/frontDoors/fd-value", true},
+		{"/subscriptions/sub-value/resourcegroups/rg-value/providers/Microsoft.Network/trafficManagerProfiles/tm-value", true},
+		{"/subscriptions/sub-value/resourceGroups/rg-value", false},
+		{"/subscriptions/sub-value/resourceGroups/rg-value/providers/Microsoft.Network/publicIPAddresses", false},
+		{"/subscriptions/sub-value/groups/rg-value/providers/Microsoft.Network/publicIPAddresses/ip-value", false},
+		{"/subscriptions//resourceGroups/rg-value/providers/Microsoft.Network/publicIPAddresses/ip-value", false},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.id, func(t *testing.T) {
+			if err := checkResourceID(tt.id); (err == nil) != tt.valid {
+				t.Errorf("checkResourceID() = %v, want valid=%v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func checkParseError(t *testing.T, err error, errMsg string) {
+	t.Helper()
+	if errMsg == "" {
+		if err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+		return
+	}
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("got error %v, want %v", err, errMsg)
+	}
+}
@@ -0,0 +1,330 @@
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// supportedRecordTypes are the record types that can be managed
+var supportedRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CAA":   true,
+	"CNAME": true,
+	"MX":    true,
+	"NS":    true,
+	"PTR":   true,
+	"SRV":   true,
+	"TXT":   true,
+}
+
+// checkRecordType checks if the record type can be managed
+func checkRecordType(recordType string) error {
+	if !supportedRecordTypes[recordType] {
+		return fmt.Errorf("record type %s not supported", recordType)
+	}
+	return nil
+}
+
+// SingleValued tells if a record set of the given type holds at most one value
+func SingleValued(recordType string) bool {
+	return recordType == "CNAME"
+}
+
+// aliasRecordTypes are the record types whose record sets may point to an Azure resource
+var aliasRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+}
+
+// isAlias tells if the value of a record of the given type points to an Azure resource
+func isAlias(recordType, value string) bool {
+	return aliasRecordTypes[recordType] && IsAliasTarget(value)
+}
+
+// recordSetProperties builds the properties of a record set of the given type holding all the values
+func recordSetProperties(recordType string, values []string) (*dns.RecordSetProperties, error) {
+	for _, value := range values {
+		if !isAlias(recordType, value) {
+			continue
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("an alias record set must hold exactly one value, got %d", len(values))
+		}
+		return &dns.RecordSetProperties{
+			TargetResource: &dns.SubResource{ID: to.StringPtr(value)},
+		}, nil
+	}
+
+	var properties *dns.RecordSetProperties
+	switch recordType {
+	case "A":
+		records := make([]dns.ARecord, 0, len(values))
+		for i := range values {
+			records = append(records, dns.ARecord{Ipv4Address: &values[i]})
+		}
+		properties = &dns.RecordSetProperties{ARecords: &records}
+	case "AAAA":
+		records := make([]dns.AaaaRecord, 0, len(values))
+		for i := range values {
+			records = append(records, dns.AaaaRecord{Ipv6Address: &values[i]})
+		}
+		properties = &dns.RecordSetProperties{AaaaRecords: &records}
+	case "CAA":
+		records := make([]dns.CaaRecord, 0, len(values))
+		for _, value := range values {
+			caa, err := ParseCAA(value)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, dns.CaaRecord{
+				Flags: to.Int32Ptr(int32(caa.Flags)),
+				Tag:   to.StringPtr(caa.Tag),
+				Value: to.StringPtr(caa.Value),
+			})
+		}
+		properties = &dns.RecordSetProperties{CaaRecords: &records}
+	case "CNAME":
+		if len(values) != 1 {
+			return nil, fmt.Errorf("a CNAME record set must hold exactly one value, got %d", len(values))
+		}
+		properties = &dns.RecordSetProperties{
+			CnameRecord: &dns.CnameRecord{Cname: &values[0]},
+		}
+	case "MX":
+		records := make([]dns.MxRecord, 0, len(values))
+		for _, value := range values {
+			mx, err := ParseMX(value)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, dns.MxRecord{
+				Preference: to.Int32Ptr(int32(mx.Preference)),
+				Exchange:   to.StringPtr(mx.Exchange),
+			})
+		}
+		properties = &dns.RecordSetProperties{MxRecords: &records}
+	case "NS":
+		records := make([]dns.NsRecord, 0, len(values))
+		for i := range values {
+			records = append(records, dns.NsRecord{Nsdname: &values[i]})
+		}
+		properties = &dns.RecordSetProperties{NsRecords: &records}
+	case "PTR":
+		records := make([]dns.PtrRecord, 0, len(values))
+		for i := range values {
+			records = append(records, dns.PtrRecord{Ptrdname: &values[i]})
+		}
+		properties = &dns.RecordSetProperties{PtrRecords: &records}
+	case "SRV":
+		records := make([]dns.SrvRecord, 0, len(values))
+		for _, value := range values {
+			srv, err := ParseSRV(value)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, dns.SrvRecord{
+				Priority: to.Int32Ptr(int32(srv.Priority)),
+				Weight:   to.Int32Ptr(int32(srv.Weight)),
+				Port:     to.Int32Ptr(int32(srv.Port)),
+				Target:   to.StringPtr(srv.Target),
+			})
+		}
+		properties = &dns.RecordSetProperties{SrvRecords: &records}
+	case "TXT":
+		records := make([]dns.TxtRecord, 0, len(values))
+		for _, value := range values {
+			chunks := chunkTXT(value)
+			records = append(records, dns.TxtRecord{Value: &chunks})
+		}
+		properties = &dns.RecordSetProperties{TxtRecords: &records}
+	default:
+		return nil, fmt.Errorf("record type %s not supported", recordType)
+	}
+	return properties, nil
+}
+
+// recordSetValues extracts the values of the given type held by the record set properties
+func recordSetValues(recordType string, properties *dns.RecordSetProperties) (values []string) {
+	if properties == nil {
+		return
+	}
+	if properties.TargetResource != nil && to.String(properties.TargetResource.ID) != "" {
+		return []string{*properties.TargetResource.ID}
+	}
+	switch recordType {
+	case "A":
+		if properties.ARecords != nil {
+			for _, r := range *properties.ARecords {
+				values = appendNonEmpty(values, r.Ipv4Address)
+			}
+		}
+	case "AAAA":
+		if properties.AaaaRecords != nil {
+			for _, r := range *properties.AaaaRecords {
+				values = appendNonEmpty(values, r.Ipv6Address)
+			}
+		}
+	case "CAA":
+		if properties.CaaRecords != nil {
+			for _, r := range *properties.CaaRecords {
+				if r.Tag != nil {
+					values = append(values, CAAValue{
+						Flags: uint8(to.Int32(r.Flags)),
+						Tag:   *r.Tag,
+						Value: to.String(r.Value),
+					}.String())
+				}
+			}
+		}
+	case "CNAME":
+		if properties.CnameRecord != nil {
+			values = appendNonEmpty(values, properties.CnameRecord.Cname)
+		}
+	case "MX":
+		if properties.MxRecords != nil {
+			for _, r := range *properties.MxRecords {
+				if r.Exchange != nil {
+					values = append(values, MXValue{
+						Preference: uint16(to.Int32(r.Preference)),
+						Exchange:   *r.Exchange,
+					}.String())
+				}
+			}
+		}
+	case "NS":
+		if properties.NsRecords != nil {
+			for _, r := range *properties.NsRecords {
+				values = appendNonEmpty(values, r.Nsdname)
+			}
+		}
+	case "PTR":
+		if properties.PtrRecords != nil {
+			for _, r := range *properties.PtrRecords {
+				values = appendNonEmpty(values, r.Ptrdname)
+			}
+		}
+	case "SRV":
+		if properties.SrvRecords != nil {
+			for _, r := range *properties.SrvRecords {
+				if r.Target != nil {
+					values = append(values, SRVValue{
+						Priority: uint16(to.Int32(r.Priority)),
+						Weight:   uint16(to.Int32(r.Weight)),
+						Port:     uint16(to.Int32(r.Port)),
+						Target:   *r.Target,
+					}.String())
+				}
+			}
+		}
+	case "TXT":
+		if properties.TxtRecords != nil {
+			for _, r := range *properties.TxtRecords {
+				if r.Value != nil {
+					value := strings.Join(*r.Value, "")
+					values = appendNonEmpty(values, &value)
+				}
+			}
+		}
+	}
+	return
+}
+
+// maxTXTStringLength is the maximum length in bytes of a character-string of a TXT record
+const maxTXTStringLength = 255
+
+// chunkTXT splits a TXT value into character-strings no longer than maxTXTStringLength bytes,
+// never breaking a multi-byte character apart
+func chunkTXT(value string) []string {
+	chunks := make([]string, 0, len(value)/maxTXTStringLength+1)
+	for len(value) > maxTXTStringLength {
+		i := maxTXTStringLength
+		for i > 0 && !utf8.RuneStart(value[i]) {
+			i--
+		}
+		chunks = append(chunks, value[:i])
+		value = value[i:]
+	}
+	return append(chunks, value)
+}
+
+// AddValue returns the values of a record set after the addition of value.
+// Record types holding a single value and alias record sets get it replaced
+func AddValue(recordType string, values []string, value string) []string {
+	if SingleValued(recordType) || isAlias(recordType, value) {
+		return []string{value}
+	}
+	for _, v := range values {
+		if isAlias(recordType, v) {
+			return []string{value}
+		}
+	}
+	if containsValue(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// SameValues tells if both record sets hold the same values in any order.
+// Alias targets are compared case insensitively, as Azure may change the case of resource IDs
+func SameValues(recordType string, values, others []string) bool {
+	if len(values) != len(others) {
+		return false
+	}
+	normalize := func(values []string) []string {
+		result := make([]string, 0, len(values))
+		for _, value := range values {
+			if normalized, err := NormalizeValue(recordType, value); err == nil {
+				value = normalized
+			}
+			if IsAliasTarget(value) {
+				value = strings.ToLower(value)
+			}
+			result = append(result, value)
+		}
+		sort.Strings(result)
+		return result
+	}
+	values, others = normalize(values), normalize(others)
+	for i := range values {
+		if values[i] != others[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeValue returns the values of a record set without value
+func removeValue(values []string, value string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// containsValue tells if value is one of values
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// appendNonEmpty appends the value to values unless it is empty
+func appendNonEmpty(values []string, value *string) []string {
+	if value == nil || *value == "" {
+		return values
+	}
+	return append(values, *value)
+}
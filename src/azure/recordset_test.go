@@ -0,0 +1,178 @@
+package azure
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordSetPropertiesAndValues(t *testing.T) {
+	testCases := []struct {
+		recordType string
+		values     []string
+	}{
+		{"A", []string{"10.0.0.1", "10.0.0.2"}},
+		{"AAAA", []string{"2001:db8::1", "2001:db8::2"}},
+		{"CAA", []string{`0 issue "letsencrypt.org"`, `128 iodef "mailto:security@test.com"`}},
+		{"CNAME", []string{"target.test.com"}},
+		{"MX", []string{"10 mail1.test.com", "20 mail2.test.com"}},
+		{"NS", []string{"ns1.test.com", "ns2.test.com"}},
+		{"PTR", []string{"host.test.com"}},
+		{"SRV", []string{"10 5 5060 sip1.test.com", "20 0 5060 sip2.test.com"}},
+		{"TXT", []string{"v=spf1 -all", "verification-token"}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.recordType, func(t *testing.T) {
+			properties, err := recordSetProperties(test.recordType, test.values)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got := recordSetValues(test.recordType, properties); !reflect.DeepEqual(got, test.values) {
+				t.Errorf("recordSetValues() = %v, want %v", got, test.values)
+			}
+		})
+	}
+}
+
+const publicIPID = "/subscriptions/sub-value/resourceGroups/rg-value/providers/Microsoft.Network/publicIPAddresses/ip-value"
+
+func TestAliasRecordSetProperties(t *testing.T) {
+	for _, recordType := range []string{"A", "AAAA", "CNAME"} {
+		t.Run(recordType, func(t *testing.T) {
+			properties, err := recordSetProperties(recordType, []string{publicIPID})
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if properties.TargetResource == nil || *properties.TargetResource.ID != publicIPID {
+				t.Errorf("Expecting the record set to point to the Azure resource. Got %v", properties.TargetResource)
+			}
+			if properties.ARecords != nil || properties.AaaaRecords != nil || properties.CnameRecord != nil {
+				t.Errorf("Expecting an alias record set to hold no literal values")
+			}
+			if got := recordSetValues(recordType, properties); !reflect.DeepEqual(got, []string{publicIPID}) {
+				t.Errorf("recordSetValues() = %v, want %v", got, []string{publicIPID})
+			}
+		})
+	}
+
+	if _, err := recordSetProperties("A", []string{"10.0.0.1", publicIPID}); err == nil {
+		t.Errorf("Expecting an error for an alias record set with many values")
+	}
+	properties, err := recordSetProperties("TXT", []string{publicIPID})
+	if err != nil || properties.TargetResource != nil {
+		t.Errorf("Expecting a TXT value to never point to an Azure resource. Got %v and error %v", properties, err)
+	}
+}
+
+func TestRecordSetPropertiesErrors(t *testing.T) {
+	if _, err := recordSetProperties("SOA", []string{"value"}); err == nil {
+		t.Errorf("Expecting an error for an unsupported record type")
+	}
+	if _, err := recordSetProperties("MX", []string{"mail.test.com"}); err == nil {
+		t.Errorf("Expecting an error for a MX record without preference")
+	}
+	if _, err := recordSetProperties("SRV", []string{"10 5 sip.test.com"}); err == nil {
+		t.Errorf("Expecting an error for a SRV record without port")
+	}
+	if _, err := recordSetProperties("CNAME", []string{"a.test.com", "b.test.com"}); err == nil {
+		t.Errorf("Expecting an error for a CNAME record set with many values")
+	}
+	if err := checkRecordType("SOA"); err == nil {
+		t.Errorf("Expecting an error for an unsupported record type")
+	}
+	if err := checkRecordType("A"); err != nil {
+		t.Errorf("Expecting no error for a supported record type, got %v", err)
+	}
+}
+
+func TestChunkTXT(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		value    string
+		expected []string
+	}{
+		{"short", "v=spf1 -all", []string{"v=spf1 -all"}},
+		{"exactly 255 bytes", strings.Repeat("a", 255), []string{strings.Repeat("a", 255)}},
+		{"256 bytes", strings.Repeat("a", 256), []string{strings.Repeat("a", 255), "a"}},
+		{"many chunks", strings.Repeat("a", 600), []string{strings.Repeat("a", 255), strings.Repeat("a", 255), strings.Repeat("a", 90)}},
+		{"multi-byte character at the boundary", strings.Repeat("a", 254) + "é", []string{strings.Repeat("a", 254), "é"}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := chunkTXT(tt.value); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("chunkTXT() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLongTXTRoundTrip(t *testing.T) {
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA", 12)
+	values := []string{dkim, "v=spf1 include:_spf.test.com -all", "verification-token"}
+
+	properties, err := recordSetProperties("TXT", values)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	records := *properties.TxtRecords
+	if len(records) != len(values) {
+		t.Fatalf("Expecting one TXT entry per value, got %d", len(records))
+	}
+	for _, s := range *records[0].Value {
+		if len(s) > 255 {
+			t.Errorf("Expecting character-strings no longer than 255 bytes, got %d", len(s))
+		}
+	}
+	if len(*records[0].Value) < 2 {
+		t.Errorf("Expecting the long TXT value to be split in many character-strings")
+	}
+	if got := recordSetValues("TXT", properties); !reflect.DeepEqual(got, values) {
+		t.Errorf("recordSetValues() = %v, want %v", got, values)
+	}
+}
+
+func TestAddValue(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		recordType string
+		values     []string
+		value      string
+		expected   []string
+	}{
+		{"empty record set", "A", nil, "10.0.0.1", []string{"10.0.0.1"}},
+		{"new value", "A", []string{"10.0.0.1"}, "10.0.0.2", []string{"10.0.0.1", "10.0.0.2"}},
+		{"existing value", "A", []string{"10.0.0.1", "10.0.0.2"}, "10.0.0.1", []string{"10.0.0.1", "10.0.0.2"}},
+		{"single valued", "CNAME", []string{"a.test.com"}, "b.test.com", []string{"b.test.com"}},
+		{"alias replaces values", "A", []string{"10.0.0.1", "10.0.0.2"}, publicIPID, []string{publicIPID}},
+		{"value replaces alias", "A", []string{publicIPID}, "10.0.0.1", []string{"10.0.0.1"}},
+		{"TXT is never an alias", "TXT", []string{"token"}, publicIPID, []string{"token", publicIPID}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := AddValue(tt.recordType, tt.values, tt.value); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("AddValue() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRemoveValue(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		values   []string
+		value    string
+		expected []string
+	}{
+		{"existing value", []string{"10.0.0.1", "10.0.0.2"}, "10.0.0.1", []string{"10.0.0.2"}},
+		{"nonexistent value", []string{"10.0.0.1"}, "10.0.0.2", []string{"10.0.0.1"}},
+		{"last value", []string{"10.0.0.1"}, "10.0.0.1", []string{}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := removeValue(tt.values, tt.value); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("removeValue() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy defines how the requests to Azure failing with transient errors are retried
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts of a request, the first one included; values below 1 mean a single attempt
+	Attempts int
+	// MinBackoff is the delay before the first retry, doubled on each retry
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts, unless Azure asks for a longer one with Retry-After
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay randomly added or subtracted, between 0 and 1
+	Jitter float64
+}
+
+// check checks if the policy values are in range; returns a set of error strings in case something is not right
+func (p RetryPolicy) check() (errs []string) {
+	if p.MinBackoff < 0 || p.MaxBackoff < 0 {
+		errs = append(errs, "The retry backoffs must not be negative")
+	} else if p.MaxBackoff > 0 && p.MinBackoff > p.MaxBackoff {
+		errs = append(errs, fmt.Sprintf("The retry min backoff %v must not be greater than the max backoff %v", p.MinBackoff, p.MaxBackoff))
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		errs = append(errs, fmt.Sprintf("The retry jitter %v must be between 0 and 1", p.Jitter))
+	}
+	return
+}
+
+// attempts returns the maximum number of attempts of a request
+func (p RetryPolicy) attempts() int {
+	if p.Attempts < 1 {
+		return 1
+	}
+	return p.Attempts
+}
+
+// backoff returns the delay before the retry following the attempt, counted from 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MinBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(delay))
+	}
+	return delay
+}
+
+// withRetries returns a context making the Azure SDK clients send their requests with the policy,
+// in place of their default retries
+func (p RetryPolicy) withRetries(ctx context.Context) context.Context {
+	return autorest.WithSendDecorators(ctx, []autorest.SendDecorator{func(s autorest.Sender) autorest.Sender {
+		return newRetrySender(p, s)
+	}})
+}
+
+// retrySender sends the requests to Azure, retrying the ones failing with transient errors
+type retrySender struct {
+	policy RetryPolicy
+	sender autorest.Sender
+}
+
+// newRetrySender wraps the sender, retrying its requests according to the policy
+func newRetrySender(policy RetryPolicy, sender autorest.Sender) *retrySender {
+	return &retrySender{policy: policy, sender: sender}
+}
+
+// Do sends the request until it succeeds, fails with a permanent error or runs out of attempts
+func (rs *retrySender) Do(r *http.Request) (resp *http.Response, err error) {
+	rr := autorest.NewRetriableRequest(r)
+	attempts := rs.policy.attempts()
+	for attempt := 1; ; attempt++ {
+		if err = rr.Prepare(); err != nil {
+			return
+		}
+		resp, err = rs.sender.Do(rr.Request())
+		if !isTransient(resp, err) || attempt >= attempts {
+			if attempt > 1 {
+				logrus.Infof("Azure request %s %s completed after %d attempts: %s", r.Method, r.URL.Path, attempt, outcome(resp, err))
+			}
+			return
+		}
+
+		delay, hinted := retryAfter(resp)
+		if !hinted {
+			delay = rs.policy.backoff(attempt)
+		}
+		logrus.Warnf("Azure request %s %s failed on attempt %d of %d: %s; retrying in %v", r.Method, r.URL.Path, attempt, attempts, outcome(resp, err), delay)
+		drain(resp)
+		if err = sleep(r.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isTransient tells if the request failed with an error worth retrying: throttling, server errors or a broken connection
+func isTransient(resp *http.Response, err error) bool {
+	if err != nil {
+		return isTransientError(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransientError tells if the request failed to be sent because of a broken connection or a timeout
+func isTransientError(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+			continue
+		case *net.OpError:
+			err = e.Err
+			continue
+		case *os.SyscallError:
+			err = e.Err
+			continue
+		case syscall.Errno:
+			return e == syscall.ECONNRESET || e == syscall.ECONNABORTED || e == syscall.ECONNREFUSED || e == syscall.EPIPE
+		case net.Error:
+			return e.Timeout() || e.Temporary()
+		}
+		return err == io.EOF || err == io.ErrUnexpectedEOF
+	}
+}
+
+// retryAfter returns the delay Azure asked for with the Retry-After header, given either in seconds or as a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// outcome describes how an attempt ended for the logs
+func outcome(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+// drain reads and closes the body of a response that is not handed over, so its connection can be reused
+func drain(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
+
+// sleep waits for the delay, returning early with an error when the context is done
+func sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
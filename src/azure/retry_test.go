@@ -0,0 +1,199 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// flakyHandler fails the first requests with the given behavior before handing them over to the next handler
+type flakyHandler struct {
+	failures int32
+	fail     func(w http.ResponseWriter, r *http.Request)
+	next     http.Handler
+	requests int32
+}
+
+func (h *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&h.requests, 1) <= h.failures {
+		h.fail(w, r)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// newRetryTestUpdater creates an AzUpdater retrying its requests to the server with the policy
+func newRetryTestUpdater(t *testing.T, server *httptest.Server, policy RetryPolicy) *AzUpdater {
+	t.Helper()
+	b := &Builder{SubscriptionID: "sub-value", ResourceGroup: "rg-value", Zone: "test.com", ResourceManagerEndpoint: server.URL, Retry: policy}
+	result, err := newUpdaterWithAuthorizer(b, autorest.NullAuthorizer{})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return result
+}
+
+func respondWith(status int, retryAfter string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		writeCloudError(w, status, http.StatusText(status), "transient failure")
+	}
+}
+
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
+
+func TestAzUpdater_Retry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	testCases := []struct {
+		name             string
+		failures         int32
+		fail             func(w http.ResponseWriter, r *http.Request)
+		expectedRequests int32
+		succeeds         bool
+	}{
+		{"throttled", 2, respondWith(http.StatusTooManyRequests, "0"), 4, true},
+		{"server error", 2, respondWith(http.StatusServiceUnavailable, ""), 4, true},
+		{"connection reset", 1, resetConnection, 3, true},
+		{"attempts exhausted", 3, respondWith(http.StatusInternalServerError, ""), 3, false},
+		{"bad request not retried", 1, respondWith(http.StatusBadRequest, ""), 1, false},
+		{"not implemented not retried", 1, respondWith(http.StatusNotImplemented, ""), 1, false},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &flakyHandler{failures: test.failures, fail: test.fail, next: newFakeARM()}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			azu := newRetryTestUpdater(t, server, policy)
+
+			// a GET followed by a PUT
+			err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute)
+			if test.succeeds && err != nil {
+				t.Errorf("Expecting AddRR to succeed after retrying. Got err '%v'", err)
+			}
+			if !test.succeeds && err == nil {
+				t.Errorf("Expecting AddRR to fail")
+			}
+			if got := atomic.LoadInt32(&handler.requests); got != test.expectedRequests {
+				t.Errorf("Expecting %d requests. Got %d", test.expectedRequests, got)
+			}
+		})
+	}
+}
+
+func TestAzUpdater_RetryHonorsRetryAfter(t *testing.T) {
+	handler := &flakyHandler{failures: 1, fail: respondWith(http.StatusTooManyRequests, "1"), next: newFakeARM()}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	azu := newRetryTestUpdater(t, server, RetryPolicy{Attempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	start := time.Now()
+	if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}, time.Minute); err != nil {
+		t.Fatalf("Expecting AddRR to succeed after retrying. Got err '%v'", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expecting the retry to wait for the second asked by Retry-After. Waited %v", elapsed)
+	}
+}
+
+func TestRetrySender_StopsWhenContextIsDone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(respondWith(http.StatusServiceUnavailable, "60")))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	sender := newRetrySender(RetryPolicy{Attempts: 5}, http.DefaultClient)
+
+	start := time.Now()
+	_, err := sender.Do(r.WithContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expecting the retries to stop with the context. Got err '%v'", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expecting the retries to stop right when the context is done. Took %v", elapsed)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := policy.backoff(attempt + 1); got != expected {
+			t.Errorf("backoff(%d) = %v, want %v", attempt+1, got, expected)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Expecting the jittered backoff to be between 1s and 3s. Got %v", got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		hinted   bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.value, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			resp.Header.Set("Retry-After", tt.value)
+			delay, hinted := retryAfter(resp)
+			if delay != tt.expected || hinted != tt.hinted {
+				t.Errorf("retryAfter() = %v, %v, want %v, %v", delay, hinted, tt.expected, tt.hinted)
+			}
+		})
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if delay, hinted := retryAfter(resp); !hinted || delay <= 50*time.Second || delay > time.Minute {
+		t.Errorf("Expecting the delay until the Retry-After date. Got %v", delay)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"connection reset", &url.Error{Op: "Get", URL: "https://management.azure.com", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"unexpected EOF", &url.Error{Op: "Get", URL: "https://management.azure.com", Err: io.EOF}, true},
+		{"canceled", &url.Error{Op: "Get", URL: "https://management.azure.com", Err: context.Canceled}, false},
+		{"certificate", &url.Error{Op: "Get", URL: "https://management.azure.com", Err: errors.New("x509: certificate signed by unknown authority")}, false},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.expected {
+				t.Errorf("isTransientError() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
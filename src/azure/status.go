@@ -0,0 +1,154 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// probeRecord is the relative name of the TXT record set written and deleted right away to check the write permission on a zone
+	probeRecord = "_bindman-probe"
+	probeValue  = "bindman write permission probe"
+)
+
+// ZoneStatus reports the result of the check of a managed zone
+type ZoneStatus struct {
+	Zone           string `json:"zone"`
+	Type           string `json:"type"`
+	ResourceGroup  string `json:"resourceGroup"`
+	SubscriptionID string `json:"subscriptionId"`
+	// Checked tells if the zone was checked; the fields below are left empty when it was not
+	Checked   bool       `json:"checked"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+	// Exists tells if the zone was found in its resource group
+	Exists bool `json:"exists"`
+	// Writable tells if Bindman succeeded in writing and deleting a record set of the zone
+	Writable bool `json:"writable"`
+	// NameServers are the name servers the zone must be delegated to; none for private zones
+	NameServers []string `json:"nameServers,omitempty"`
+	// Error tells what went wrong and how to fix it
+	Error string `json:"error,omitempty"`
+}
+
+// Failed tells if the zone was checked and found unusable
+func (s ZoneStatus) Failed() bool {
+	return s.Error != ""
+}
+
+// CheckZones checks that every managed zone exists and that Bindman is allowed to write to it, probing the write permission
+// with a TXT record set deleted right away. The results are kept for ZoneStatuses; an error lists the zones failing the check
+func (azu *AzUpdater) CheckZones(ctx context.Context) ([]ZoneStatus, error) {
+	ctx = azu.Retry.withRetries(ctx)
+	var statuses []ZoneStatus
+	var errs []string
+	for _, zone := range azu.zones() {
+		status := azu.checkZone(ctx, zone, azu.clients[zone.Name])
+		if status.Failed() {
+			errs = append(errs, status.Error)
+		} else if len(status.NameServers) > 0 {
+			logrus.Infof("Zone %s checked; it must be delegated to the name servers %s", zone.Name, strings.Join(status.NameServers, ", "))
+		} else {
+			logrus.Infof("Zone %s checked", zone.Name)
+		}
+		statuses = append(statuses, status)
+	}
+
+	azu.statusLock.Lock()
+	azu.statuses = map[string]ZoneStatus{}
+	for _, status := range statuses {
+		azu.statuses[status.Zone] = status
+	}
+	azu.statusLock.Unlock()
+
+	if len(errs) > 0 {
+		return statuses, fmt.Errorf("Errors encountered:\n\t%v", strings.Join(errs, "\n\t"))
+	}
+	return statuses, nil
+}
+
+// ZoneStatuses returns the status of every managed zone as of the last call to CheckZones
+func (azu *AzUpdater) ZoneStatuses() []ZoneStatus {
+	azu.statusLock.RLock()
+	defer azu.statusLock.RUnlock()
+
+	var statuses []ZoneStatus
+	for _, zone := range azu.zones() {
+		status, checked := azu.statuses[zone.Name]
+		if !checked {
+			status = azu.uncheckedStatus(zone)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// uncheckedStatus returns the status of a zone not checked yet
+func (azu *AzUpdater) uncheckedStatus(zone ZoneConfig) ZoneStatus {
+	return ZoneStatus{Zone: zone.Name, Type: azu.zoneType(), ResourceGroup: zone.ResourceGroup, SubscriptionID: zone.SubscriptionID}
+}
+
+// checkZone reads the zone and probes the write permission on it
+func (azu *AzUpdater) checkZone(ctx context.Context, zone ZoneConfig, client recordSets) ZoneStatus {
+	status := azu.uncheckedStatus(zone)
+	now := time.Now().UTC()
+	status.Checked, status.CheckedAt = true, &now
+
+	nameServers, err := client.getZone(ctx)
+	if err != nil {
+		status.Error = azu.zoneError(zone, "read", err)
+		return status
+	}
+	status.Exists, status.NameServers = true, nameServers
+
+	if err = azu.probe(ctx, client); err != nil {
+		status.Error = azu.zoneError(zone, "write to", err)
+		return status
+	}
+	status.Writable = true
+	return status
+}
+
+// probe writes and deletes a TXT record set of the zone
+func (azu *AzUpdater) probe(ctx context.Context, client recordSets) error {
+	properties, err := recordSetProperties("TXT", []string{probeValue})
+	if err != nil {
+		return err
+	}
+	properties.TTL = to.Int64Ptr(60)
+	properties.Metadata = azu.stamp(nil, time.Now())
+	rs := dns.RecordSet{Name: to.StringPtr(probeRecord), RecordSetProperties: properties}
+	if _, err = client.createOrUpdate(ctx, probeRecord, "TXT", rs, "", ""); err != nil {
+		return err
+	}
+	return client.delete(ctx, probeRecord, "TXT", "")
+}
+
+// zoneError describes why the action on the zone failed along with how to fix it
+func (azu *AzUpdater) zoneError(zone ZoneConfig, action string, err error) string {
+	switch statusCode(err) {
+	case http.StatusUnauthorized:
+		return fmt.Sprintf(`Bindman could not authenticate to %s the zone "%s"; check the Azure credentials and tenant: %v`, action, zone.Name, err)
+	case http.StatusForbidden:
+		role := "DNS Zone Contributor"
+		if azu.zoneType() == PrivateZone {
+			role = "Private DNS Zone Contributor"
+		}
+		return fmt.Sprintf(`Bindman is not allowed to %s the zone "%s" of the resource group "%s"; grant its identity the "%s" role on the zone or on the resource group`, action, zone.Name, zone.ResourceGroup, role)
+	case http.StatusNotFound:
+		switch serviceErrorCode(err) {
+		case "SubscriptionNotFound":
+			return fmt.Sprintf(`The subscription "%s" of the zone "%s" was not found; check the subscription ID`, zone.SubscriptionID, zone.Name)
+		case "ResourceGroupNotFound":
+			return fmt.Sprintf(`The resource group "%s" of the zone "%s" was not found in the subscription "%s"; check the resource group name`, zone.ResourceGroup, zone.Name, zone.SubscriptionID)
+		}
+		return fmt.Sprintf(`The %s zone "%s" was not found in the resource group "%s" of the subscription "%s"; check the zone name and type`, azu.zoneType(), zone.Name, zone.ResourceGroup, zone.SubscriptionID)
+	}
+	return fmt.Sprintf(`Bindman could not %s the zone "%s": %v`, action, zone.Name, err)
+}
@@ -0,0 +1,148 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// denyHandler fails the requests of the method with the given behavior before handing the others over to the next handler
+type denyHandler struct {
+	method string
+	fail   func(w http.ResponseWriter, r *http.Request)
+	next   http.Handler
+}
+
+func (h *denyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == h.method {
+		h.fail(w, r)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+func TestAzUpdater_CheckZones(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdater(t, server)
+
+	if statuses := azu.ZoneStatuses(); len(statuses) != 1 || statuses[0].Checked {
+		t.Fatalf("Expecting the zone to be reported as unchecked before CheckZones. Got %+v", statuses)
+	}
+
+	statuses, err := azu.CheckZones(context.Background())
+	if err != nil {
+		t.Fatalf("Expecting CheckZones to succeed. Got err '%v'", err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("Expecting the status of the single managed zone. Got %+v", statuses)
+	}
+	status := statuses[0]
+	if !status.Checked || !status.Exists || !status.Writable || status.Failed() || status.CheckedAt == nil {
+		t.Errorf("Expecting the zone to be found writable. Got %+v", status)
+	}
+	if !reflect.DeepEqual(status.NameServers, arm.nameServers) {
+		t.Errorf("Expecting the name servers of the zone. Got %v", status.NameServers)
+	}
+	if _, found := arm.recordSet(probeRecord, "TXT"); found {
+		t.Errorf("Expecting the probe record set to be deleted")
+	}
+	expectedRequests := []string{"GET " + arm.zonePath(), "PUT " + arm.recordSetPath(probeRecord, "TXT"), "DELETE " + arm.recordSetPath(probeRecord, "TXT")}
+	if !reflect.DeepEqual(arm.requests, expectedRequests) {
+		t.Errorf("Expecting the requests %v. Got %v", expectedRequests, arm.requests)
+	}
+	if got := azu.ZoneStatuses(); !reflect.DeepEqual(got, statuses) {
+		t.Errorf("Expecting ZoneStatuses to return the result of the last check. Got %+v", got)
+	}
+}
+
+func TestAzUpdater_CheckPrivateZones(t *testing.T) {
+	arm := newFakePrivateARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	azu := newTestUpdaterOfZoneType(t, server, PrivateZone)
+
+	statuses, err := azu.CheckZones(context.Background())
+	if err != nil {
+		t.Fatalf("Expecting CheckZones to succeed. Got err '%v'", err)
+	}
+	if status := statuses[0]; !status.Exists || !status.Writable || len(status.NameServers) != 0 || status.Type != PrivateZone {
+		t.Errorf("Expecting the private zone to be found writable. Got %+v", status)
+	}
+}
+
+func TestAzUpdater_CheckZonesFailures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		handler  func(arm *fakeARM) http.Handler
+		exists   bool
+		expected string
+	}{
+		{
+			"zone not found",
+			func(arm *fakeARM) http.Handler {
+				arm.nameServers = nil
+				return arm
+			},
+			false,
+			`The public zone "test.com" was not found in the resource group "rg-value" of the subscription "sub-value"`,
+		},
+		{
+			"resource group not found",
+			func(arm *fakeARM) http.Handler {
+				return &denyHandler{method: http.MethodGet, next: arm, fail: func(w http.ResponseWriter, r *http.Request) {
+					writeCloudError(w, http.StatusNotFound, "ResourceGroupNotFound", "Resource group 'rg-value' could not be found.")
+				}}
+			},
+			false,
+			`The resource group "rg-value" of the zone "test.com" was not found in the subscription "sub-value"`,
+		},
+		{
+			"read forbidden",
+			func(arm *fakeARM) http.Handler {
+				return &denyHandler{method: http.MethodGet, next: arm, fail: respondWith(http.StatusForbidden, "")}
+			},
+			false,
+			`Bindman is not allowed to read the zone "test.com" of the resource group "rg-value"; grant its identity the "DNS Zone Contributor" role`,
+		},
+		{
+			"write forbidden",
+			func(arm *fakeARM) http.Handler {
+				return &denyHandler{method: http.MethodPut, next: arm, fail: respondWith(http.StatusForbidden, "")}
+			},
+			true,
+			`Bindman is not allowed to write to the zone "test.com"`,
+		},
+		{
+			"delete forbidden",
+			func(arm *fakeARM) http.Handler {
+				return &denyHandler{method: http.MethodDelete, next: arm, fail: respondWith(http.StatusForbidden, "")}
+			},
+			true,
+			`Bindman is not allowed to write to the zone "test.com"`,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler(newFakeARM()))
+			defer server.Close()
+			azu := newTestUpdater(t, server)
+
+			statuses, err := azu.CheckZones(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expecting CheckZones to fail with '%s'. Got err '%v'", tt.expected, err)
+			}
+			status := statuses[0]
+			if !status.Failed() || status.Writable || status.Exists != tt.exists {
+				t.Errorf("Expecting the zone to be reported as failed. Got %+v", status)
+			}
+			if got := azu.ZoneStatuses(); !reflect.DeepEqual(got, statuses) {
+				t.Errorf("Expecting ZoneStatuses to return the result of the last check. Got %+v", got)
+			}
+		})
+	}
+}
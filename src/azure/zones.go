@@ -0,0 +1,140 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// ZoneConfig defines a managed zone along with the resource group and subscription holding it.
+// The resource group and subscription of the Builder are used when empty
+type ZoneConfig struct {
+	Name           string
+	ResourceGroup  string
+	SubscriptionID string
+}
+
+// ParseZones parses a comma separated list of zones, each one written as <zone>[:<resource group>[:<subscription>]]
+func ParseZones(value string) (zones []ZoneConfig) {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, ":", 3)
+		zone := ZoneConfig{Name: strings.TrimSpace(fields[0])}
+		if len(fields) > 1 {
+			zone.ResourceGroup = strings.TrimSpace(fields[1])
+		}
+		if len(fields) > 2 {
+			zone.SubscriptionID = strings.TrimSpace(fields[2])
+		}
+		zones = append(zones, zone)
+	}
+	return
+}
+
+// String formats the zone the way ParseZones reads it
+func (z ZoneConfig) String() string {
+	switch {
+	case z.SubscriptionID != "":
+		return z.Name + ":" + z.ResourceGroup + ":" + z.SubscriptionID
+	case z.ResourceGroup != "":
+		return z.Name + ":" + z.ResourceGroup
+	default:
+		return z.Name
+	}
+}
+
+// zones returns all the managed zones, the resource group and subscription of the Builder filling the ones left empty
+func (b *Builder) zones() []ZoneConfig {
+	var zones []ZoneConfig
+	if strings.TrimSpace(b.Zone) != "" {
+		zones = append(zones, ZoneConfig{Name: b.Zone})
+	}
+	zones = append(zones, b.Zones...)
+	for i := range zones {
+		if zones[i].ResourceGroup == "" {
+			zones[i].ResourceGroup = b.ResourceGroup
+		}
+		if zones[i].SubscriptionID == "" {
+			zones[i].SubscriptionID = b.SubscriptionID
+		}
+	}
+	return zones
+}
+
+// checkZones checks if every zone is named, held by a resource group and subscription and managed only once
+func (b *Builder) checkZones() (errs []string) {
+	errMsg := `The "%v" must be specified`
+	zones := b.zones()
+	missingSubscription, missingResourceGroup := false, false
+	if len(zones) == 0 {
+		errs = append(errs, fmt.Sprintf(errMsg, "DNS zone"))
+		missingSubscription = strings.TrimSpace(b.SubscriptionID) == ""
+		missingResourceGroup = strings.TrimSpace(b.ResourceGroup) == ""
+	}
+	seen := map[string]bool{}
+	for _, zone := range zones {
+		name := strings.TrimSpace(zone.Name)
+		if name == "" {
+			errs = append(errs, fmt.Sprintf(`The zone "%v" must obey the following pattern: <zone>[:<resource group>[:<subscription>]]`, zone))
+		} else if seen[UnFqdn(name)] {
+			errs = append(errs, fmt.Sprintf(`The zone "%v" must be specified only once`, name))
+		}
+		seen[UnFqdn(name)] = true
+		missingSubscription = missingSubscription || strings.TrimSpace(zone.SubscriptionID) == ""
+		missingResourceGroup = missingResourceGroup || strings.TrimSpace(zone.ResourceGroup) == ""
+	}
+	if missingSubscription {
+		errs = append(errs, fmt.Sprintf(errMsg, "SubscriptionID"))
+	}
+	if missingResourceGroup {
+		errs = append(errs, fmt.Sprintf(errMsg, "ResourceGroup"))
+	}
+	return
+}
+
+// checkName returns the managed zone the name belongs to: the zone itself or the one with the longest suffix of the name
+func (azu *AzUpdater) checkName(name string) (zone ZoneConfig, err error) {
+	zones := azu.zones()
+	found := false
+	for _, z := range zones {
+		if (name == z.Name || strings.HasSuffix(name, "."+z.Name)) && len(z.Name) > len(zone.Name) {
+			zone, found = z, true
+		}
+	}
+	if found {
+		return
+	}
+	if len(zones) == 1 {
+		err = types.BadRequestError(fmt.Sprintf("the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.%s'", name, zones[0].Name), nil)
+		return
+	}
+	names := make([]string, 0, len(zones))
+	for _, z := range zones {
+		names = append(names, z.Name)
+	}
+	err = types.BadRequestError(fmt.Sprintf("the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.<zone>', where <zone> is one of %s", name, strings.Join(names, ", ")), nil)
+	return
+}
+
+// ZoneOf returns the managed zone the record name belongs to; false when it belongs to none
+func (azu *AzUpdater) ZoneOf(name string) (string, bool) {
+	zone, err := azu.checkName(name)
+	if err != nil {
+		return "", false
+	}
+	return zone.Name, true
+}
+
+// ManagedZones returns the names of all the managed zones
+func (azu *AzUpdater) ManagedZones() []string {
+	zones := azu.zones()
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		names = append(names, zone.Name)
+	}
+	return names
+}
@@ -0,0 +1,146 @@
+package azure
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestParseZones(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected []ZoneConfig
+	}{
+		{"", nil},
+		{"test.com", []ZoneConfig{{Name: "test.com"}}},
+		{"test.com, other.com:other-rg ,,third.com:third-rg:third-sub", []ZoneConfig{
+			{Name: "test.com"},
+			{Name: "other.com", ResourceGroup: "other-rg"},
+			{Name: "third.com", ResourceGroup: "third-rg", SubscriptionID: "third-sub"},
+		}},
+		{"test.com::sub", []ZoneConfig{{Name: "test.com", SubscriptionID: "sub"}}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.value, func(t *testing.T) {
+			got := ParseZones(tt.value)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseZones() = %v, want %v", got, tt.expected)
+			}
+			for i, zone := range got {
+				if parsed := ParseZones(zone.String()); len(parsed) != 1 || parsed[0] != got[i] {
+					t.Errorf("Expecting String() to be parsed back into %v. Got %v", got[i], parsed)
+				}
+			}
+		})
+	}
+}
+
+func TestBuilder_checkZones(t *testing.T) {
+	testCases := []struct {
+		name     string
+		builder  Builder
+		expected []string
+	}{
+		{
+			"zones held by the default resource group and subscription",
+			Builder{SubscriptionID: "sub", ResourceGroup: "rg", Zone: "test.com", Zones: []ZoneConfig{{Name: "other.com"}}},
+			nil,
+		},
+		{
+			"zones held by their own resource group and subscription",
+			Builder{Zones: []ZoneConfig{{Name: "test.com", ResourceGroup: "rg", SubscriptionID: "sub"}, {Name: "other.com", ResourceGroup: "other-rg", SubscriptionID: "other-sub"}}},
+			nil,
+		},
+		{
+			"zone without resource group",
+			Builder{SubscriptionID: "sub", Zones: []ZoneConfig{{Name: "test.com", ResourceGroup: "rg"}, {Name: "other.com"}}},
+			[]string{`The "ResourceGroup" must be specified`},
+		},
+		{
+			"duplicated and unnamed zones",
+			Builder{SubscriptionID: "sub", ResourceGroup: "rg", Zone: "test.com", Zones: []ZoneConfig{{Name: "test.com."}, {ResourceGroup: "other-rg"}}},
+			[]string{`The zone "test.com." must be specified only once`, `The zone ":other-rg:sub" must obey the following pattern: <zone>[:<resource group>[:<subscription>]]`},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.checkZones(); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("checkZones() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAzUpdater_checkNameMultipleZones(t *testing.T) {
+	azUpdater := &AzUpdater{Builder: Builder{Zone: "test.com", Zones: []ZoneConfig{{Name: "sub.test.com"}, {Name: "other.com"}}}}
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"www.test.com", "test.com"},
+		{"test.com", "test.com"},
+		{"sub.test.com", "sub.test.com"},
+		{"www.sub.test.com", "sub.test.com"},
+		{"www.other.com", "other.com"},
+		{"www.another.com", ""},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			zone, ok := azUpdater.ZoneOf(tt.name)
+			if zone != tt.expected || ok != (tt.expected != "") {
+				t.Errorf("ZoneOf() = %v, %v, want %v", zone, ok, tt.expected)
+			}
+		})
+	}
+
+	_, err := azUpdater.checkName("www.another.com")
+	expected := hookTypes.BadRequestError("the record name 'www.another.com' is not allowed. Must obey the following pattern: '<subdomain>.<zone>', where <zone> is one of test.com, sub.test.com, other.com", nil)
+	if err == nil || err.Error() != expected.Error() {
+		t.Errorf("got = %v, want %v", err, expected)
+	}
+}
+
+func TestAzUpdater_RoutesRecordsToTheirZone(t *testing.T) {
+	arm := newFakeARM()
+	server := httptest.NewServer(arm)
+	defer server.Close()
+	b := &Builder{
+		SubscriptionID:          "sub-value",
+		ResourceGroup:           "rg-value",
+		Zone:                    "test.com",
+		Zones:                   []ZoneConfig{{Name: "sub.test.com", ResourceGroup: "sub-rg"}, {Name: "other.com", ResourceGroup: "other-rg", SubscriptionID: "other-sub"}},
+		ResourceManagerEndpoint: server.URL,
+	}
+	azu, err := newUpdaterWithAuthorizer(b, autorest.NullAuthorizer{})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	for _, name := range []string{"www.test.com", "www.sub.test.com", "other.com"} {
+		if err := azu.AddRR(context.Background(), hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}, time.Minute); err != nil {
+			t.Fatalf("Expecting AddRR of '%s' to succeed. Got err '%v'", name, err)
+		}
+	}
+	for _, path := range []string{
+		"/subscriptions/sub-value/resourceGroups/rg-value/providers/Microsoft.Network/dnsZones/test.com/A/www",
+		"/subscriptions/sub-value/resourceGroups/sub-rg/providers/Microsoft.Network/dnsZones/sub.test.com/A/www",
+		"/subscriptions/other-sub/resourceGroups/other-rg/providers/Microsoft.Network/dnsZones/other.com/A/@",
+	} {
+		if _, found := arm.recordSets[path]; !found {
+			t.Errorf("Expecting the record set '%s' to be written. Requests: %v", path, arm.requests)
+		}
+	}
+
+	if err := azu.RemoveRR(context.Background(), "www.sub.test.com", "A", ""); err != nil {
+		t.Fatalf("Expecting RemoveRR to succeed. Got err '%v'", err)
+	}
+	if len(arm.recordSets) != 2 {
+		t.Errorf("Expecting only the record set of the sub.test.com zone to be removed. Got %v", arm.recordSets)
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/admin"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	auditName   = "name"
+	auditType   = "type"
+	auditSource = "source"
+	auditSince  = "since"
+	auditUntil  = "until"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:     "audit",
+	Short:   "Lists the changes of the records recorded in the audit log of a running Bindman through its administration API",
+	Args:    cobra.NoArgs,
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		query := manager.AuditQuery{Name: viper.GetString(auditName), Type: viper.GetString(auditType), Source: viper.GetString(auditSource)}
+		var err error
+		if query.Since, err = parseTime(auditSince); err != nil {
+			return err
+		}
+		if query.Until, err = parseTime(auditUntil); err != nil {
+			return err
+		}
+		entries, err := newAdminClient().Audit(query)
+		if err != nil {
+			return err
+		}
+		printAuditEntries(entries)
+		return nil
+	},
+}
+
+// parseTime reads the flag as an RFC 3339 time, zero when unset
+func parseTime(flag string) (time.Time, error) {
+	value := viper.GetString(flag)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	result, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("the --%s flag must be an RFC 3339 time, e.g. 2019-10-01T12:00:00Z: %v", flag, err)
+	}
+	return result, nil
+}
+
+// printAuditEntries prints the audit entries as a table
+func printAuditEntries(entries []manager.AuditEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSOURCE\tACTION\tNAME\tTYPE\tOLD VALUES\tNEW VALUES\tOUTCOME\tERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format(time.RFC3339), entry.Source, entry.Action, entry.Name, entry.Type,
+			strings.Join(entry.OldValues, ","), strings.Join(entry.NewValues, ","), entry.Outcome, entry.Error)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().String(auditName, "", "Lists the changes of the record name only")
+	auditCmd.Flags().String(auditType, "", "Lists the changes of the record type only")
+	auditCmd.Flags().String(auditSource, "", "Lists the changes made by the source only: webhook, admin, async, removal, reconcile, gc or rollback")
+	auditCmd.Flags().String(auditSince, "", "Lists the changes made at or after the RFC 3339 time only")
+	auditCmd.Flags().String(auditUntil, "", "Lists the changes made before the RFC 3339 time only")
+	admin.AddClientFlags(auditCmd.Flags())
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Removes the record sets written by Bindman that are no longer in the local storage",
+	Example: `  bindman-azure-dns-manager gc --dry-run --gc-grace-period=48h
+
+  Takes the same Azure options as the serve command, --azure-instance-id being required. Record sets Bindman wrote
+  within the grace period are kept.`,
+	PreRunE: bindFlags,
+	RunE:    gcE,
+}
+
+func gcE(cmd *cobra.Command, _ []string) error {
+	azureBuilder := new(azure.Builder).InitFromViper(viper.GetViper())
+	managerBuilder := new(manager.Builder).InitFromViper(viper.GetViper())
+	managerBuilder.InstanceID = azureBuilder.InstanceID
+	nsu, err := azureBuilder.New()
+	if err != nil {
+		return fmt.Errorf("\n  Error occurred while setting up the DNS Manager.\n  %v", err)
+	}
+	azureManager, err := managerBuilder.New(nsu, basePath)
+	if err != nil {
+		return err
+	}
+	defer azureManager.Shutdown()
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	report, err := azureManager.CollectGarbage(context.Background(), dryRun || managerBuilder.GCDryRun)
+	if err != nil {
+		return fmt.Errorf("\n  Error occurred while collecting the orphaned records.\n  %v", err)
+	}
+	printRecords("Orphaned records", report.Orphans)
+	printRecords("Orphaned records within the grace period, kept", report.Recent)
+	if !report.DryRun {
+		printRecords("Removed records", report.Removed)
+	}
+	if len(report.Errors) > 0 {
+		fmt.Println("Errors:")
+		for _, e := range report.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+		return fmt.Errorf("%d orphaned records could not be removed", len(report.Errors))
+	}
+	return nil
+}
+
+// printRecords prints the records under the title
+func printRecords(title string, records []manager.Record) {
+	fmt.Printf("%s: %d\n", title, len(records))
+	for _, record := range records {
+		fmt.Printf("  %s %s %v\n", record.Name, record.Type, record.Values)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+
+	azure.AddFlags(gcCmd.Flags())
+	manager.AddFlags(gcCmd.Flags())
+	gcCmd.Flags().Bool("dry-run", false, "only lists the orphaned records, leaving the zones untouched")
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/admin"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Shows the history of the records of a running Bindman and rolls them back through its administration API",
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:     "show <name> <type>",
+	Short:   "Lists the versions of a record set, the oldest first",
+	Args:    cobra.ExactArgs(2),
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, args []string) error {
+		history, err := newAdminClient().History(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		printVersions(history...)
+		return nil
+	},
+}
+
+var historyRollbackCmd = &cobra.Command{
+	Use:     "rollback <name> <type> <version>",
+	Short:   "Writes back the values a record set held at a version of its history",
+	Args:    cobra.ExactArgs(3),
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, args []string) error {
+		version, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("the version must be a number of the history: %v", err)
+		}
+		result, err := newAdminClient().RollbackRecord(args[0], args[1], version)
+		if err != nil {
+			return err
+		}
+		printVersions(*result)
+		return nil
+	},
+}
+
+var historyRollbackZoneCmd = &cobra.Command{
+	Use:     "rollback-zone <zone> <time>",
+	Short:   "Rolls the record sets of a zone back to the values they held at an RFC 3339 time; all the zones when the zone is empty",
+	Args:    cobra.ExactArgs(2),
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		at, err := time.Parse(time.RFC3339, args[1])
+		if err != nil {
+			return fmt.Errorf("the time must be an RFC 3339 time, e.g. 2019-10-01T12:00:00Z: %v", err)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		report, err := newAdminClient().RollbackZone(args[0], at, dryRun)
+		if err != nil {
+			return err
+		}
+		printRollbackReport(report)
+		return nil
+	},
+}
+
+// printVersions prints the versions of a record set as a table
+func printVersions(versions ...manager.RecordVersion) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tTIME\tACTION\tVALUES\tTTL\tREMOVED")
+	for _, v := range versions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%v\n", v.Version, v.Time.Local().Format(time.RFC3339), v.Action, strings.Join(v.Values, ","), v.TTL, v.Removed)
+	}
+	_ = w.Flush()
+}
+
+// printRollbackReport prints the record sets changed by a rollback as a table, followed by the errors
+func printRollbackReport(report *manager.RollbackReport) {
+	if report.DryRun {
+		fmt.Println("Dry run: the record sets below would be rolled back")
+	}
+	records := make([]manager.Record, 0, len(report.Restored)+len(report.Removed)+len(report.Unknown))
+	records = append(append(append(records, report.Restored...), report.Removed...), report.Unknown...)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tVALUES\tCHANGE")
+	for i, record := range records {
+		change := "restored"
+		if i >= len(report.Restored)+len(report.Removed) {
+			change = "kept, history too short"
+		} else if i >= len(report.Restored) {
+			change = "removed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", record.Name, record.Type, strings.Join(record.Values, ","), change)
+	}
+	_ = w.Flush()
+	for _, e := range report.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyShowCmd, historyRollbackCmd, historyRollbackZoneCmd)
+
+	historyRollbackZoneCmd.Flags().Bool("dry-run", false, "only lists the record sets that would be rolled back, leaving them untouched")
+	admin.AddClientFlags(historyCmd.PersistentFlags())
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/admin"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// operationsCmd represents the operations command
+var operationsCmd = &cobra.Command{
+	Use:   "operations",
+	Short: "Tells the status of the asynchronous writes of a running Bindman through its administration API",
+}
+
+var operationsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the asynchronous writes, in the order they were submitted",
+	Args:    cobra.NoArgs,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		var query manager.OperationQuery
+		query.Name, _ = cmd.Flags().GetString("name")
+		query.Type, _ = cmd.Flags().GetString("type")
+		query.Status, _ = cmd.Flags().GetString("status")
+		operations, err := newAdminClient().Operations(query)
+		if err != nil {
+			return err
+		}
+		printOperations(operations...)
+		return nil
+	},
+}
+
+var operationsShowCmd = &cobra.Command{
+	Use:     "show <id>",
+	Short:   "Tells the status of an asynchronous write",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, args []string) error {
+		operation, err := newAdminClient().Operation(args[0])
+		if err != nil {
+			return err
+		}
+		printOperations(*operation)
+		return nil
+	},
+}
+
+// printOperations prints the operations as a table
+func printOperations(operations ...manager.Operation) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACTION\tNAME\tTYPE\tVALUE\tSTATUS\tATTEMPTS\tUPDATED AT\tERROR")
+	for _, op := range operations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", op.ID, op.Action, op.Record.Name, op.Record.Type, op.Record.Value,
+			op.Status, op.Attempts, op.UpdatedAt.Local().Format(time.RFC3339), op.Error)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(operationsCmd)
+	operationsCmd.AddCommand(operationsListCmd, operationsShowCmd)
+
+	operationsListCmd.Flags().String("name", "", "lists the writes of the record name only")
+	operationsListCmd.Flags().String("type", "", "lists the writes of the record type only")
+	operationsListCmd.Flags().String("status", "", "lists the writes of the status only: pending, applied or failed")
+	admin.AddClientFlags(operationsCmd.PersistentFlags())
+}
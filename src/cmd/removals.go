@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/admin"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// removalsCmd represents the removals command
+var removalsCmd = &cobra.Command{
+	Use:   "removals",
+	Short: "Lists, cancels or forces the delayed removals of a running Bindman through its administration API",
+}
+
+var removalsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the delayed removals in progress, the soonest due first",
+	Args:    cobra.NoArgs,
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		removals, err := newAdminClient().PendingRemovals()
+		if err != nil {
+			return err
+		}
+		printRemovals(removals...)
+		return nil
+	},
+}
+
+var removalsCancelCmd = &cobra.Command{
+	Use:     "cancel <name> <type>",
+	Short:   "Cancels the delayed removal of a record set, storing it back",
+	Args:    cobra.ExactArgs(2),
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, args []string) error {
+		removal, err := newAdminClient().CancelRemoval(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		printRemovals(*removal)
+		return nil
+	},
+}
+
+var removalsForceCmd = &cobra.Command{
+	Use:     "force <name> <type>",
+	Short:   "Removes a record set from the DNS server right away, whether its removal is pending or it is still stored",
+	Args:    cobra.ExactArgs(2),
+	PreRunE: bindFlags,
+	RunE: func(_ *cobra.Command, args []string) error {
+		removal, err := newAdminClient().ForceRemoval(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		printRemovals(*removal)
+		return nil
+	},
+}
+
+// newAdminClient creates a client of the administration API from the flags
+func newAdminClient() *admin.Client {
+	return new(admin.Client).InitFromViper(viper.GetViper())
+}
+
+// printRemovals prints the removals as a table
+func printRemovals(removals ...manager.Removal) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tVALUES\tDUE AT")
+	for _, removal := range removals {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", removal.Name, removal.Type, strings.Join(removal.Values, ","), removal.DueAt.Local().Format(time.RFC3339))
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(removalsCmd)
+	removalsCmd.AddCommand(removalsListCmd, removalsCancelCmd, removalsForceCmd)
+
+	admin.AddClientFlags(removalsCmd.PersistentFlags())
+}
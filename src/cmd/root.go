@@ -27,6 +27,11 @@ func init() {
 	cobra.OnInitialize(initConfig)
 }
 
+// bindFlags binds the flags of the command being run to viper, so that each command reads its own flags
+func bindFlags(cmd *cobra.Command, _ []string) error {
+	return viper.GetViper().BindPFlags(cmd.Flags())
+}
+
 // initConfig reads ENV variables if set.
 func initConfig() {
 	viper.SetEnvPrefix("BINDMAN")
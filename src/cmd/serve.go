@@ -1,18 +1,27 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/admin"
 	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
 	"github.com/labbsr0x/bindman-azure-dns-manager/src/manager"
 	"github.com/labbsr0x/bindman-azure-dns-manager/src/version"
-	"github.com/labbsr0x/bindman-dns-webhook/src/hook"
+	"github.com/labbsr0x/bindman-dns-webhook/src/hook/metrics"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const basePath = "./data"
 
+// adminShutdownTimeout bounds the wait for the administration requests in progress at shutdown
+const adminShutdownTimeout = 30 * time.Second
+
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
@@ -27,38 +36,99 @@ var serveCmd = &cobra.Command{
         ------------------------------------------------------------------
         --dns-removal-delay                 BINDMAN_DNS_REMOVAL_DELAY
 `,
-	RunE: runE,
+	PreRunE: bindFlags,
+	RunE:    runE,
 }
 
 func runE(_ *cobra.Command, _ []string) error {
 	azureBuilder := new(azure.Builder).InitFromViper(viper.GetViper())
 	managerBuilder := new(manager.Builder).InitFromViper(viper.GetViper())
+	managerBuilder.InstanceID = azureBuilder.InstanceID
+	adminBuilder := new(admin.Builder).InitFromViper(viper.GetViper())
 	nsu, err := azureBuilder.New()
 	if err != nil {
 		return fmt.Errorf("\n  Error occurred while setting up the DNS Manager.\n  %v", err)
 	}
+	if !azureBuilder.SkipZoneCheck {
+		if err = checkZones(nsu, managerBuilder.OperationTimeout); err != nil {
+			return fmt.Errorf("\n  Error occurred while checking the managed zones.\n  %v", err)
+		}
+	}
 	azureManager, err := managerBuilder.New(nsu, basePath)
 	if err != nil {
 		return err
 	}
+	adminServer, err := adminBuilder.New(azureManager, nsu)
+	if err != nil {
+		return err
+	}
 
 	logrus.New().WithFields(logrus.Fields{
 		"Version":   version.Version,
 		"GitCommit": version.GitCommit,
 		"BuildTime": version.BuildTime,
 	}).Info("bindman-azure-dns-manager version")
-	hook.Initialize(azureManager, version.Version)
+	if err = azureManager.ResumeRemovals(); err != nil {
+		logrus.Errorf("Error occurred while resuming the delayed removals: %v", err)
+	}
+	if err = azureManager.ReapplyRecords(); err != nil {
+		logrus.Errorf("Error occurred while re-applying the stored records: %v", err)
+	}
+	if err = azureManager.StartOperationWorkers(); err != nil {
+		logrus.Errorf("Error occurred while resuming the asynchronous writes: %v", err)
+	}
+	azureManager.StartReconciler()
+	azureManager.StartGarbageCollector()
+	webhook := admin.NewWebhook(azureManager, metrics.New(version.Version).HandleFunc)
+	stopped := make(chan struct{})
+	go func() {
+		if err := webhook.ListenAndServe(); err != nil {
+			logrus.Errorf("Error initializing the DNS Manager Webhook: %v", err)
+		}
+		close(stopped)
+	}()
+	if adminBuilder.Address != "" {
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil {
+				logrus.Errorf("Error initializing the administration API: %v", err)
+			}
+		}()
+	}
+
+	// the webhook serves until it fails or the process is stopped
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		logrus.Infof("Received %v; cancelling the DNS changes in progress", sig)
+	case <-stopped:
+	}
+	_ = webhook.Shutdown(context.Background())
+	// the administration requests in progress are drained while the storage and the audit log are still open
+	ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	if err := adminServer.Shutdown(ctx); err != nil {
+		logrus.Warnf("Administration requests still in progress at shutdown: %v", err)
+	}
+	cancel()
+	azureManager.Shutdown()
 	return nil
 }
 
+// checkZones checks the managed zones and the permission to write to them, giving up after timeout when it is set
+func checkZones(nsu *azure.AzUpdater, timeout time.Duration) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+	_, err := nsu.CheckZones(ctx)
+	return err
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 
 	azure.AddFlags(serveCmd.Flags())
 	manager.AddFlags(serveCmd.Flags())
-
-	err := viper.GetViper().BindPFlags(serveCmd.Flags())
-	if err != nil {
-		panic(err)
-	}
+	admin.AddFlags(serveCmd.Flags())
 }
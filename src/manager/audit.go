@@ -0,0 +1,319 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// the actions recorded by the audit log
+const (
+	// AuditAdd is the addition of a value to a record set
+	AuditAdd = "add"
+	// AuditUpdate is the replacement of all the values of a record set
+	AuditUpdate = "update"
+	// AuditRemoveValue is the removal of a single value from a record set
+	AuditRemoveValue = "remove-value"
+	// AuditScheduleRemoval is the removal of a record set from the local storage, scheduling its removal from the DNS server
+	AuditScheduleRemoval = "schedule-removal"
+	// AuditCancelRemoval is the cancellation of the delayed removal of a record set
+	AuditCancelRemoval = "cancel-removal"
+	// AuditDelete is the removal of a record set from the DNS server
+	AuditDelete = "delete"
+	// AuditRepair is the write back of a record set missing from the DNS server or modified there
+	AuditRepair = "repair"
+	// AuditRollback is the write back of the values a record set held at a version of its history
+	AuditRollback = "rollback"
+)
+
+// the outcomes of the actions recorded by the audit log
+const (
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// the sources of the changes recorded by the audit log
+const (
+	// SourceWebhook is a call of the webhook API
+	SourceWebhook = "webhook"
+	// SourceAdmin is a call of the administration API, e.g. to cancel or force a delayed removal
+	SourceAdmin = "admin"
+	// SourceAsync is a write queued by the webhook API and applied in the background
+	SourceAsync = "async"
+	// SourceRemoval is a delayed removal applied, or cancelled, when due
+	SourceRemoval = "removal"
+	// SourceReconcile is a reconciliation of the record sets with the DNS server
+	SourceReconcile = "reconcile"
+	// SourceGC is a garbage collection of the orphaned record sets
+	SourceGC = "gc"
+	// SourceRollback is a rollback of a record set or a zone to a version of its history
+	SourceRollback = "rollback"
+)
+
+// auditFileName is the name of the file of the audit log in the data directory; its rotated files are suffixed by a number
+const auditFileName = "audit.log"
+
+// AuditEntry records a change of a record set
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	// Source tells what made the change, e.g. SourceWebhook or SourceGC
+	Source string `json:"source,omitempty"`
+	// OldValues are the values of the record set before the change
+	OldValues []string `json:"oldValues,omitempty"`
+	// NewValues are the values of the record set after the change, or intended by the change when it failed
+	NewValues []string `json:"newValues,omitempty"`
+	// Message tells why the change was made when it was not requested, e.g. by a garbage collection
+	Message string `json:"message,omitempty"`
+	Outcome string `json:"outcome"`
+	// Error tells why the change failed, e.g. the error answered by the DNS server
+	Error string `json:"error,omitempty"`
+}
+
+// AuditQuery filters the audit entries; its zero value matches them all
+type AuditQuery struct {
+	// Name matches the entries of the record name, case insensitively
+	Name string
+	// Type matches the entries of the record type
+	Type string
+	// Source matches the entries of the changes made by the source, e.g. SourceWebhook
+	Source string
+	// Since matches the entries recorded at or after it, when set
+	Since time.Time
+	// Until matches the entries recorded before it, when set
+	Until time.Time
+}
+
+// AuditLog appends the audit entries to a file as JSON lines, rotating the file when it grows over MaxSize
+type AuditLog struct {
+	path string
+	// MaxSize is the size in bytes the file is rotated at; never rotated when zero
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int
+
+	door sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewAuditLog opens the audit log appending to the file at path
+func NewAuditLog(path string, maxSize int64, maxBackups int) (*AuditLog, error) {
+	a := &AuditLog{path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Append records the entry, rotating the file beforehand when it is full
+func (a *AuditLog) Append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.door.Lock()
+	defer a.door.Unlock()
+	if a.MaxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.MaxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// Query reads the entries matched by the query from the file and its rotated files, the oldest first
+func (a *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	a.door.Lock()
+	defer a.door.Unlock()
+
+	entries := []AuditEntry{}
+	for _, path := range append(a.backups(), a.path) {
+		if err := readAuditFile(path, func(entry AuditEntry) {
+			if q.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Close closes the file
+func (a *AuditLog) Close() error {
+	a.door.Lock()
+	defer a.door.Unlock()
+	return a.file.Close()
+}
+
+// open opens the file for appending; callers must hold the door
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// rotate renames the file to path.1, shifting the rotated files and dropping the ones over MaxBackups,
+// before opening a new file; callers must hold the door
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	for _, n := range a.backupNumbers() {
+		if n >= a.MaxBackups {
+			if err := os.Remove(a.backupPath(n)); err != nil {
+				return err
+			}
+		} else if err := os.Rename(a.backupPath(n), a.backupPath(n+1)); err != nil {
+			return err
+		}
+	}
+	if a.MaxBackups > 0 {
+		if err := os.Rename(a.path, a.backupPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(a.path); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+// backups returns the rotated files, the oldest first
+func (a *AuditLog) backups() []string {
+	var backups []string
+	for _, n := range a.backupNumbers() {
+		backups = append(backups, a.backupPath(n))
+	}
+	return backups
+}
+
+// backupNumbers returns the numbers of the rotated files, the oldest first
+func (a *AuditLog) backupNumbers() []int {
+	paths, _ := filepath.Glob(a.path + ".*")
+	var numbers []int
+	for _, path := range paths {
+		if n, err := strconv.Atoi(strings.TrimPrefix(path, a.path+".")); err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+	return numbers
+}
+
+// backupPath returns the path of the rotated file of the number
+func (a *AuditLog) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", a.path, n)
+}
+
+// readAuditFile calls fn with each entry of the file, skipping the lines that cannot be decoded
+func readAuditFile(path string, fn func(entry AuditEntry)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			fn(entry)
+		}
+	}
+	return scanner.Err()
+}
+
+// matches tells if the query matches the entry
+func (q AuditQuery) matches(entry AuditEntry) bool {
+	return (q.Name == "" || strings.EqualFold(azure.UnFqdn(q.Name), azure.UnFqdn(entry.Name))) &&
+		(q.Type == "" || strings.EqualFold(q.Type, entry.Type)) &&
+		(q.Source == "" || strings.EqualFold(q.Source, entry.Source)) &&
+		(q.Since.IsZero() || !entry.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || entry.Time.Before(q.Until))
+}
+
+// QueryAudit reads the audit entries matched by the query, the oldest first
+func (m *Manager) QueryAudit(q AuditQuery) ([]AuditEntry, error) {
+	return m.Audit.Query(q)
+}
+
+// audit records the change of a record set along with its outcome, logging the failures to record it
+func (m *Manager) audit(entry AuditEntry, err error) {
+	entry.Time, entry.Outcome = time.Now().UTC(), AuditSucceeded
+	if err != nil {
+		entry.Outcome, entry.Error = AuditFailed, auditError(err)
+	}
+	if err := m.Audit.Append(entry); err != nil {
+		logrus.Errorf("Error occurred while writing the audit log: %v", err)
+	}
+}
+
+// sourceKey is the key of the context value set by withSource
+type sourceKey struct{}
+
+// withSource returns a context telling the audit log the source of the changes made with it
+func withSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// sourceOf returns the source set by withSource; SourceWebhook when none was set
+func sourceOf(ctx context.Context) string {
+	if source, ok := ctx.Value(sourceKey{}).(string); ok {
+		return source
+	}
+	return SourceWebhook
+}
+
+// auditError tells why a change failed, preferring the error of the DNS server to the HTTP error wrapping it
+func auditError(err error) string {
+	if e, ok := err.(*hookTypes.Error); ok {
+		if e.Err != nil {
+			return e.Message + ": " + e.Err.Error()
+		}
+		return e.Message
+	}
+	return err.Error()
+}
+
+// storedValues returns the values of the stored record set; none when it is not stored
+func (m *Manager) storedValues(name, recordType string) []string {
+	m.Door.RLock()
+	defer m.Door.RUnlock()
+	if !m.HasDNSRecord(name, recordType) {
+		return nil
+	}
+	if r, err := m.readRecord(name, recordType); err == nil {
+		return r.Values
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestAuditLog_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-audit")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, auditFileName)
+	a, err := NewAuditLog(path, 400, 2)
+	if err != nil {
+		t.Fatalf("Expecting the audit log to be opened. Got err '%v'", err)
+	}
+
+	start := time.Now().UTC()
+	for i := 0; i < 20; i++ {
+		entry := AuditEntry{Time: start.Add(time.Duration(i) * time.Second), Action: AuditAdd, Name: fmt.Sprintf("test%d.test.com", i), Type: "A", Outcome: AuditSucceeded}
+		if err := a.Append(entry); err != nil {
+			t.Fatalf("Expecting the entry %d to be appended. Got err '%v'", i, err)
+		}
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if info, err := os.Stat(name); err != nil || info.Size() > 400 {
+			t.Errorf("Expecting the file '%s' to be kept under the maximum size. Got %v and err '%v'", name, info, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expecting only 2 rotated files to be kept. Got err '%v'", err)
+	}
+
+	entries, err := a.Query(AuditQuery{})
+	if err != nil || len(entries) == 0 || len(entries) == 20 {
+		t.Fatalf("Expecting the entries of the rotated files dropped to be lost. Got %d entries and err '%v'", len(entries), err)
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i-1].Time.Before(entries[i].Time) {
+			t.Errorf("Expecting the entries to be read the oldest first. Got %v before %v", entries[i-1].Time, entries[i].Time)
+		}
+	}
+	if last := entries[len(entries)-1]; last.Name != "test19.test.com" {
+		t.Errorf("Expecting the last entry to be kept. Got %+v", last)
+	}
+	_ = a.Close()
+
+	// the size of the file is known once opened again
+	a, _ = NewAuditLog(path, 400, 2)
+	defer a.Close()
+	if a.size == 0 {
+		t.Errorf("Expecting the size of the existing file to be taken into account")
+	}
+}
+
+func TestManagerAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-audit")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	updater := new(MockDNSUpdater)
+	m, _ := (&Builder{RemovalDelay: 50 * time.Millisecond}).New(updater, dir)
+	defer m.Shutdown()
+
+	start := time.Now()
+	for _, value := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := m.RemoveDNSRecordValue("www.test.com", "A", "10.0.0.3"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.4"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.RemoveDNSRecord("www.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.removalPending("www.test.com", "A") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	updater.Error = errors.New("azure: the DNS server is unavailable")
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.5"}); err == nil {
+		t.Fatalf("Expecting the addition to fail")
+	}
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "other.test.com", Type: "A", Value: "10.0.0.6"}); err == nil {
+		t.Fatalf("Expecting the addition to fail")
+	}
+
+	entries, err := m.QueryAudit(AuditQuery{Name: "WWW.test.com.", Type: "A", Since: start})
+	if err != nil {
+		t.Fatalf("Expecting the audit log to be queried. Got err '%v'", err)
+	}
+	expected := []AuditEntry{
+		{Action: AuditAdd, Name: "www.test.com", Type: "A", Source: SourceWebhook, NewValues: []string{"10.0.0.1"}, Outcome: AuditSucceeded},
+		{Action: AuditAdd, Name: "www.test.com", Type: "A", Source: SourceWebhook, OldValues: []string{"10.0.0.1"}, NewValues: []string{"10.0.0.1", "10.0.0.2"}, Outcome: AuditSucceeded},
+		{Action: AuditAdd, Name: "www.test.com", Type: "A", Source: SourceWebhook, OldValues: []string{"10.0.0.1", "10.0.0.2"}, NewValues: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, Outcome: AuditSucceeded},
+		{Action: AuditRemoveValue, Name: "www.test.com", Type: "A", Source: SourceWebhook, OldValues: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, NewValues: []string{"10.0.0.1", "10.0.0.2"}, Outcome: AuditSucceeded},
+		{Action: AuditUpdate, Name: "www.test.com", Type: "A", Source: SourceWebhook, OldValues: []string{"10.0.0.1", "10.0.0.2"}, NewValues: []string{"10.0.0.4"}, Outcome: AuditSucceeded},
+		{Action: AuditScheduleRemoval, Name: "www.test.com", Type: "A", Source: SourceWebhook, OldValues: []string{"10.0.0.4"}, Outcome: AuditSucceeded},
+		{Action: AuditDelete, Name: "www.test.com", Type: "A", Source: SourceRemoval, OldValues: []string{"10.0.0.4"}, Outcome: AuditSucceeded},
+		{Action: AuditAdd, Name: "www.test.com", Type: "A", Source: SourceWebhook, NewValues: []string{"10.0.0.5"}, Outcome: AuditFailed, Error: "azure: the DNS server is unavailable"},
+	}
+	for i := range entries {
+		if entries[i].Time.Before(start) {
+			t.Errorf("Expecting the time of the entry %d to be recorded. Got %v", i, entries[i].Time)
+		}
+		entries[i].Time, entries[i].Message = time.Time{}, ""
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expecting the entries\n%+v\nGot\n%+v", expected, entries)
+	}
+
+	if entries, err = m.QueryAudit(AuditQuery{Until: start}); err != nil || len(entries) != 0 {
+		t.Errorf("Expecting no entry before the start. Got %v and err '%v'", entries, err)
+	}
+	if entries, err = m.QueryAudit(AuditQuery{}); err != nil || len(entries) != 9 {
+		t.Errorf("Expecting the entries of all the records. Got %d and err '%v'", len(entries), err)
+	}
+	if entries, err = m.QueryAudit(AuditQuery{Source: SourceRemoval}); err != nil || len(entries) != 1 || entries[0].Action != AuditDelete {
+		t.Errorf("Expecting only the entry of the delayed removal. Got %+v and err '%v'", entries, err)
+	}
+}
+
+func TestManagerAuditSources(t *testing.T) {
+	b := &Builder{TTL: time.Hour, RemovalDelay: time.Hour, AsyncWrites: true, AsyncWorkers: 1, AsyncMaxAttempts: 1, AsyncRetention: time.Hour}
+	m, cleanup := newTestManager(t, b, newMockZone())
+	defer cleanup()
+	if err := m.StartOperationWorkers(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	for i, submit := range []func(hookTypes.DNSRecord) (*Operation, error){m.SubmitAddDNSRecord, m.SubmitUpdateDNSRecord} {
+		op, err := submit(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: fmt.Sprintf("10.0.0.%d", i+1)})
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if op = waitOperation(t, m, op.ID); op.Status != OperationApplied {
+			t.Fatalf("Expecting the operation to be applied. Got %+v", op)
+		}
+	}
+	if err := m.RemoveDNSRecord("www.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := m.CancelRemoval("www.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := m.RollbackRecord(context.Background(), "www.test.com", "A", 1); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	entries, err := m.QueryAudit(AuditQuery{})
+	if err != nil {
+		t.Fatalf("Expecting the audit log to be queried. Got err '%v'", err)
+	}
+	var sources []string
+	for _, entry := range entries {
+		sources = append(sources, entry.Action+" "+entry.Source)
+	}
+	expected := []string{"add async", "update async", "schedule-removal webhook", "cancel-removal admin", "rollback rollback"}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("Expecting the sources %v. Got %v", expected, sources)
+	}
+	if entries, err = m.QueryAudit(AuditQuery{Source: "ASYNC"}); err != nil || len(entries) != 2 {
+		t.Errorf("Expecting the entries of the asynchronous writes only. Got %+v and err '%v'", entries, err)
+	}
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltFileName is the name of the file of the BoltStore in the data directory
+	boltFileName = "bindman.db"
+	// boltOpenTimeout bounds the wait for the file of the BoltStore to be released by another process
+	boltOpenTimeout = 5 * time.Second
+)
+
+// boltBucket is the bucket holding all the keys in the file of the BoltStore
+var boltBucket = []byte("bindman")
+
+// boltStore keeps all the keys in a single bbolt file. Only one process can open the file at a time
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens the Store kept in the bbolt file at path, creating it when missing
+func NewBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Get(key string) (value []byte, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value, err = boltTx{tx.Bucket(boltBucket)}.Get(key)
+		return err
+	})
+	return
+}
+
+func (s *boltStore) Has(key string) (found bool) {
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		found = boltTx{tx.Bucket(boltBucket)}.Has(key)
+		return nil
+	})
+	return
+}
+
+func (s *boltStore) Put(key string, value []byte) error {
+	return s.Update(func(b Bucket) error { return b.Put(key, value) })
+}
+
+func (s *boltStore) Delete(key string) error {
+	return s.Update(func(b Bucket) error { return b.Delete(key) })
+}
+
+func (s *boltStore) List(suffix string) (keys []string, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		keys, err = boltTx{tx.Bucket(boltBucket)}.List(suffix)
+		return err
+	})
+	return
+}
+
+func (s *boltStore) Update(fn func(b Bucket) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx.Bucket(boltBucket)})
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// boltTx is the Bucket of a bbolt transaction
+type boltTx struct {
+	bucket *bolt.Bucket
+}
+
+func (b boltTx) Get(key string) ([]byte, error) {
+	value := b.bucket.Get([]byte(key))
+	if value == nil {
+		return nil, ErrNotFound
+	}
+	// the value is only valid during the transaction
+	return append([]byte{}, value...), nil
+}
+
+func (b boltTx) Has(key string) bool {
+	return b.bucket.Get([]byte(key)) != nil
+}
+
+func (b boltTx) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return b.bucket.Put([]byte(key), value)
+}
+
+func (b boltTx) Delete(key string) error {
+	return b.bucket.Delete([]byte(key))
+}
+
+func (b boltTx) List(suffix string) ([]string, error) {
+	var keys []string
+	err := b.bucket.ForEach(func(k, _ []byte) error {
+		if key := string(k); strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/peterbourgon/diskv"
+)
+
+// diskvStore keeps each key in its own file of a directory.
+// Its transactions are isolated but not atomic: a crash while applying one may leave part of its changes
+type diskvStore struct {
+	disk *diskv.Diskv
+	// door makes the transactions wait for each other and the changes wait for the transactions
+	door sync.RWMutex
+}
+
+// NewDiskvStore creates a Store keeping each key in its own file of the directory at basePath
+func NewDiskvStore(basePath string) Store {
+	return &diskvStore{
+		disk: diskv.New(diskv.Options{
+			BasePath:     basePath,
+			Transform:    func(s string) []string { return []string{} },
+			CacheSizeMax: 1024 * 1024,
+		}),
+	}
+}
+
+func (s *diskvStore) Get(key string) ([]byte, error) {
+	s.door.RLock()
+	defer s.door.RUnlock()
+	return s.get(key)
+}
+
+func (s *diskvStore) Has(key string) bool {
+	return s.disk.Has(key)
+}
+
+func (s *diskvStore) Put(key string, value []byte) error {
+	s.door.Lock()
+	defer s.door.Unlock()
+	return s.disk.Write(key, value)
+}
+
+func (s *diskvStore) Delete(key string) error {
+	s.door.Lock()
+	defer s.door.Unlock()
+	return s.delete(key)
+}
+
+func (s *diskvStore) List(suffix string) ([]string, error) {
+	s.door.RLock()
+	defer s.door.RUnlock()
+	return s.list(suffix)
+}
+
+func (s *diskvStore) Update(fn func(b Bucket) error) error {
+	s.door.Lock()
+	defer s.door.Unlock()
+
+	tx := &diskvTx{store: s, changes: map[string][]byte{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for key, value := range tx.changes {
+		var err error
+		if value == nil {
+			err = s.delete(key)
+		} else {
+			err = s.disk.Write(key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *diskvStore) Close() error {
+	return nil
+}
+
+// get reads the value of the key; callers must hold the door
+func (s *diskvStore) get(key string) ([]byte, error) {
+	value, err := s.disk.Read(key)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// delete removes the key; callers must hold the door
+func (s *diskvStore) delete(key string) error {
+	if err := s.disk.Erase(key); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// list returns the keys ending with suffix; callers must hold the door
+func (s *diskvStore) list(suffix string) (keys []string, err error) {
+	err = filepath.Walk(s.disk.BasePath, func(path string, info os.FileInfo, errr error) error {
+		if info != nil && !info.IsDir() && strings.HasSuffix(info.Name(), suffix) {
+			keys = append(keys, info.Name())
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return
+}
+
+// diskvTx holds the changes of a transaction until it is applied, nil values standing for the deleted keys
+type diskvTx struct {
+	store   *diskvStore
+	changes map[string][]byte
+}
+
+func (tx *diskvTx) Get(key string) ([]byte, error) {
+	if value, changed := tx.changes[key]; changed {
+		if value == nil {
+			return nil, ErrNotFound
+		}
+		return value, nil
+	}
+	return tx.store.get(key)
+}
+
+func (tx *diskvTx) Has(key string) bool {
+	if value, changed := tx.changes[key]; changed {
+		return value != nil
+	}
+	return tx.store.disk.Has(key)
+}
+
+func (tx *diskvTx) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	tx.changes[key] = value
+	return nil
+}
+
+func (tx *diskvTx) Delete(key string) error {
+	tx.changes[key] = nil
+	return nil
+}
+
+func (tx *diskvTx) List(suffix string) ([]string, error) {
+	stored, err := tx.store.list(suffix)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range stored {
+		if _, changed := tx.changes[key]; !changed {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range tx.changes {
+		if value != nil && strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -9,19 +9,83 @@ import (
 const (
 	dnsTtl                 = "dns-ttl"
 	dnsRemovalDelay        = "dns-removal-delay"
+	dnsOperationTimeout    = "dns-operation-timeout"
+	dnsVerifyUnchanged     = "dns-verify-unchanged"
+	reconcileInterval      = "reconcile-interval"
+	reconcileDryRun        = "reconcile-dry-run"
+	reconcileConcurrency   = "reconcile-concurrency"
+	reapplyOnStartup       = "reapply-on-startup"
+	gcInterval             = "gc-interval"
+	gcGracePeriod          = "gc-grace-period"
+	gcDryRun               = "gc-dry-run"
+	storeType              = "store"
+	auditMaxSize           = "audit-max-size"
+	auditMaxBackups        = "audit-max-backups"
+	historyMaxVersions     = "history-max-versions"
+	asyncWrites            = "async-writes"
+	asyncWorkers           = "async-workers"
+	asyncMaxAttempts       = "async-max-attempts"
+	asyncRetryDelay        = "async-retry-delay"
+	asyncRetention         = "async-retention"
 	defaultDnsTtl          = time.Hour
 	defaultDnsRemovalDelay = 10 * time.Minute
+	defaultDnsOpTimeout    = 2 * time.Minute
+	defaultConcurrency     = 4
+	defaultGCGracePeriod   = 24 * time.Hour
+	defaultAuditMaxSize    = 10
+	defaultAuditMaxBackups = 5
+	defaultHistoryVersions = 50
+	defaultAsyncWorkers    = 4
+	defaultAsyncAttempts   = 5
+	defaultAsyncRetryDelay = 10 * time.Second
+	defaultAsyncRetention  = 24 * time.Hour
 )
 
 // AddFlags adds flags for Options.
 func AddFlags(flags *pflag.FlagSet) {
 	flags.Duration(dnsTtl, defaultDnsTtl, "DNS recording rule expiration time (or time-to-live)")
 	flags.Duration(dnsRemovalDelay, defaultDnsRemovalDelay, "Delay in minutes to be applied to the removal of an DNS entry. This is to guarantee that in fact the removal should be processed.")
+	flags.Duration(dnsOperationTimeout, defaultDnsOpTimeout, "Maximum time to wait for each change of the DNS server, retries included. Zero means no limit.")
+	flags.Bool(dnsVerifyUnchanged, false, "Read back from the DNS server the records found unchanged in the local storage before skipping their write, writing them anyway when they differ there.")
+	flags.Duration(reconcileInterval, 0, "Time between two reconciliations of the stored records with the DNS server, writing back the missing and modified ones. Zero disables them.")
+	flags.Bool(reconcileDryRun, false, "Only report the differences found by the reconciliations, leaving the DNS server untouched.")
+	flags.Int(reconcileConcurrency, defaultConcurrency, "Maximum number of records written back to the DNS server at once by a reconciliation.")
+	flags.Bool(reapplyOnStartup, true, "Write back the stored records missing from the DNS server or modified there on startup, e.g. the ones never confirmed because of an outage.")
+	flags.Duration(gcInterval, 0, "Time between two garbage collections of the record sets written by Bindman but no longer stored, e.g. after the loss of the data volume. Zero disables them.")
+	flags.Duration(gcGracePeriod, defaultGCGracePeriod, "Time an orphaned record set is kept after Bindman last wrote it.")
+	flags.Bool(gcDryRun, false, "Only report the orphaned record sets found by the garbage collections, leaving the DNS server untouched.")
+	flags.Int(auditMaxSize, defaultAuditMaxSize, "Size in megabytes the audit log is rotated at. Zero disables the rotation.")
+	flags.Int(auditMaxBackups, defaultAuditMaxBackups, "Number of rotated audit logs kept.")
+	flags.Int(historyMaxVersions, defaultHistoryVersions, "Number of versions kept in the history of each record. Zero keeps them all.")
+	flags.Bool(asyncWrites, false, "Queue the additions and updates of records, answering right away, and apply them to the DNS server in the background.")
+	flags.Int(asyncWorkers, defaultAsyncWorkers, "Number of workers applying the queued writes to the DNS server.")
+	flags.Int(asyncMaxAttempts, defaultAsyncAttempts, "Maximum number of times a queued write is tried before failing.")
+	flags.Duration(asyncRetryDelay, defaultAsyncRetryDelay, "Time to wait before retrying a queued write the DNS server failed to apply, doubled after each attempt.")
+	flags.Duration(asyncRetention, defaultAsyncRetention, "Time the queued writes are kept once applied or failed, for their status to be checked. Zero keeps them forever.")
+	flags.String(storeType, DiskvStore, "Type of the store keeping the records in the data directory: diskv, one file per record, bolt, a single bbolt file, or sqlite, a single SQLite file able to filter the records.")
 }
 
 // InitFromViper initializes Options with properties retrieved from Viper.
 func (b *Builder) InitFromViper(v *viper.Viper) *Builder {
 	b.TTL = v.GetDuration(dnsTtl)
 	b.RemovalDelay = v.GetDuration(dnsRemovalDelay)
+	b.OperationTimeout = v.GetDuration(dnsOperationTimeout)
+	b.VerifyUnchanged = v.GetBool(dnsVerifyUnchanged)
+	b.ReconcileInterval = v.GetDuration(reconcileInterval)
+	b.ReconcileDryRun = v.GetBool(reconcileDryRun)
+	b.ReconcileConcurrency = v.GetInt(reconcileConcurrency)
+	b.ReapplyOnStartup = v.GetBool(reapplyOnStartup)
+	b.GCInterval = v.GetDuration(gcInterval)
+	b.GCGracePeriod = v.GetDuration(gcGracePeriod)
+	b.GCDryRun = v.GetBool(gcDryRun)
+	b.StoreType = v.GetString(storeType)
+	b.AuditMaxSize = int64(v.GetInt(auditMaxSize)) * 1024 * 1024
+	b.AuditMaxBackups = v.GetInt(auditMaxBackups)
+	b.HistoryMaxVersions = v.GetInt(historyMaxVersions)
+	b.AsyncWrites = v.GetBool(asyncWrites)
+	b.AsyncWorkers = v.GetInt(asyncWorkers)
+	b.AsyncMaxAttempts = v.GetInt(asyncMaxAttempts)
+	b.AsyncRetryDelay = v.GetDuration(asyncRetryDelay)
+	b.AsyncRetention = v.GetDuration(asyncRetention)
 	return b
 }
@@ -19,6 +19,24 @@ func TestBingFlags(t *testing.T) {
 	err := command.ParseFlags([]string{
 		fmt.Sprintf("--%s=10s", dnsTtl),
 		fmt.Sprintf("--%s=10s", dnsRemovalDelay),
+		fmt.Sprintf("--%s=10s", dnsOperationTimeout),
+		fmt.Sprintf("--%s=10s", reconcileInterval),
+		fmt.Sprintf("--%s", reconcileDryRun),
+		fmt.Sprintf("--%s=8", reconcileConcurrency),
+		fmt.Sprintf("--%s=false", reapplyOnStartup),
+		fmt.Sprintf("--%s=10s", gcInterval),
+		fmt.Sprintf("--%s=10s", gcGracePeriod),
+		fmt.Sprintf("--%s", gcDryRun),
+		fmt.Sprintf("--%s=%s", storeType, BoltStore),
+		fmt.Sprintf("--%s=2", auditMaxSize),
+		fmt.Sprintf("--%s=3", auditMaxBackups),
+		fmt.Sprintf("--%s=4", historyMaxVersions),
+		fmt.Sprintf("--%s=true", asyncWrites),
+		fmt.Sprintf("--%s=true", dnsVerifyUnchanged),
+		fmt.Sprintf("--%s=8", asyncWorkers),
+		fmt.Sprintf("--%s=3", asyncMaxAttempts),
+		fmt.Sprintf("--%s=1m", asyncRetryDelay),
+		fmt.Sprintf("--%s=1h", asyncRetention),
 	})
 	require.NoError(t, err)
 
@@ -27,6 +45,24 @@ func TestBingFlags(t *testing.T) {
 
 	assert.Equal(t, time.Second*10, b.TTL)
 	assert.Equal(t, time.Second*10, b.RemovalDelay)
+	assert.Equal(t, time.Second*10, b.OperationTimeout)
+	assert.Equal(t, time.Second*10, b.ReconcileInterval)
+	assert.True(t, b.ReconcileDryRun)
+	assert.Equal(t, 8, b.ReconcileConcurrency)
+	assert.False(t, b.ReapplyOnStartup)
+	assert.Equal(t, time.Second*10, b.GCInterval)
+	assert.Equal(t, time.Second*10, b.GCGracePeriod)
+	assert.True(t, b.GCDryRun)
+	assert.Equal(t, BoltStore, b.StoreType)
+	assert.Equal(t, int64(2*1024*1024), b.AuditMaxSize)
+	assert.Equal(t, 3, b.AuditMaxBackups)
+	assert.Equal(t, 4, b.HistoryMaxVersions)
+	assert.True(t, b.AsyncWrites)
+	assert.True(t, b.VerifyUnchanged)
+	assert.Equal(t, 8, b.AsyncWorkers)
+	assert.Equal(t, 3, b.AsyncMaxAttempts)
+	assert.Equal(t, time.Minute, b.AsyncRetryDelay)
+	assert.Equal(t, time.Hour, b.AsyncRetention)
 }
 
 func TestDefaultValues(t *testing.T) {
@@ -40,4 +76,22 @@ func TestDefaultValues(t *testing.T) {
 
 	assert.Equal(t, defaultDnsTtl, b.TTL)
 	assert.Equal(t, defaultDnsRemovalDelay, b.RemovalDelay)
+	assert.Equal(t, defaultDnsOpTimeout, b.OperationTimeout)
+	assert.Equal(t, time.Duration(0), b.ReconcileInterval)
+	assert.False(t, b.ReconcileDryRun)
+	assert.Equal(t, defaultConcurrency, b.ReconcileConcurrency)
+	assert.True(t, b.ReapplyOnStartup)
+	assert.Equal(t, time.Duration(0), b.GCInterval)
+	assert.Equal(t, defaultGCGracePeriod, b.GCGracePeriod)
+	assert.False(t, b.GCDryRun)
+	assert.Equal(t, DiskvStore, b.StoreType)
+	assert.Equal(t, int64(defaultAuditMaxSize*1024*1024), b.AuditMaxSize)
+	assert.Equal(t, defaultAuditMaxBackups, b.AuditMaxBackups)
+	assert.Equal(t, defaultHistoryVersions, b.HistoryMaxVersions)
+	assert.False(t, b.AsyncWrites)
+	assert.False(t, b.VerifyUnchanged)
+	assert.Equal(t, defaultAsyncWorkers, b.AsyncWorkers)
+	assert.Equal(t, defaultAsyncAttempts, b.AsyncMaxAttempts)
+	assert.Equal(t, defaultAsyncRetryDelay, b.AsyncRetryDelay)
+	assert.Equal(t, defaultAsyncRetention, b.AsyncRetention)
 }
@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	"github.com/sirupsen/logrus"
+)
+
+// GCReport tells the orphaned record sets found by a garbage collection: the ones written by Bindman found in the zones
+// but not in the local storage, e.g. after the loss of the data volume
+type GCReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// DryRun tells if the orphaned record sets were only reported, leaving the zones untouched
+	DryRun bool `json:"dryRun"`
+	// Orphans are the orphaned record sets last written by Bindman before the grace period
+	Orphans []Record `json:"orphans"`
+	// Recent are the orphaned record sets written by Bindman within the grace period, kept for now
+	Recent []Record `json:"recent"`
+	// Removed are the orphaned record sets removed from the zones
+	Removed []Record `json:"removed"`
+	// Errors tells the orphaned record sets that could not be removed and why
+	Errors []string `json:"errors,omitempty"`
+}
+
+// StartGarbageCollector removes the orphaned record sets every GCInterval until the Manager shuts down.
+// Does nothing when no GCInterval is set
+func (m *Manager) StartGarbageCollector() {
+	if m.GCInterval <= 0 {
+		return
+	}
+	m.jobs.Add(1)
+	go func() {
+		defer m.jobs.Done()
+		ticker := time.NewTicker(m.GCInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := m.CollectGarbage(m.ctx, m.GCDryRun); err != nil {
+					logrus.Errorf("Error occurred while collecting the orphaned records: %v", err)
+				}
+			}
+		}
+	}()
+	logrus.Infof("Orphaned records to be collected every %v after a grace period of %v", m.GCInterval, m.GCGracePeriod)
+}
+
+// CollectGarbage removes the record sets written by Bindman found in the zones but neither in the local storage nor being
+// removed, once GCGracePeriod elapsed since Bindman last wrote them. They are only reported when dryRun is set.
+// Fails when no InstanceID is set, the record sets written by the other instances being taken as orphaned otherwise
+func (m *Manager) CollectGarbage(ctx context.Context, dryRun bool) (*GCReport, error) {
+	if m.InstanceID == "" {
+		return nil, errors.New("not possible to collect the orphaned records; no instance ID is set to tell the record sets of this instance")
+	}
+	lister, ok := m.DNSUpdater.(azure.RecordSetLister)
+	if !ok {
+		return nil, errors.New("not possible to collect the orphaned records; the DNSUpdater cannot list the record sets of the zones")
+	}
+	m.collecting.Lock()
+	defer m.collecting.Unlock()
+
+	report := &GCReport{StartedAt: time.Now().UTC(), DryRun: dryRun, Orphans: []Record{}, Recent: []Record{}, Removed: []Record{}}
+	listCtx, cancel := m.operationContext(ctx)
+	recordSets, err := lister.ListRecordSets(listCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	tracked, err := m.trackedRecordSets()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rs := range recordSets {
+		if !rs.Owned || tracked[reconcileKey(rs.Name, rs.Type)] {
+			continue
+		}
+		record := Record{Name: rs.Name, Type: rs.Type, Values: rs.Values}
+		if !rs.UpdatedAt.IsZero() && time.Since(rs.UpdatedAt) < m.GCGracePeriod {
+			report.Recent = append(report.Recent, record)
+			continue
+		}
+		report.Orphans = append(report.Orphans, record)
+		logrus.Warnf("Record '%s' of type '%s' written by Bindman is orphaned: not found in the local storage", rs.Name, rs.Type)
+		if dryRun {
+			continue
+		}
+		if err := m.removeOrphan(ctx, record); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("record '%s' of type '%s' not removed: %v", record.Name, record.Type, err))
+			continue
+		}
+		report.Removed = append(report.Removed, record)
+		logrus.Infof("Orphaned record '%s' of type '%s' removed", record.Name, record.Type)
+	}
+	sortRecords(report.Orphans)
+	sortRecords(report.Recent)
+	sortRecords(report.Removed)
+	sort.Strings(report.Errors)
+	report.FinishedAt = time.Now().UTC()
+	logrus.Infof("Orphaned records collected: %d orphaned, %d within the grace period, %d removed, %d errors",
+		len(report.Orphans), len(report.Recent), len(report.Removed), len(report.Errors))
+
+	m.reports.Lock()
+	m.lastGCReport = report
+	m.reports.Unlock()
+	return report, nil
+}
+
+// LastGCReport returns the report of the last garbage collection; nil when none ran yet
+func (m *Manager) LastGCReport() *GCReport {
+	m.reports.Lock()
+	defer m.reports.Unlock()
+	return m.lastGCReport
+}
+
+// trackedRecordSets returns the keys, as made by reconcileKey, of the record sets stored or being removed, so that they
+// are matched whatever the case and the trailing dot of their names
+func (m *Manager) trackedRecordSets() (map[string]bool, error) {
+	records, err := m.listRecords(func(string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	removals, err := m.PendingRemovals()
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]bool{}
+	for _, record := range records {
+		tracked[reconcileKey(record.Name, record.Type)] = true
+	}
+	for _, removal := range removals {
+		tracked[reconcileKey(removal.Name, removal.Type)] = true
+	}
+	return tracked, nil
+}
+
+// removeOrphan removes the orphaned record set from its zone, unless it was stored in the meantime
+func (m *Manager) removeOrphan(ctx context.Context, record Record) error {
+	tracked, err := m.trackedRecordSets()
+	if err != nil {
+		return err
+	}
+	if tracked[reconcileKey(record.Name, record.Type)] {
+		return errors.New("stored in the meantime")
+	}
+	ctx, cancel := m.operationContext(azure.WithStoredValues(ctx, record.Values))
+	defer cancel()
+	err = updaterError(ctx, m.DNSUpdater.RemoveRR(ctx, record.Name, record.Type, ""))
+	m.audit(AuditEntry{Action: AuditDelete, Name: record.Name, Type: record.Type, Source: SourceGC, OldValues: record.Values,
+		Message: "orphaned record set collected"}, err)
+	return err
+}
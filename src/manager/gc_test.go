@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// initGCTest creates a Manager of a MockZone holding orphaned record sets in its own storage
+func initGCTest(t *testing.T) (*Manager, *MockZone, func()) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Minute, InstanceID: "blue", GCGracePeriod: 24 * time.Hour}, zone)
+
+	for _, name := range []string{"kept.test.com", "pending.test.com"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("Expecting the addition of the record '%v' to succeed. Got err '%v'", name, err)
+		}
+	}
+	if err := m.RemoveDNSRecord("pending.test.com", "A"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	for !m.removalPending("pending.test.com", "A") || m.HasDNSRecord("pending.test.com", "A") {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, rs := range []azure.ZoneRecordSet{
+		{Name: "orphan.test.com", Type: "A", Values: []string{"10.0.0.2"}, Owned: true, UpdatedAt: time.Now().Add(-48 * time.Hour)},
+		{Name: "unknown.test.com", Type: "TXT", Values: []string{"v=spf1 -all"}, Owned: true},
+		{Name: "recent.test.com", Type: "A", Values: []string{"10.0.0.3"}, Owned: true, UpdatedAt: time.Now().Add(-time.Hour)},
+		{Name: "foreign.test.com", Type: "A", Values: []string{"10.0.0.4"}, UpdatedAt: time.Now().Add(-48 * time.Hour)},
+	} {
+		zone.RecordSets[reconcileKey(rs.Name, rs.Type)] = rs
+	}
+
+	return m, zone, cleanup
+}
+
+func TestCollectGarbage(t *testing.T) {
+	m, zone, cleanup := initGCTest(t)
+	defer cleanup()
+
+	report, err := m.CollectGarbage(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expecting the garbage collection to succeed. Got err '%v'", err)
+	}
+	expectedOrphans := []Record{
+		{Name: "orphan.test.com", Type: "A", Values: []string{"10.0.0.2"}},
+		{Name: "unknown.test.com", Type: "TXT", Values: []string{"v=spf1 -all"}},
+	}
+	if !reflect.DeepEqual(report.Orphans, expectedOrphans) || !reflect.DeepEqual(report.Removed, expectedOrphans) {
+		t.Errorf("Expecting the orphaned record sets %v to be removed. Got %v removed out of %v", expectedOrphans, report.Removed, report.Orphans)
+	}
+	expectedRecent := []Record{{Name: "recent.test.com", Type: "A", Values: []string{"10.0.0.3"}}}
+	if !reflect.DeepEqual(report.Recent, expectedRecent) {
+		t.Errorf("Expecting the record sets written within the grace period to be kept. Got %v", report.Recent)
+	}
+	for _, name := range []string{"kept.test.com", "pending.test.com", "recent.test.com", "foreign.test.com"} {
+		if _, found := zone.RecordSets[reconcileKey(name, "A")]; !found {
+			t.Errorf("Expecting the record set '%s' to be left in the zone", name)
+		}
+	}
+	for _, record := range expectedOrphans {
+		if _, found := zone.RecordSets[reconcileKey(record.Name, record.Type)]; found {
+			t.Errorf("Expecting the orphaned record set '%s' to be removed from the zone", record.Name)
+		}
+	}
+	if m.LastGCReport() != report {
+		t.Errorf("Expecting the last report to be kept")
+	}
+}
+
+func TestCollectGarbageFqdnNames(t *testing.T) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Hour, InstanceID: "blue", GCGracePeriod: time.Hour}, zone)
+	defer cleanup()
+	for _, name := range []string{"kept.test.com.", "pending.test.com."} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("Expecting the addition of the record '%v' to succeed. Got err '%v'", name, err)
+		}
+	}
+	if err := m.RemoveDNSRecord("pending.test.com.", "A"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	// Azure lists the record sets without the trailing dot of the names they were written with
+	for _, name := range []string{"kept.test.com", "pending.test.com"} {
+		zone.RecordSets[reconcileKey(name, "A")] = azure.ZoneRecordSet{Name: name, Type: "A", Values: []string{"10.0.0.1"}, Owned: true, UpdatedAt: time.Now().Add(-48 * time.Hour)}
+	}
+
+	report, err := m.CollectGarbage(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expecting the garbage collection to succeed. Got err '%v'", err)
+	}
+	if len(report.Orphans) != 0 || len(report.Removed) != 0 {
+		t.Errorf("Expecting the stored record set and the one being removed to be kept. Got %v removed out of %v", report.Removed, report.Orphans)
+	}
+	if _, err := m.CancelRemoval("pending.test.com.", "A"); err != nil {
+		t.Errorf("Expecting the delayed removal to be still cancellable. Got err '%v'", err)
+	}
+}
+
+func TestCollectGarbageDryRun(t *testing.T) {
+	m, zone, cleanup := initGCTest(t)
+	defer cleanup()
+
+	report, err := m.CollectGarbage(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Expecting the garbage collection to succeed. Got err '%v'", err)
+	}
+	if !report.DryRun || len(report.Orphans) != 2 || len(report.Removed) != 0 {
+		t.Errorf("Expecting the orphaned record sets to be reported only. Got %+v", report)
+	}
+	if len(zone.RecordSets) != 6 {
+		t.Errorf("Expecting the zone to be left untouched. Got %v", zone.RecordSets)
+	}
+}
+
+func TestCollectGarbageWithoutLister(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	if _, err := m.CollectGarbage(context.Background(), false); err == nil {
+		t.Errorf("Expecting the garbage collection to fail when the DNSUpdater cannot list the record sets")
+	}
+}
+
+func TestCollectGarbageWithoutInstanceID(t *testing.T) {
+	m, zone, cleanup := initGCTest(t)
+	defer cleanup()
+	m.InstanceID = ""
+	if _, err := m.CollectGarbage(context.Background(), false); err == nil {
+		t.Errorf("Expecting the garbage collection to fail without an instance ID")
+	}
+	if _, found := zone.RecordSets[reconcileKey("orphan.test.com", "A")]; !found {
+		t.Errorf("Expecting the zone to be left untouched")
+	}
+
+	dir, _ := ioutil.TempDir("", "bindman-manager")
+	defer os.RemoveAll(dir)
+	if _, err := (&Builder{GCInterval: time.Minute}).New(zone, dir); err == nil {
+		t.Errorf("Expecting New to fail with a GCInterval but no instance ID")
+	}
+}
+
+func TestStartGarbageCollector(t *testing.T) {
+	m, _, cleanup := initGCTest(t)
+	defer cleanup()
+	m.GCInterval = 10 * time.Millisecond
+	m.GCDryRun = true
+
+	m.StartGarbageCollector()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.LastGCReport() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if report := m.LastGCReport(); report == nil || !report.DryRun {
+		t.Errorf("Expecting the garbage collector to run periodically in dry-run mode. Got %+v", report)
+	}
+}
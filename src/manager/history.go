@@ -0,0 +1,279 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// HistoryExtension sets the extension of the files holding the history of the record sets
+const HistoryExtension = "history"
+
+// RecordVersion is a state of a record set kept by its history
+type RecordVersion struct {
+	// Version numbers the states of the record set, starting at one
+	Version int `json:"version"`
+
+	// Time is when the record set reached this state
+	Time time.Time `json:"time"`
+
+	// Action is the audited action that changed the record set, e.g. AuditAdd
+	Action string `json:"action"`
+
+	// Values the values of the record set; none when it was removed
+	Values []string `json:"values,omitempty"`
+
+	// TTL is the time to live in seconds the values were written with
+	TTL int64 `json:"ttl"`
+
+	// Removed tells if the record set was removed from the local storage, its removal from the DNS server being scheduled
+	Removed bool `json:"removed,omitempty"`
+}
+
+// RollbackReport tells what a rollback of the record sets to a point in time changed
+type RollbackReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Zone is the zone rolled back; all the managed zones when empty
+	Zone string `json:"zone"`
+	// At is the point in time the record sets were rolled back to
+	At time.Time `json:"at"`
+	// DryRun tells if the changes were only reported, leaving the record sets untouched
+	DryRun bool `json:"dryRun"`
+	// Restored are the record sets written back with the values they held at the time
+	Restored []Record `json:"restored"`
+	// Removed are the record sets created since the time or holding no value then, scheduled for removal
+	Removed []Record `json:"removed"`
+	// Unknown are the record sets whose history does not go back to the time, its older versions having been dropped;
+	// they are left alone
+	Unknown []Record `json:"unknown"`
+	// Errors tells the record sets that could not be rolled back and why
+	Errors []string `json:"errors,omitempty"`
+}
+
+// GetHistory retrieves the versions of the record set identified by name and type, the oldest first
+func (m *Manager) GetHistory(name, recordType string) ([]RecordVersion, error) {
+	m.Door.RLock()
+	defer m.Door.RUnlock()
+
+	history, err := m.readHistory(m.Store, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No history found with name '%s' and type '%s'", name, recordType), nil)
+	}
+	return history, nil
+}
+
+// RollbackRecord writes the values the record set held at the version of its history back to the DNS server and
+// the local storage, ctx bounding the calls to the DNSUpdater. The record set is removed when the version tells so
+func (m *Manager) RollbackRecord(ctx context.Context, name, recordType string, version int) (*RecordVersion, error) {
+	history, err := m.GetHistory(name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range history {
+		if v.Version == version {
+			if _, err := m.rollback(ctx, name, recordType, v); err != nil {
+				return nil, err
+			}
+			return &v, nil
+		}
+	}
+	return nil, hookTypes.NotFoundError(fmt.Sprintf("No version %d found in the history of '%s' '%s'", version, name, recordType), nil)
+}
+
+// RollbackZone rolls the record sets of the zone back to the values they held at the time, removing the ones created since.
+// All the managed zones are rolled back when zone is empty. The changes are only reported when dryRun is true.
+// Record sets without history, e.g. stored before it was kept, or whose history does not go back to the time are left alone
+func (m *Manager) RollbackZone(ctx context.Context, zone string, at time.Time, dryRun bool) (*RollbackReport, error) {
+	report := &RollbackReport{StartedAt: time.Now().UTC(), Zone: azure.UnFqdn(zone), At: at, DryRun: dryRun,
+		Restored: []Record{}, Removed: []Record{}, Unknown: []Record{}}
+
+	m.Door.RLock()
+	keys, err := m.Store.List("." + HistoryExtension)
+	m.Door.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		name, recordType, _ := splitKey(key)
+		if z, managed := m.zoneOf(name); !managed || (report.Zone != "" && !strings.EqualFold(azure.UnFqdn(z), report.Zone)) {
+			continue
+		}
+		history, err := m.GetHistory(name, recordType)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("record '%s' of type '%s' not rolled back: %v", name, recordType, err))
+			continue
+		}
+		target, known := versionAt(history, at)
+		if !known {
+			report.Unknown = append(report.Unknown, Record{Name: name, Type: recordType, Values: m.storedValues(name, recordType)})
+			logrus.Warnf("Record '%s' of type '%s' not rolled back: its history does not go back to %s", name, recordType, at.Format(time.RFC3339))
+			continue
+		}
+		record := Record{Name: name, Type: recordType, Values: target.Values}
+		if target.Removed {
+			record.Values = m.storedValues(name, recordType)
+		}
+		if !m.rollbackNeeded(name, recordType, target) {
+			continue
+		}
+		if !dryRun {
+			if _, err := m.rollback(ctx, name, recordType, target); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("record '%s' of type '%s' not rolled back: %v", name, recordType, err))
+				continue
+			}
+		}
+		if target.Removed {
+			report.Removed = append(report.Removed, record)
+		} else {
+			report.Restored = append(report.Restored, record)
+		}
+	}
+	sortRecords(report.Restored)
+	sortRecords(report.Removed)
+	sortRecords(report.Unknown)
+	sort.Strings(report.Errors)
+	report.FinishedAt = time.Now().UTC()
+
+	logrus.Infof("Rollback of the zone '%s' to %s: %d record sets restored, %d removed, %d unknown, %d errors (dry run: %v)",
+		report.Zone, at.Format(time.RFC3339), len(report.Restored), len(report.Removed), len(report.Unknown), len(report.Errors), dryRun)
+	return report, nil
+}
+
+// rollback brings the record set back to the version, with the TTL it was written with, telling if anything had to change
+func (m *Manager) rollback(ctx context.Context, name, recordType string, target RecordVersion) (changed bool, err error) {
+	if !m.rollbackNeeded(name, recordType, target) {
+		return false, nil
+	}
+	if target.Removed {
+		return true, m.removeDNSRecord(name, recordType, SourceRollback)
+	}
+
+	oldValues := m.storedValues(name, recordType)
+	defer func() {
+		m.audit(AuditEntry{Action: AuditRollback, Name: name, Type: recordType, Source: SourceRollback, OldValues: oldValues, NewValues: target.Values,
+			Message: fmt.Sprintf("rolled back to version %d", target.Version)}, err)
+	}()
+	record := Record{Name: name, Type: recordType, Values: target.Values}
+	ttl := versionTTL(target, m.TTL)
+	if err = m.writeValues(ctx, record, ttl); err != nil {
+		return false, err
+	}
+	m.Door.Lock()
+	defer m.Door.Unlock()
+	return true, m.Store.Update(func(b Bucket) error {
+		return m.putRecordTTL(b, record, AuditRollback, ttl)
+	})
+}
+
+// rollbackNeeded tells if the stored record set differs from the version, by its values or the TTL it was last written with
+func (m *Manager) rollbackNeeded(name, recordType string, target RecordVersion) bool {
+	current := m.storedValues(name, recordType)
+	if target.Removed {
+		return current != nil
+	}
+	if current == nil || !sameValues(recordType, current, target.Values) {
+		return true
+	}
+	history, err := m.GetHistory(name, recordType)
+	return err == nil && versionTTL(history[len(history)-1], m.TTL) != versionTTL(target, m.TTL)
+}
+
+// versionAt returns the version of the history the record set was at at the time, a removal when it did not exist yet.
+// Not known when the time predates the oldest version kept while older ones were dropped
+func versionAt(history []RecordVersion, at time.Time) (version RecordVersion, known bool) {
+	if len(history) > 0 && history[0].Version > 1 && history[0].Time.After(at) {
+		return RecordVersion{}, false
+	}
+	result := RecordVersion{Time: at, Removed: true}
+	for _, v := range history {
+		if v.Time.After(at) {
+			break
+		}
+		result = v
+	}
+	return result, true
+}
+
+// versionTTL returns the TTL the values of the version were written with; defaultTTL when it was not kept
+func versionTTL(version RecordVersion, defaultTTL time.Duration) time.Duration {
+	if version.TTL <= 0 {
+		return defaultTTL
+	}
+	return time.Duration(version.TTL) * time.Second
+}
+
+// putRecord writes the record set to the bucket, adding its new version to its history
+func (m *Manager) putRecord(b Bucket, record Record, action string) error {
+	return m.putRecordTTL(b, record, action, m.TTL)
+}
+
+// putRecordTTL writes the record set to the bucket, adding its new version written with the TTL to its history
+func (m *Manager) putRecordTTL(b Bucket, record Record, action string, ttl time.Duration) error {
+	record.Owner = m.InstanceID
+	r, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(m.getRecordFileName(record.Name, record.Type), r); err != nil {
+		return err
+	}
+	return m.addVersion(b, record.Name, record.Type, RecordVersion{Action: action, Values: record.Values, TTL: int64(ttl / time.Second)})
+}
+
+// deleteRecord erases the record set from the bucket, adding its removal to its history
+func (m *Manager) deleteRecord(b Bucket, name, recordType, action string) error {
+	if err := b.Delete(m.getRecordFileName(name, recordType)); err != nil {
+		return err
+	}
+	return m.addVersion(b, name, recordType, RecordVersion{Action: action, Removed: true})
+}
+
+// addVersion numbers and appends the version to the history of the record set, dropping the oldest versions
+// over HistoryMaxVersions
+func (m *Manager) addVersion(b Bucket, name, recordType string, version RecordVersion) error {
+	history, err := m.readHistory(b, name, recordType)
+	if err != nil {
+		return err
+	}
+	version.Version, version.Time = 1, time.Now().UTC()
+	if len(history) > 0 {
+		version.Version = history[len(history)-1].Version + 1
+	}
+	history = append(history, version)
+	if m.HistoryMaxVersions > 0 && len(history) > m.HistoryMaxVersions {
+		history = history[len(history)-m.HistoryMaxVersions:]
+	}
+	h, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return b.Put(m.getHistoryFileName(name, recordType), h)
+}
+
+// readHistory reads the history of the record set from the bucket; empty when none was kept
+func (m *Manager) readHistory(b Bucket, name, recordType string) (history []RecordVersion, err error) {
+	h, err := b.Get(m.getHistoryFileName(name, recordType))
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(h, &history)
+	return
+}
+
+// getHistoryFileName return the name of the file holding the history of the record
+func (m *Manager) getHistoryFileName(recordName, recordType string) string {
+	return fmt.Sprintf("%v.%v.%v", recordName, recordType, HistoryExtension)
+}
@@ -0,0 +1,217 @@
+package manager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestGetHistory(t *testing.T) {
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Hour, HistoryMaxVersions: 4}, newMockZone())
+	defer cleanup()
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.3"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.RemoveDNSRecord("www.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := m.CancelRemoval("www.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	history, err := m.GetHistory("www.test.com", "A")
+	if err != nil {
+		t.Fatalf("Expecting the history to be read. Got err '%v'", err)
+	}
+	expected := []RecordVersion{
+		{Version: 2, Action: AuditAdd, Values: []string{"10.0.0.1", "10.0.0.2"}, TTL: 3600},
+		{Version: 3, Action: AuditUpdate, Values: []string{"10.0.0.3"}, TTL: 3600},
+		{Version: 4, Action: AuditScheduleRemoval, Removed: true},
+		{Version: 5, Action: AuditCancelRemoval, Values: []string{"10.0.0.3"}, TTL: 3600},
+	}
+	for i := range history {
+		if i > 0 && history[i].Time.Before(history[i-1].Time) {
+			t.Errorf("Expecting the versions to be kept the oldest first. Got %v", history)
+		}
+		history[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("Expecting the last versions\n%+v\nGot\n%+v", expected, history)
+	}
+
+	if _, err := m.GetHistory("missing.test.com", "A"); err == nil {
+		t.Errorf("Expecting the history of an unknown record to be missing")
+	}
+}
+
+func TestRollbackRecord(t *testing.T) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Hour}, zone)
+	defer cleanup()
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.3"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	version, err := m.RollbackRecord(context.Background(), "www.test.com", "A", 2)
+	if err != nil || version.Version != 2 {
+		t.Fatalf("Expecting the record to be rolled back. Got %v and err '%v'", version, err)
+	}
+	expected := []string{"10.0.0.1", "10.0.0.2"}
+	if r, err := m.GetRecord("www.test.com", "A"); err != nil || !reflect.DeepEqual(r.Values, expected) {
+		t.Errorf("Expecting the values of the version to be stored. Got %v and err '%v'", r, err)
+	}
+	if rs := zone.RecordSets[reconcileKey("www.test.com", "A")]; !sameValues("A", rs.Values, expected) {
+		t.Errorf("Expecting the values of the version to be written to the zone. Got %v", rs.Values)
+	}
+	history, _ := m.GetHistory("www.test.com", "A")
+	if last := history[len(history)-1]; last.Version != 4 || last.Action != AuditRollback {
+		t.Errorf("Expecting the rollback to be kept in the history. Got %+v", last)
+	}
+
+	if _, err := m.RollbackRecord(context.Background(), "www.test.com", "A", 9); err == nil {
+		t.Errorf("Expecting the rollback to an unknown version to fail")
+	}
+}
+
+func TestRollbackZone(t *testing.T) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Hour}, zone)
+	defer cleanup()
+
+	for _, record := range []hookTypes.DNSRecord{
+		{Name: "kept.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "changed.test.com", Type: "A", Value: "10.0.0.2"},
+		{Name: "removed.test.com", Type: "A", Value: "10.0.0.3"},
+	} {
+		if err := m.AddDNSRecord(record); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	at := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "changed.test.com", Type: "A", Value: "10.0.0.4"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.RemoveDNSRecord("removed.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "new.test.com", Type: "A", Value: "10.0.0.5"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	report, err := m.RollbackZone(context.Background(), "", at, true)
+	if err != nil || !report.DryRun || len(report.Restored) != 2 || len(report.Removed) != 1 {
+		t.Fatalf("Expecting the changes to be reported. Got %+v and err '%v'", report, err)
+	}
+	if r, _ := m.GetRecord("changed.test.com", "A"); !reflect.DeepEqual(r.Values, []string{"10.0.0.4"}) {
+		t.Errorf("Expecting a dry run to leave the records untouched. Got %v", r)
+	}
+
+	report, err = m.RollbackZone(context.Background(), "", at, false)
+	if err != nil {
+		t.Fatalf("Expecting the zone to be rolled back. Got err '%v'", err)
+	}
+	expectedRestored := []Record{
+		{Name: "changed.test.com", Type: "A", Values: []string{"10.0.0.2"}},
+		{Name: "removed.test.com", Type: "A", Values: []string{"10.0.0.3"}},
+	}
+	expectedRemoved := []Record{{Name: "new.test.com", Type: "A", Values: []string{"10.0.0.5"}}}
+	if !reflect.DeepEqual(report.Restored, expectedRestored) || !reflect.DeepEqual(report.Removed, expectedRemoved) || len(report.Errors) > 0 {
+		t.Errorf("Expecting %v to be restored and %v removed. Got %+v", expectedRestored, expectedRemoved, report)
+	}
+	for _, record := range expectedRestored {
+		if r, err := m.GetRecord(record.Name, record.Type); err != nil || !reflect.DeepEqual(r.Values, record.Values) {
+			t.Errorf("Expecting the record '%s' to be stored back. Got %v and err '%v'", record.Name, r, err)
+		}
+		if rs := zone.RecordSets[reconcileKey(record.Name, record.Type)]; !reflect.DeepEqual(rs.Values, record.Values) {
+			t.Errorf("Expecting the record '%s' to be written back to the zone. Got %v", record.Name, rs.Values)
+		}
+	}
+	if m.HasDNSRecord("new.test.com", "A") || !m.removalPending("new.test.com", "A") {
+		t.Errorf("Expecting the record created since the time to be removed")
+	}
+
+	if report, err = m.RollbackZone(context.Background(), "", at, false); err != nil || len(report.Restored)+len(report.Removed) != 0 {
+		t.Errorf("Expecting nothing left to roll back. Got %+v and err '%v'", report, err)
+	}
+}
+
+func TestRollbackZoneTruncatedHistory(t *testing.T) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Hour, HistoryMaxVersions: 2}, zone)
+	defer cleanup()
+
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	at := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	for _, value := range []string{"10.0.0.2", "10.0.0.3"} {
+		if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+
+	report, err := m.RollbackZone(context.Background(), "", at, false)
+	expected := []Record{{Name: "www.test.com", Type: "A", Values: []string{"10.0.0.3"}}}
+	if err != nil || !reflect.DeepEqual(report.Unknown, expected) || len(report.Restored)+len(report.Removed) != 0 {
+		t.Errorf("Expecting the record whose history does not go back to the time to be reported and left alone. Got %+v and err '%v'", report, err)
+	}
+	if !m.HasDNSRecord("www.test.com", "A") || m.removalPending("www.test.com", "A") {
+		t.Errorf("Expecting the record to be kept")
+	}
+}
+
+func TestRollbackRecordTTL(t *testing.T) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour, RemovalDelay: time.Hour}, zone)
+	defer cleanup()
+
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	m.TTL = 2 * time.Hour
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if _, err := m.RollbackRecord(context.Background(), "www.test.com", "A", 1); err != nil {
+		t.Fatalf("Expecting the record to be rolled back. Got err '%v'", err)
+	}
+	if rs := zone.RecordSets[reconcileKey("www.test.com", "A")]; rs.TTL != time.Hour {
+		t.Errorf("Expecting the record set to be written back with the TTL of the version. Got %v", rs.TTL)
+	}
+	history, _ := m.GetHistory("www.test.com", "A")
+	if last := history[len(history)-1]; last.TTL != 3600 {
+		t.Errorf("Expecting the rollback to be kept in the history with the TTL of the version. Got %+v", last)
+	}
+
+	// only the TTL differs from the version
+	m.TTL = time.Hour
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := m.RollbackRecord(context.Background(), "www.test.com", "A", 2); err != nil {
+		t.Fatalf("Expecting the record to be rolled back. Got err '%v'", err)
+	}
+	if rs := zone.RecordSets[reconcileKey("www.test.com", "A")]; rs.TTL != 2*time.Hour || !reflect.DeepEqual(rs.Values, []string{"10.0.0.2"}) {
+		t.Errorf("Expecting the TTL of the version to be restored. Got %+v", rs)
+	}
+}
@@ -1,7 +1,7 @@
 package manager
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -12,21 +12,86 @@ import (
 
 	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
-	"github.com/peterbourgon/diskv"
 	"github.com/sirupsen/logrus"
 )
 
 type Builder struct {
 	TTL          time.Duration
 	RemovalDelay time.Duration
+	// StoreType is the type of the Store keeping the records in the data directory, DiskvStore or BoltStore
+	StoreType string
+	// OperationTimeout bounds each call to the DNSUpdater; no bound when zero
+	OperationTimeout time.Duration
+	// VerifyUnchanged makes the writes found unchanged in the local storage read the record set back from the DNS server,
+	// writing it anyway when it differs there
+	VerifyUnchanged bool
+	// ReconcileInterval is the time between two reconciliations of the local storage with the DNS server; none when zero
+	ReconcileInterval time.Duration
+	// ReconcileDryRun makes the reconciliations report the differences without repairing them
+	ReconcileDryRun bool
+	// ReconcileConcurrency is the maximum number of records written back at once by a reconciliation; one when zero
+	ReconcileConcurrency int
+	// ReapplyOnStartup makes ReapplyRecords write back the stored records missing from the DNS server or modified there
+	ReapplyOnStartup bool
+	// InstanceID identifies this Bindman instance in the record sets it writes, as the InstanceID of the azure Builder.
+	// The garbage collection refuses to run without it, taking the record sets of the other instances as its own
+	InstanceID string
+	// GCInterval is the time between two garbage collections of the orphaned record sets; none when zero
+	GCInterval time.Duration
+	// GCGracePeriod is the time an orphaned record set is kept after Bindman last wrote it
+	GCGracePeriod time.Duration
+	// GCDryRun makes the periodic garbage collections report the orphaned record sets without removing them
+	GCDryRun bool
+	// AuditMaxSize is the size in bytes the audit log is rotated at; never rotated when zero
+	AuditMaxSize int64
+	// AuditMaxBackups is the number of rotated audit logs kept
+	AuditMaxBackups int
+	// HistoryMaxVersions is the number of versions kept in the history of each record set; all of them when zero
+	HistoryMaxVersions int
+	// AsyncWrites makes AddDNSRecord and UpdateDNSRecord queue the writes, applied in the background by StartOperationWorkers
+	AsyncWrites bool
+	// AsyncWorkers is the number of workers applying the asynchronous writes; one when zero
+	AsyncWorkers int
+	// AsyncMaxAttempts is the maximum number of times an asynchronous write is tried; one when zero
+	AsyncMaxAttempts int
+	// AsyncRetryDelay is the time to wait before retrying an asynchronous write, doubled after each attempt
+	AsyncRetryDelay time.Duration
+	// AsyncRetention is the time the asynchronous writes are kept once applied or failed; forever when zero
+	AsyncRetention time.Duration
 }
 
 // Manager holds the information for managing a dns server
 type Manager struct {
 	*Builder
-	DNSRecords *diskv.Diskv
+	Store      Store
 	Door       *sync.RWMutex
 	DNSUpdater azure.DNSUpdater
+	// Audit records every change of the record sets
+	Audit *AuditLog
+
+	// ctx is cancelled on Shutdown, making the calls to the DNSUpdater in progress give up
+	ctx    context.Context
+	cancel context.CancelFunc
+	// removals tracks the delayed removals in progress
+	removals sync.WaitGroup
+	// jobs tracks the background jobs, such as the reconciler
+	jobs sync.WaitGroup
+
+	// reconciling makes the reconciliations run one at a time
+	reconciling sync.Mutex
+	// lastReport is the report of the last reconciliation, guarded by reports
+	lastReport *ReconcileReport
+	reports    sync.Mutex
+
+	// collecting makes the garbage collections run one at a time
+	collecting sync.Mutex
+	// lastGCReport is the report of the last garbage collection, guarded by reports
+	lastGCReport *GCReport
+
+	// operations guards the queues of the asynchronous writes, one for each worker, and the last operation ID
+	operations      sync.Mutex
+	queues          []*operationQueue
+	lastOperationID int64
 }
 
 // New creates a new Manager instance
@@ -39,86 +104,262 @@ func (b *Builder) New(dnsupdater azure.DNSUpdater, basePath string) (*Manager, e
 		return nil, errors.New("not possible to start the Bindman Manager; Bindman Manager expects a non-empty basePath")
 	}
 
+	if b.GCInterval > 0 && b.InstanceID == "" {
+		return nil, errors.New("not possible to start the Bindman Manager; the garbage collection requires an instance ID")
+	}
+
+	store, err := OpenStore(b.StoreType, basePath)
+	if err != nil {
+		return nil, fmt.Errorf("not possible to start the Bindman Manager; the store cannot be opened: %v", err)
+	}
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	audit, err := NewAuditLog(filepath.Join(basePath, auditFileName), b.AuditMaxSize, b.AuditMaxBackups)
+	if err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("not possible to start the Bindman Manager; the audit log cannot be opened: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	result := &Manager{
-		DNSRecords: diskv.New(diskv.Options{
-			BasePath:     basePath,
-			Transform:    func(s string) []string { return []string{} },
-			CacheSizeMax: 1024 * 1024,
-		}),
+		Store:      store,
 		Builder:    b,
 		Door:       new(sync.RWMutex),
 		DNSUpdater: dnsupdater,
+		Audit:      audit,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 	return result, nil
 }
 
-// GetDNSRecords retrieves all the dns records being managed
+// Shutdown cancels the calls to the DNSUpdater in progress along with the delayed removals and the background jobs,
+// waiting for them to stop before closing the Store and the audit log
+func (m *Manager) Shutdown() {
+	m.cancel()
+	m.removals.Wait()
+	m.jobs.Wait()
+	if err := m.Store.Close(); err != nil {
+		logrus.Errorf("Error occurred while closing the store: %v", err)
+	}
+	if err := m.Audit.Close(); err != nil {
+		logrus.Errorf("Error occurred while closing the audit log: %v", err)
+	}
+}
+
+// GetDNSRecords retrieves all the dns records being managed across all the zones, one for each value of a record set
 func (m *Manager) GetDNSRecords() (records []hookTypes.DNSRecord, err error) {
+	return m.listDNSRecords(func(string) bool { return true })
+}
+
+// GetZoneDNSRecords retrieves the dns records being managed in the zone, one for each value of a record set
+func (m *Manager) GetZoneDNSRecords(zone string) (records []hookTypes.DNSRecord, err error) {
+	zone = azure.UnFqdn(zone)
+	return m.listDNSRecords(func(z string) bool { return azure.UnFqdn(z) == zone })
+}
+
+// listDNSRecords retrieves the dns records of the managed zones accepted by the filter
+func (m *Manager) listDNSRecords(filter func(zone string) bool) (records []hookTypes.DNSRecord, err error) {
+	recordSets, err := m.listRecords(filter)
+	for _, r := range recordSets {
+		records = append(records, r.DNSRecords()...)
+	}
+	return
+}
+
+// listRecords retrieves the record sets of the managed zones accepted by the filter.
+// Records left from zones no longer managed are skipped
+func (m *Manager) listRecords(filter func(zone string) bool) (records []Record, err error) {
 	m.Door.RLock()
 	defer m.Door.RUnlock()
 
-	err = filepath.Walk(m.DNSRecords.BasePath, func(path string, info os.FileInfo, errr error) error {
-		if strings.HasSuffix(path, Extension) {
-			r, err := m.GetDNSRecord(m.getRecordNameAndType(info.Name()))
-			if err != nil {
-				return err
-			}
-			if r != nil {
-				records = append(records, *r)
-			}
+	keys, err := m.Store.List("." + Extension)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		name, recordType := m.getRecordNameAndType(key)
+		zone, managed := m.zoneOf(name)
+		if !managed || !filter(zone) {
+			continue
 		}
-		return nil
-	})
+		r, err := m.readRecord(name, recordType)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			records = append(records, *r)
+		}
+	}
 	return
 }
 
+// ManagedZones returns the names of the zones being managed; empty when the DNSUpdater does not tell them
+func (m *Manager) ManagedZones() []string {
+	if router, ok := m.DNSUpdater.(azure.ZoneRouter); ok {
+		return router.ManagedZones()
+	}
+	return nil
+}
+
 // GetDNSRecord retrieves the dns record identified by name
 func (m *Manager) HasDNSRecord(name, recordType string) bool {
 	key := m.getRecordFileName(name, recordType)
-	return m.DNSRecords.Has(key)
+	return m.Store.Has(key)
 }
 
-// GetDNSRecord retrieves the dns record identified by name
-func (m *Manager) GetDNSRecord(name, recordType string) (record *hookTypes.DNSRecord, err error) {
+// GetDNSRecord retrieves the dns record identified by name.
+// When the record set holds many values, the first one registered is returned
+func (m *Manager) GetDNSRecord(name, recordType string) (*hookTypes.DNSRecord, error) {
+	r, err := m.GetRecord(name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Values) == 0 {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s'", name, recordType), nil)
+	}
+	return &r.DNSRecords()[0], nil
+}
+
+// GetRecord retrieves the record set identified by name and type with all its values
+func (m *Manager) GetRecord(name, recordType string) (record *Record, err error) {
 	m.Door.RLock()
 	defer m.Door.RUnlock()
 
 	if !m.HasDNSRecord(name, recordType) {
 		return nil, hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s'", name, recordType), nil)
 	}
+	return m.readRecord(name, recordType)
+}
 
-	var r []byte
-	r, err = m.DNSRecords.Read(m.getRecordFileName(name, recordType))
-	if err == nil {
-		err = json.Unmarshal(r, &record)
+// AddDNSRecord adds a new value to a DNS record set.
+// When AsyncWrites is set, the addition is only queued, to be applied in the background
+func (m *Manager) AddDNSRecord(record hookTypes.DNSRecord) (err error) {
+	if m.AsyncWrites {
+		_, err = m.SubmitAddDNSRecord(record)
+		return
 	}
-	return
+	return m.AddDNSRecordContext(withSource(m.ctx, SourceWebhook), record)
 }
 
-// AddDNSRecord adds a new DNS record
-func (m *Manager) AddDNSRecord(record hookTypes.DNSRecord) (err error) {
-	err = m.DNSUpdater.AddRR(record, m.TTL)
+// AddDNSRecordContext adds a new value to a DNS record set, giving up when ctx is done.
+// Adding a value the record set already holds succeeds without writing anything, while adding another value to a single
+// valued or alias record set fails with a conflict: the record set must be updated instead
+func (m *Manager) AddDNSRecordContext(ctx context.Context, record hookTypes.DNSRecord) (err error) {
+	if record, err = normalizeRecord(record); err != nil {
+		return
+	}
+	oldValues := m.storedValues(record.Name, record.Type)
+	r := &Record{Name: record.Name, Type: record.Type, Values: append([]string{}, oldValues...)}
+	r.addValue(record.Value)
+	if m.unchanged(ctx, *r) {
+		logrus.Infof("Record '%s' '%s' already holds the value '%s'; nothing to add", record.Name, record.Type, record.Value)
+		return nil
+	}
+	defer func() {
+		m.audit(AuditEntry{Action: AuditAdd, Name: record.Name, Type: record.Type, Source: sourceOf(ctx), OldValues: oldValues, NewValues: r.Values}, err)
+	}()
+	if err = addConflict(*r, oldValues); err != nil {
+		return
+	}
+
+	ctx, cancel := m.operationContext(azure.WithStoredValues(ctx, oldValues))
+	defer cancel()
+	err = updaterError(ctx, m.DNSUpdater.AddRR(ctx, record, m.TTL))
 	if err == nil {
-		err = m.saveRecord(record)
+		err = m.addRecordValue(record)
 	}
 	return
 }
 
-// UpdateDNSRecord updates an existing dns record
+// UpdateDNSRecord updates an existing dns record set, replacing all its values by the record value.
+// When AsyncWrites is set, the update is only queued, to be applied in the background
 func (m *Manager) UpdateDNSRecord(record hookTypes.DNSRecord) (err error) {
-	err = m.DNSUpdater.UpdateRR(record, m.TTL)
+	if m.AsyncWrites {
+		_, err = m.SubmitUpdateDNSRecord(record)
+		return
+	}
+	return m.UpdateDNSRecordContext(withSource(m.ctx, SourceWebhook), record)
+}
+
+// UpdateDNSRecordContext updates an existing dns record set, replacing all its values by the record value and giving up when ctx is done.
+// Updating a record set already holding only the value succeeds without writing anything
+func (m *Manager) UpdateDNSRecordContext(ctx context.Context, record hookTypes.DNSRecord) (err error) {
+	if record, err = normalizeRecord(record); err != nil {
+		return
+	}
+	if m.unchanged(ctx, Record{Name: record.Name, Type: record.Type, Values: []string{record.Value}}) {
+		logrus.Infof("Record '%s' '%s' already holds only the value '%s'; nothing to update", record.Name, record.Type, record.Value)
+		return nil
+	}
+	oldValues := m.storedValues(record.Name, record.Type)
+	defer func() {
+		m.audit(AuditEntry{Action: AuditUpdate, Name: record.Name, Type: record.Type, Source: sourceOf(ctx), OldValues: oldValues, NewValues: []string{record.Value}}, err)
+	}()
+
+	ctx, cancel := m.operationContext(azure.WithStoredValues(ctx, oldValues))
+	defer cancel()
+	err = updaterError(ctx, m.DNSUpdater.UpdateRR(ctx, record, m.TTL))
 	if err == nil {
-		err = m.saveRecord(record)
+		err = m.saveRecord(Record{Name: record.Name, Type: record.Type, Values: []string{record.Value}}, AuditUpdate)
 	}
 	return
 }
 
-// RemoveDNSRecord removes a DNS record
+// RemoveDNSRecord removes a DNS record set with all its values
 func (m *Manager) RemoveDNSRecord(name, recordType string) error {
-	if !m.HasDNSRecord(name, recordType) {
-		return hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s", name, recordType), nil)
+	return m.removeDNSRecord(name, recordType, SourceWebhook)
+}
+
+// removeDNSRecord schedules the removal of a DNS record set, auditing it as made by the source
+func (m *Manager) removeDNSRecord(name, recordType, source string) error {
+	removal, err := m.scheduleRemoval(name, recordType)
+	if err != nil {
+		if m.HasDNSRecord(name, recordType) {
+			m.audit(AuditEntry{Action: AuditScheduleRemoval, Name: name, Type: recordType, Source: source, OldValues: m.storedValues(name, recordType)}, err)
+		}
+		return err
 	}
-	go m.delayRemove(name, recordType)
+	m.audit(AuditEntry{Action: AuditScheduleRemoval, Name: name, Type: recordType, Source: source, OldValues: removal.Values,
+		Message: fmt.Sprintf("due at %s", removal.DueAt.Format(time.RFC3339))}, nil)
+	m.startRemoval(*removal)
 	logrus.Infof("Record '%s' with type '%v' scheduled to be removed in %v seconds", name, recordType, m.RemovalDelay)
 	return nil
 }
+
+// RemoveDNSRecordValue removes a single value from a DNS record set.
+// Removing the last value of the record set is the same as removing the record set
+func (m *Manager) RemoveDNSRecordValue(name, recordType, value string) error {
+	return m.RemoveDNSRecordValueContext(withSource(m.ctx, SourceWebhook), name, recordType, value)
+}
+
+// RemoveDNSRecordValueContext removes a single value from a DNS record set, giving up when ctx is done.
+// Removing the last value of the record set is the same as removing the record set
+func (m *Manager) RemoveDNSRecordValueContext(ctx context.Context, name, recordType, value string) error {
+	record, err := normalizeRecord(hookTypes.DNSRecord{Name: name, Type: recordType, Value: value})
+	if err != nil {
+		return err
+	}
+	value = record.Value
+	r, err := m.GetRecord(name, recordType)
+	if err != nil {
+		return err
+	}
+	if !r.HasValue(value) {
+		return hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s', type '%s' and value '%s'", name, recordType, value), nil)
+	}
+	if len(r.Values) == 1 {
+		return m.removeDNSRecord(name, recordType, sourceOf(ctx))
+	}
+	remaining := &Record{Name: name, Type: recordType, Values: append([]string{}, r.Values...)}
+	remaining.removeValue(value)
+	ctx, cancel := m.operationContext(azure.WithStoredValues(ctx, r.Values))
+	defer cancel()
+	if err = updaterError(ctx, m.DNSUpdater.RemoveRR(ctx, name, recordType, value)); err == nil {
+		err = m.removeRecordValue(name, recordType, value)
+	}
+	m.audit(AuditEntry{Action: AuditRemoveValue, Name: name, Type: recordType, Source: sourceOf(ctx), OldValues: r.Values, NewValues: remaining.Values}, err)
+	return err
+}
@@ -1,12 +1,19 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
 )
 
@@ -14,7 +21,7 @@ const basePath = "./data"
 
 func TestMain(m *testing.M) {
 	exitCode := m.Run()
-	os.Remove(basePath)
+	os.RemoveAll(basePath)
 	os.Exit(exitCode)
 }
 
@@ -141,6 +148,292 @@ func TestDelayRemove(t *testing.T) {
 	}
 }
 
+func TestAddDNSRecordMultipleValues(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	defer m.removeRecord("multi.test.com", "A")
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "multi.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("Expecting the addition of the value '%v' to succeed. Got err '%v'", value, err)
+		}
+	}
+
+	r, err := m.GetRecord("multi.test.com", "A")
+	if err != nil {
+		t.Fatalf("Expecting the get of the record set to succeed. Got err '%v'", err)
+	}
+	if len(r.Values) != 2 || r.Values[0] != "10.0.0.1" || r.Values[1] != "10.0.0.2" {
+		t.Errorf("Expecting the record set to hold the values [10.0.0.1 10.0.0.2]. Got %v", r.Values)
+	}
+
+	records, err := m.GetDNSRecords()
+	if err != nil || len(records) != 2 {
+		t.Errorf("Expecting the list of records to have one entry per value. Got '%v' and err '%v'", records, err)
+	}
+
+	// single valued record sets conflict with the addition of another value, their update replacing it
+	defer m.removeRecord("alias.test.com", "CNAME")
+	for _, value := range []string{"a.test.com", "a.test.com"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: value}); err != nil {
+			t.Fatalf("Expecting the addition of the value '%v' to succeed. Got err '%v'", value, err)
+		}
+	}
+	err = m.AddDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "b.test.com"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusConflict {
+		t.Errorf("Expecting the addition of another value to conflict. Got err '%v'", err)
+	}
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "b.test.com"}); err != nil {
+		t.Fatalf("Expecting the update of the value to succeed. Got err '%v'", err)
+	}
+	r, err = m.GetRecord("alias.test.com", "CNAME")
+	if err != nil || len(r.Values) != 1 || r.Values[0] != "b.test.com" {
+		t.Errorf("Expecting the CNAME record set to hold only the last value. Got '%v' and err '%v'", r, err)
+	}
+}
+
+func TestSkipUnchangedWrites(t *testing.T) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour}, zone)
+	defer cleanup()
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "www.test.com"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	writes := zone.Writes
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"}); err != nil {
+		t.Errorf("Expecting the addition of a stored value to succeed. Got err '%v'", err)
+	}
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "www.test.com"}); err != nil {
+		t.Errorf("Expecting the update to the stored value to succeed. Got err '%v'", err)
+	}
+	if zone.Writes != writes {
+		t.Errorf("Expecting the unchanged record sets not to be written. Got %d writes", zone.Writes-writes)
+	}
+	if history, _ := m.GetHistory("alias.test.com", "CNAME"); len(history) != 1 {
+		t.Errorf("Expecting the unchanged record sets to keep their history. Got %+v", history)
+	}
+
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if zone.Writes != writes+1 {
+		t.Errorf("Expecting the update dropping a value to be written. Got %d writes", zone.Writes-writes)
+	}
+
+	// the record sets drifted on the DNS server are written anyway when verified
+	zone.RecordSets[reconcileKey("alias.test.com", "CNAME")] = azure.ZoneRecordSet{Name: "alias.test.com", Type: "CNAME", TTL: time.Minute, Values: []string{"www.test.com"}, Owned: true}
+	m.VerifyUnchanged = true
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "www.test.com"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if rs := zone.RecordSets[reconcileKey("alias.test.com", "CNAME")]; rs.TTL != time.Hour {
+		t.Errorf("Expecting the drifted record set to be written back. Got %+v", rs)
+	}
+	writes = zone.Writes
+	if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "www.test.com"}); err != nil || zone.Writes != writes {
+		t.Errorf("Expecting the verified record set not to be written. Got %d writes and err '%v'", zone.Writes-writes, err)
+	}
+}
+
+func TestRemoveDNSRecordValue(t *testing.T) {
+	m, updater, _ := initManagerWithNRecords(0, t)
+	defer m.removeRecord("multi.test.com", "A")
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "multi.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("Expecting the addition of the value '%v' to succeed. Got err '%v'", value, err)
+		}
+	}
+
+	if err := m.RemoveDNSRecordValue("multi.test.com", "A", "10.0.0.3"); err == nil {
+		t.Errorf("Expecting the removal of a nonexistent value to fail")
+	}
+
+	if err := m.RemoveDNSRecordValue("multi.test.com", "A", "10.0.0.1"); err != nil {
+		t.Fatalf("Expecting the removal of the value to succeed. Got err '%v'", err)
+	}
+	if len(updater.RemovedValues) != 1 || updater.RemovedValues[0] != "10.0.0.1" {
+		t.Errorf("Expecting the updater.RemoveRR to be called for the removed value only. Got %v", updater.RemovedValues)
+	}
+
+	r, err := m.GetRecord("multi.test.com", "A")
+	if err != nil || len(r.Values) != 1 || r.Values[0] != "10.0.0.2" {
+		t.Errorf("Expecting the record set to keep the remaining value. Got '%v' and err '%v'", r, err)
+	}
+}
+
+func TestAddDNSRecordStructuredValues(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	defer m.removeRecord("_sip._tcp.test.com", "SRV")
+
+	err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "_sip._tcp.test.com", Type: "SRV", Value: "10  5 5060   sip.test.com"})
+	if err != nil {
+		t.Fatalf("Expecting the addition of the SRV record to succeed. Got err '%v'", err)
+	}
+	r, err := m.GetDNSRecord("_sip._tcp.test.com", "SRV")
+	if err != nil || r.Value != "10 5 5060 sip.test.com" {
+		t.Errorf("Expecting the SRV value to be saved in its canonical format. Got '%v' and err '%v'", r, err)
+	}
+
+	err = m.AddDNSRecord(hookTypes.DNSRecord{Name: "test.com", Type: "MX", Value: "mail.test.com"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Expecting the addition of a MX record without preference to be a bad request. Got err '%v'", err)
+	}
+	if m.HasDNSRecord("test.com", "MX") {
+		t.Errorf("Expecting the invalid MX record to not be saved")
+	}
+}
+
+func TestAddDNSRecordCAA(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	defer m.removeRecord("caa.test.com", "CAA")
+
+	for _, value := range []string{"0 issue letsencrypt.org", `0 iodef "mailto:security@test.com"`} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "caa.test.com", Type: "CAA", Value: value}); err != nil {
+			t.Fatalf("Expecting the addition of the CAA value '%v' to succeed. Got err '%v'", value, err)
+		}
+	}
+
+	r, err := m.GetRecord("caa.test.com", "CAA")
+	if err != nil {
+		t.Fatalf("Expecting the get of the CAA record set to succeed. Got err '%v'", err)
+	}
+	if len(r.Values) != 2 || r.Values[0] != `0 issue "letsencrypt.org"` || r.Values[1] != `0 iodef "mailto:security@test.com"` {
+		t.Errorf("Expecting the CAA values to be saved in their canonical format. Got %v", r.Values)
+	}
+
+	err = m.AddDNSRecord(hookTypes.DNSRecord{Name: "caa.test.com", Type: "CAA", Value: "300 issue letsencrypt.org"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Expecting the addition of a CAA record with invalid flags to be a bad request. Got err '%v'", err)
+	}
+}
+
+func TestConflict(t *testing.T) {
+	m, updater, _ := initManagerWithNRecords(0, t)
+	defer m.removeRecord("conflict.test.com", "A")
+
+	updater.Error = &azure.ConflictError{Name: "conflict", Type: "A", Err: errors.New("412 Precondition Failed")}
+	for name, op := range map[string]func(hookTypes.DNSRecord) error{"add": m.AddDNSRecord, "update": m.UpdateDNSRecord} {
+		err := op(hookTypes.DNSRecord{Name: "conflict.test.com", Type: "A", Value: "10.0.0.1"})
+		if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusConflict || !IsConflict(err) {
+			t.Errorf("Expecting the %s of a record changed by someone else to be a conflict. Got err '%v'", name, err)
+		}
+		if m.HasDNSRecord("conflict.test.com", "A") {
+			t.Errorf("Expecting the record to not be saved after a failed %s", name)
+		}
+	}
+
+	updater.Error = &azure.ForeignRecordError{Name: "conflict.test.com", Type: "A"}
+	err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "conflict.test.com", Type: "A", Value: "10.0.0.1"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusConflict || !IsForeign(err) || IsConflict(err) {
+		t.Errorf("Expecting the addition to a record set not managed by Bindman to be refused. Got err '%v'", err)
+	}
+
+	updater.Error = errors.New("connection refused")
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "conflict.test.com", Type: "A", Value: "10.0.0.1"}); err == nil || IsConflict(err) {
+		t.Errorf("Expecting other failures to not be reported as conflicts. Got err '%v'", err)
+	}
+}
+
+func TestGetDNSRecordsMultipleZones(t *testing.T) {
+	updater := &MockZoneRouter{MockDNSUpdater: new(MockDNSUpdater), Zones: []string{"test.com", "sub.test.com", "other.com"}}
+	m, _ := new(Builder).New(updater, basePath)
+
+	names := []string{"www.test.com", "www.sub.test.com", "www.other.com", "www.gone.com"}
+	for _, name := range names {
+		defer m.removeRecord(name, "A")
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("Expecting the addition of the record '%v' to succeed. Got err '%v'", name, err)
+		}
+	}
+
+	records, err := m.GetDNSRecords()
+	if err != nil || len(records) != 3 {
+		t.Errorf("Expecting the list of records to hold the records of all the managed zones only. Got '%v' and err '%v'", records, err)
+	}
+
+	records, err = m.GetZoneDNSRecords("sub.test.com.")
+	if err != nil || len(records) != 1 || records[0].Name != "www.sub.test.com" {
+		t.Errorf("Expecting the list of records of the zone to hold its records only. Got '%v' and err '%v'", records, err)
+	}
+
+	if zones := m.ManagedZones(); len(zones) != 3 {
+		t.Errorf("Expecting the managed zones to be the ones of the DNSUpdater. Got %v", zones)
+	}
+}
+
+func TestOperationTimeout(t *testing.T) {
+	m, updater, _ := initManagerWithNRecords(0, t)
+	defer m.removeRecord("slow.test.com", "A")
+	updater.Delay = time.Minute
+	m.OperationTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "slow.test.com", Type: "A", Value: "10.0.0.1"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expecting the addition to time out with the HTTP status code 504. Got err '%v'", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expecting the addition to give up after the operation timeout. Took %v", elapsed)
+	}
+	if m.HasDNSRecord("slow.test.com", "A") {
+		t.Errorf("Expecting the record to not be saved after a timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = m.UpdateDNSRecordContext(ctx, hookTypes.DNSRecord{Name: "slow.test.com", Type: "A", Value: "10.0.0.1"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expecting the update to give up with the caller context. Got err '%v'", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	m, updater, rs := initManagerWithNRecords(1, t)
+	m.RemovalDelay = time.Minute
+	if err := m.RemoveDNSRecord(rs[0].Name, rs[0].Type); err != nil {
+		t.Fatalf("Expecting removal of the record '%v' to succeed. Got err '%v'", rs[0].Name, err)
+	}
+
+	updater.Delay = time.Minute
+	done := make(chan error)
+	go func() {
+		done <- m.AddDNSRecord(hookTypes.DNSRecord{Name: "slow.test.com", Type: "A", Value: "10.0.0.1"})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	shutdown := make(chan struct{})
+	go func() {
+		m.Shutdown()
+		close(shutdown)
+	}()
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expecting the shutdown to stop the delayed removals")
+	}
+	select {
+	case err := <-done:
+		if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expecting the addition in progress to be cancelled. Got err '%v'", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expecting the shutdown to cancel the addition in progress")
+	}
+	if atomic.LoadUint64(&updater.RemovalCount) != 0 {
+		t.Errorf("Expecting the delayed removal to be aborted. Got %v removals", updater.RemovalCount)
+	}
+	if !m.removalPending(rs[0].Name, rs[0].Type) {
+		t.Errorf("Expecting the aborted removal to be kept for the next startup")
+	}
+	_ = m.Store.Delete(m.getRemovalFileName(rs[0].Name, rs[0].Type))
+}
+
 func TestGetRecordFileName(t *testing.T) {
 	m, _, _ := initManagerWithNRecords(0, t)
 
@@ -165,6 +458,24 @@ func TestGetRecordName(t *testing.T) {
 	}
 }
 
+// newTestManager creates a Manager of the updater storing its records in its own temporary directory, along with the
+// function shutting it down and removing the directory
+func newTestManager(t *testing.T, b *Builder, updater azure.DNSUpdater) (*Manager, func()) {
+	dir, err := ioutil.TempDir("", "bindman-manager")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	m, err := b.New(updater, dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatalf("Expecting the Manager to be created. Got err '%v'", err)
+	}
+	return m, func() {
+		m.Shutdown()
+		_ = os.RemoveAll(dir)
+	}
+}
+
 func initManagerWithNRecords(numberOfRecords int, t *testing.T) (*Manager, *MockDNSUpdater, []hookTypes.DNSRecord) {
 	updater := new(MockDNSUpdater)
 	updater.Result = true
@@ -185,20 +496,66 @@ func initManagerWithNRecords(numberOfRecords int, t *testing.T) (*Manager, *Mock
 
 // MockDNSUpdater defines a mock AzUpdater for unit testing the manager
 type MockDNSUpdater struct {
-	Result       bool
-	Error        error
-	RemovalCount uint64
+	Result        bool
+	Error         error
+	RemovalCount  uint64
+	RemovedValues []string
+	Delay         time.Duration
+	door          sync.Mutex
 }
 
-func (mnsu *MockDNSUpdater) AddRR(record hookTypes.DNSRecord, ttl time.Duration) (err error) {
-	return mnsu.Error
+func (mnsu *MockDNSUpdater) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error) {
+	return mnsu.wait(ctx)
 }
 
-func (mnsu *MockDNSUpdater) RemoveRR(name, recordType string) error {
+func (mnsu *MockDNSUpdater) RemoveRR(ctx context.Context, name, recordType, value string) error {
+	if err := mnsu.wait(ctx); err != nil {
+		return err
+	}
 	atomic.AddUint64(&mnsu.RemovalCount, 1)
+	mnsu.door.Lock()
+	defer mnsu.door.Unlock()
+	mnsu.RemovedValues = append(mnsu.RemovedValues, value)
 	return mnsu.Error
 }
 
-func (mnsu *MockDNSUpdater) UpdateRR(record hookTypes.DNSRecord, ttl time.Duration) error {
-	return mnsu.Error
+func (mnsu *MockDNSUpdater) UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	return mnsu.wait(ctx)
+}
+
+func (mnsu *MockDNSUpdater) SetRR(ctx context.Context, name, recordType string, values []string, ttl time.Duration) error {
+	return mnsu.wait(ctx)
+}
+
+// wait simulates a DNS server taking Delay to answer
+func (mnsu *MockDNSUpdater) wait(ctx context.Context) error {
+	if mnsu.Delay == 0 {
+		return mnsu.Error
+	}
+	select {
+	case <-time.After(mnsu.Delay):
+		return mnsu.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// MockZoneRouter defines a mock AzUpdater managing many zones
+type MockZoneRouter struct {
+	*MockDNSUpdater
+	Zones []string
+}
+
+func (mzr *MockZoneRouter) ZoneOf(name string) (string, bool) {
+	zone := ""
+	for _, z := range mzr.Zones {
+		if (name == z || strings.HasSuffix(name, "."+z)) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	return zone, zone != ""
+}
+
+func (mzr *MockZoneRouter) ManagedZones() []string {
+	return mzr.Zones
 }
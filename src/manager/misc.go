@@ -1,11 +1,14 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
 	"github.com/sirupsen/logrus"
 )
@@ -15,59 +18,270 @@ const (
 	Extension = "bindman"
 )
 
-// delayRemove schedules the removal of a DNS Resource Record
-// it cancels the operation when it identifies the name was read
-func (m *Manager) delayRemove(name, recordType string) {
-	if m.HasDNSRecord(name, recordType) {
-		go m.removeRecord(name, recordType) // marks its removal intent
-		ticker := time.NewTicker(m.RemovalDelay)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if _, err := m.DNSRecords.Read(m.getRecordFileName(name, recordType)); err == nil { // record has been read
-					logrus.Infof("Cancelling delayed removal of '%s' '%s'", name, recordType)
-					return
-				}
-
-				// only remove in case the record has not been read
-				if err := m.DNSUpdater.RemoveRR(name, recordType); err != nil {
-					logrus.Infof("Error occurred while trying to remove '%s' '%s': %s", name, recordType, err)
-				} else {
-					logrus.Infof("record name '%s' and type '%s' removed successfully", name, recordType)
-				}
-				return
-			}
+// delayRemove applies the delayed removal of a DNS Resource Record once it is due, retrying while the DNS server fails
+// or takes the record set as not managed by Bindman.
+// It cancels the operation when it identifies the record was added again
+func (m *Manager) delayRemove(removal Removal) {
+	defer m.removals.Done()
+	name, recordType := removal.Name, removal.Type
+	timer := time.NewTimer(time.Until(removal.DueAt))
+	defer timer.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			logrus.Warnf("Delayed removal of '%s' '%s' interrupted by the shutdown; it is resumed on the next startup", name, recordType)
+			return
+		case <-timer.C:
 		}
-	} else {
-		logrus.Errorf("Service '%v' cannot be removed given it does not exist.", name)
+
+		m.Door.RLock()
+		pending, added := m.isPending(removal), m.HasDNSRecord(name, recordType)
+		m.Door.RUnlock()
+		if !pending { // cancelled or scheduled again meanwhile
+			return
+		}
+		if added { // record has been added again
+			logrus.Infof("Cancelling delayed removal of '%s' '%s'", name, recordType)
+			m.forgetRemoval(removal)
+			m.audit(AuditEntry{Action: AuditCancelRemoval, Name: name, Type: recordType, Source: SourceRemoval, NewValues: m.storedValues(name, recordType),
+				Message: "the record was added again"}, nil)
+			return
+		}
+
+		// only remove in case the record has not been added again
+		ctx, cancel := m.operationContext(azure.WithStoredValues(m.ctx, removal.Values))
+		err := m.DNSUpdater.RemoveRR(ctx, name, recordType, "")
+		cancel()
+		if m.ctx.Err() != nil {
+			logrus.Warnf("Delayed removal of '%s' '%s' interrupted by the shutdown; it is resumed on the next startup", name, recordType)
+			return
+		}
+		m.audit(AuditEntry{Action: AuditDelete, Name: name, Type: recordType, Source: SourceRemoval, OldValues: removal.Values}, err)
+		if azure.IsConflict(err) {
+			logrus.Warnf("Record '%s' '%s' was changed by someone else and has not been removed: %s", name, recordType, err)
+		} else if azure.IsForeign(err) {
+			// kept pending for the record set to be adopted, or the removal to be cancelled
+			logrus.Warnf("Record '%s' '%s' is not managed by Bindman and has not been removed, retrying in %v: %s", name, recordType, m.removalRetryDelay(), err)
+			timer.Reset(m.removalRetryDelay())
+			continue
+		} else if err != nil {
+			logrus.Errorf("Error occurred while trying to remove '%s' '%s', retrying in %v: %s", name, recordType, m.removalRetryDelay(), err)
+			timer.Reset(m.removalRetryDelay())
+			continue
+		} else {
+			logrus.Infof("record name '%s' and type '%s' removed successfully", name, recordType)
+		}
+		m.forgetRemoval(removal)
+		return
+	}
+}
+
+// unchanged tells if the stored record set already holds exactly the values of the record, so that writing it can be skipped.
+// With VerifyUnchanged, the record set read back from the DNS server must hold them too, with the TTL
+func (m *Manager) unchanged(ctx context.Context, record Record) bool {
+	stored := m.storedValues(record.Name, record.Type)
+	if stored == nil || !sameValues(record.Type, stored, record.Values) {
+		return false
+	}
+	reader, ok := m.DNSUpdater.(azure.RecordSetReader)
+	if !m.VerifyUnchanged || !ok {
+		return true
+	}
+	ctx, cancel := m.operationContext(ctx)
+	defer cancel()
+	rs, err := reader.GetRecordSet(ctx, record.Name, record.Type)
+	if err != nil {
+		logrus.Warnf("Record '%s' '%s' not read back from the DNS server, writing it anyway: %v", record.Name, record.Type, err)
+		return false
+	}
+	return rs != nil && rs.TTL == m.TTL && sameValues(record.Type, rs.Values, record.Values)
+}
+
+// removalPending tells if the delayed removal of the record is in progress
+func (m *Manager) removalPending(name, recordType string) bool {
+	return m.Store.Has(m.getRemovalFileName(name, recordType))
+}
+
+// saveRecord saves a record set to the local storage, the action telling what changed it
+func (m *Manager) saveRecord(record Record, action string) error {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	return m.writeRecord(record, action)
+}
+
+// addRecordValue adds the record value to the record set in the local storage
+func (m *Manager) addRecordValue(record hookTypes.DNSRecord) error {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	r := &Record{Name: record.Name, Type: record.Type}
+	if m.HasDNSRecord(record.Name, record.Type) {
+		var err error
+		if r, err = m.readRecord(record.Name, record.Type); err != nil {
+			return err
+		}
+	}
+	r.addValue(record.Value)
+	return m.writeRecord(*r, AuditAdd)
+}
+
+// removeRecordValue removes the value from the record set in the local storage
+func (m *Manager) removeRecordValue(name, recordType, value string) error {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	r, err := m.readRecord(name, recordType)
+	if err != nil {
+		return err
 	}
+	r.removeValue(value)
+	return m.writeRecord(*r, AuditRemoveValue)
 }
 
-// saveRecord saves a record to the local storage
-func (m *Manager) saveRecord(record hookTypes.DNSRecord) (err error) {
+// readRecord reads a record set from the local storage; callers must hold the Door
+func (m *Manager) readRecord(name, recordType string) (record *Record, err error) {
 	var r []byte
-	r, err = json.Marshal(record)
+	r, err = m.Store.Get(m.getRecordFileName(name, recordType))
 	if err == nil {
-		m.Door.Lock()
-		defer m.Door.Unlock()
-
-		err = m.DNSRecords.Write(m.getRecordFileName(record.Name, record.Type), r)
+		err = json.Unmarshal(r, &record)
 	}
 	return
 }
 
+// writeRecord writes a record set to the local storage along with its new version; callers must hold the Door
+func (m *Manager) writeRecord(record Record, action string) error {
+	return m.Store.Update(func(b Bucket) error {
+		return m.putRecord(b, record, action)
+	})
+}
+
 // removeRecord removes the record
 func (m *Manager) removeRecord(recordName, recordType string) {
 	m.Door.Lock()
 	defer m.Door.Unlock()
 	// marks its removal
 	recordFileName := m.getRecordFileName(recordName, recordType)
-	if err := m.DNSRecords.Erase(recordFileName); err != nil {
+	if err := m.Store.Delete(recordFileName); err != nil {
 		logrus.Errorf("error to erase record '%s': %s", recordFileName, err)
 	}
 }
 
+// normalizeRecord checks if the record value is valid for its type and puts it in its canonical format
+func normalizeRecord(record hookTypes.DNSRecord) (hookTypes.DNSRecord, error) {
+	value, err := azure.NormalizeValue(record.Type, record.Value)
+	if err != nil {
+		return record, hookTypes.BadRequestError(fmt.Sprintf("the value '%s' is not allowed for a record of type '%s'", record.Value, record.Type), err, err.Error())
+	}
+	record.Value = value
+	return record, nil
+}
+
+// operationContext returns the context of a call to the DNSUpdater: done when ctx is done,
+// when the OperationTimeout elapses or when the Manager shuts down
+func (m *Manager) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if m.OperationTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.OperationTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// addConflict fails with the HTTP status code 409 when the record set, once a value is added, drops one of the values
+// it held, i.e. when it is single valued or an alias holding another value
+func addConflict(record Record, oldValues []string) error {
+	for _, value := range oldValues {
+		if !record.HasValue(value) {
+			return &hookTypes.Error{
+				Message: fmt.Sprintf("a record with name '%s' and type '%s' already exists with the value '%s'; update it to replace its value", record.Name, record.Type, value),
+				Code:    http.StatusConflict,
+			}
+		}
+	}
+	return nil
+}
+
+// checkZone fails with the HTTP status code 400 when the record name belongs to none of the managed zones
+func (m *Manager) checkZone(name string) error {
+	if _, managed := m.zoneOf(name); !managed {
+		return hookTypes.BadRequestError(fmt.Sprintf("the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.<zone>', where <zone> is one of %s",
+			name, strings.Join(m.ManagedZones(), ", ")), nil)
+	}
+	return nil
+}
+
+// updaterError turns the conflicts and the foreign record sets reported by the DNSUpdater into errors with the HTTP status code 409,
+// and the calls given up because ctx is done into errors with the HTTP status codes 504 or 503
+func updaterError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case azure.IsConflict(err):
+		return &hookTypes.Error{
+			Message: "the record set was changed by someone else since Bindman last wrote it; check it and retry",
+			Code:    http.StatusConflict,
+			Details: []string{err.Error()},
+			Err:     err,
+		}
+	case azure.IsForeign(err):
+		return &hookTypes.Error{
+			Message: "the record set exists in the zone but is not managed by Bindman; adopt the foreign records to take it over",
+			Code:    http.StatusConflict,
+			Details: []string{err.Error()},
+			Err:     err,
+		}
+	case ctx.Err() == context.DeadlineExceeded:
+		return &hookTypes.Error{
+			Message: "the DNS server took too long to answer; retry later",
+			Code:    http.StatusGatewayTimeout,
+			Details: []string{err.Error()},
+			Err:     err,
+		}
+	case ctx.Err() == context.Canceled:
+		return &hookTypes.Error{
+			Message: "the operation was cancelled, e.g. by a shutdown; retry later",
+			Code:    http.StatusServiceUnavailable,
+			Details: []string{err.Error()},
+			Err:     err,
+		}
+	}
+	return err
+}
+
+// IsConflict tells if err reports a record set changed by someone else since Bindman last wrote it
+func IsConflict(err error) bool {
+	if e, ok := err.(*hookTypes.Error); ok {
+		err = e.Err
+	}
+	return azure.IsConflict(err)
+}
+
+// IsForeign tells if err reports a record set existing in the zone but not managed by Bindman
+func IsForeign(err error) bool {
+	if e, ok := err.(*hookTypes.Error); ok {
+		err = e.Err
+	}
+	return azure.IsForeign(err)
+}
+
+// zoneOf returns the managed zone the record name belongs to.
+// Every name is taken as managed when the DNSUpdater does not tell the zones apart
+func (m *Manager) zoneOf(name string) (string, bool) {
+	if router, ok := m.DNSUpdater.(azure.ZoneRouter); ok {
+		return router.ZoneOf(name)
+	}
+	return "", true
+}
+
 // getRecordFileName return the name of the file holding the record information
 func (m *Manager) getRecordFileName(recordName, recordType string) string {
 	toReturn := fmt.Sprintf("%v.%v.%v", recordName, recordType, Extension)
@@ -0,0 +1,372 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OperationExtension sets the extension of the files holding the asynchronous writes
+	OperationExtension = "operation"
+	// operationPurgeInterval is the time between two purges of the operations finished for longer than AsyncRetention
+	operationPurgeInterval = time.Hour
+)
+
+// the statuses of an asynchronous write
+const (
+	// OperationPending is a write waiting to be applied to the DNS server, or to be retried
+	OperationPending = "pending"
+	// OperationApplied is a write applied to the DNS server and the local storage
+	OperationApplied = "applied"
+	// OperationFailed is a write the DNS server rejected, or failed to apply AsyncMaxAttempts times
+	OperationFailed = "failed"
+)
+
+// Operation is an asynchronous write of a record, kept in the local storage from its submission until it is purged
+type Operation struct {
+	// ID identifies the operation; the IDs sort in the order the operations were submitted
+	ID string `json:"id"`
+
+	// Action is AuditAdd to add the value of the record to its record set, or AuditUpdate to replace all its values
+	Action string `json:"action"`
+
+	// Record is the record written
+	Record hookTypes.DNSRecord `json:"record"`
+
+	// Status is OperationPending, OperationApplied or OperationFailed
+	Status string `json:"status"`
+
+	// Attempts is the number of times the write was tried
+	Attempts int `json:"attempts"`
+
+	// Error tells why the last attempt failed
+	Error string `json:"error,omitempty"`
+
+	// SubmittedAt is when the operation was submitted
+	SubmittedAt time.Time `json:"submittedAt"`
+
+	// UpdatedAt is when the status of the operation last changed
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OperationQuery filters the operations; its zero value matches them all
+type OperationQuery struct {
+	// Name matches the operations of the record name, case insensitively
+	Name string
+	// Type matches the operations of the record type
+	Type string
+	// Status matches the operations of the status
+	Status string
+}
+
+// operationQueue holds the operations waiting for a worker, in the order they were submitted
+type operationQueue struct {
+	door    sync.Mutex
+	pending []Operation
+	// ready wakes the worker up when an operation is pushed
+	ready chan struct{}
+}
+
+// SubmitAddDNSRecord queues the addition of a value to a DNS record set, returning its operation right away
+func (m *Manager) SubmitAddDNSRecord(record hookTypes.DNSRecord) (*Operation, error) {
+	return m.submit(AuditAdd, record)
+}
+
+// SubmitUpdateDNSRecord queues the replacement of all the values of a DNS record set, returning its operation right away
+func (m *Manager) SubmitUpdateDNSRecord(record hookTypes.DNSRecord) (*Operation, error) {
+	return m.submit(AuditUpdate, record)
+}
+
+// GetOperation retrieves the operation identified by id
+func (m *Manager) GetOperation(id string) (*Operation, error) {
+	op, err := m.readOperation(m.getOperationFileName(id))
+	if err == ErrNotFound {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No operation found with id '%s'", id), nil)
+	}
+	return op, err
+}
+
+// ListOperations retrieves the operations matched by the query, in the order they were submitted
+func (m *Manager) ListOperations(q OperationQuery) ([]Operation, error) {
+	keys, err := m.Store.List("." + OperationExtension)
+	if err != nil {
+		return nil, err
+	}
+	result := []Operation{}
+	for _, key := range keys {
+		op, err := m.readOperation(key)
+		if err == ErrNotFound { // purged meanwhile
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if q.matches(*op) {
+			result = append(result, *op)
+		}
+	}
+	return result, nil
+}
+
+// StartOperationWorkers applies the submitted operations in the background with AsyncWorkers workers until the Manager
+// shuts down, starting with the ones left pending by the last run. The operations of a record set are applied one at
+// a time, in the order they were submitted. Does nothing unless AsyncWrites is set
+func (m *Manager) StartOperationWorkers() error {
+	if !m.AsyncWrites {
+		return nil
+	}
+	pending, err := m.ListOperations(OperationQuery{Status: OperationPending})
+	if err != nil {
+		return err
+	}
+
+	m.operations.Lock()
+	defer m.operations.Unlock()
+	m.queues = make([]*operationQueue, m.asyncWorkers())
+	for i := range m.queues {
+		m.queues[i] = &operationQueue{ready: make(chan struct{}, 1)}
+		m.jobs.Add(1)
+		go m.runOperations(m.queues[i])
+	}
+	for _, op := range pending {
+		m.queueOf(op.Record).push(op)
+	}
+	if m.AsyncRetention > 0 {
+		m.jobs.Add(1)
+		go m.purgeOperationsPeriodically()
+	}
+
+	if len(pending) > 0 {
+		logrus.Infof("%d pending asynchronous writes resumed", len(pending))
+	}
+	logrus.Infof("Asynchronous writes applied by %d workers", len(m.queues))
+	return nil
+}
+
+// submit keeps the operation in the local storage before queuing it, once checked as the synchronous writes check it:
+// its record must be valid and belong to a managed zone, and an addition must not conflict with the stored values
+func (m *Manager) submit(action string, record hookTypes.DNSRecord) (*Operation, error) {
+	if !m.AsyncWrites {
+		return nil, hookTypes.BadRequestError("the asynchronous writes are disabled", nil)
+	}
+	record, err := normalizeRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkZone(record.Name); err != nil {
+		return nil, err
+	}
+	if action == AuditAdd {
+		oldValues := m.storedValues(record.Name, record.Type)
+		r := Record{Name: record.Name, Type: record.Type, Values: append([]string{}, oldValues...)}
+		r.addValue(record.Value)
+		if err := addConflict(r, oldValues); err != nil {
+			return nil, err
+		}
+	}
+
+	m.operations.Lock()
+	defer m.operations.Unlock()
+	now := time.Now().UTC()
+	op := &Operation{ID: m.nextOperationID(now), Action: action, Record: record, Status: OperationPending, SubmittedAt: now, UpdatedAt: now}
+	if err := m.writeOperation(*op); err != nil {
+		return nil, err
+	}
+	if m.queues != nil { // picked up by StartOperationWorkers otherwise
+		m.queueOf(record).push(*op)
+	}
+	logrus.Infof("Operation '%s' to %s the record '%s' '%s' with value '%s' submitted", op.ID, action, record.Name, record.Type, record.Value)
+	return op, nil
+}
+
+// runOperations applies the operations of the queue one at a time until the Manager shuts down
+func (m *Manager) runOperations(q *operationQueue) {
+	defer m.jobs.Done()
+	for m.ctx.Err() == nil {
+		op, found := q.pop()
+		if !found {
+			select {
+			case <-m.ctx.Done():
+			case <-q.ready:
+			}
+			continue
+		}
+		m.applyOperation(op)
+	}
+}
+
+// applyOperation applies the operation, retrying it while the DNS server fails, at most AsyncMaxAttempts times.
+// An operation interrupted by the shutdown is left pending, to be resumed on the next startup
+func (m *Manager) applyOperation(op Operation) {
+	delay := m.AsyncRetryDelay
+	for {
+		var err error
+		op.Attempts++
+		if op.Action == AuditUpdate {
+			err = m.UpdateDNSRecordContext(withSource(m.ctx, SourceAsync), op.Record)
+		} else {
+			err = m.AddDNSRecordContext(withSource(m.ctx, SourceAsync), op.Record)
+		}
+		if m.ctx.Err() != nil {
+			logrus.Warnf("Operation '%s' interrupted by the shutdown; it is resumed on the next startup", op.ID)
+			return
+		}
+
+		op.UpdatedAt, op.Error = time.Now().UTC(), ""
+		switch {
+		case err == nil:
+			op.Status = OperationApplied
+			logrus.Infof("Operation '%s' applied", op.ID)
+		case !retryable(err) || op.Attempts >= m.asyncMaxAttempts():
+			op.Status, op.Error = OperationFailed, auditError(err)
+			logrus.Errorf("Operation '%s' failed after %d attempts: %v", op.ID, op.Attempts, err)
+		default:
+			op.Error = auditError(err)
+			logrus.Warnf("Operation '%s' failed, retrying in %v: %v", op.ID, delay, err)
+		}
+		if err := m.writeOperation(op); err != nil {
+			logrus.Errorf("Error occurred while writing the operation '%s': %v", op.ID, err)
+		}
+		if op.Status != OperationPending {
+			return
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// purgeOperationsPeriodically purges the operations finished for longer than AsyncRetention until the Manager shuts down
+func (m *Manager) purgeOperationsPeriodically() {
+	defer m.jobs.Done()
+	ticker := time.NewTicker(operationPurgeInterval)
+	defer ticker.Stop()
+	for {
+		m.purgeOperations(time.Now().Add(-m.AsyncRetention))
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeOperations erases the operations applied or failed before the time from the local storage
+func (m *Manager) purgeOperations(before time.Time) {
+	ops, err := m.ListOperations(OperationQuery{})
+	if err != nil {
+		logrus.Errorf("Error occurred while purging the finished operations: %v", err)
+		return
+	}
+	for _, op := range ops {
+		if op.Status != OperationPending && op.UpdatedAt.Before(before) {
+			if err := m.Store.Delete(m.getOperationFileName(op.ID)); err != nil {
+				logrus.Errorf("Error occurred while purging the operation '%s': %v", op.ID, err)
+			}
+		}
+	}
+}
+
+// queueOf returns the queue of the operations of the record set; callers must hold operations
+func (m *Manager) queueOf(record hookTypes.DNSRecord) *operationQueue {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(reconcileKey(record.Name, record.Type)))
+	return m.queues[h.Sum32()%uint32(len(m.queues))]
+}
+
+// nextOperationID returns an ID sorting after all the ones returned before; callers must hold operations
+func (m *Manager) nextOperationID(now time.Time) string {
+	id := now.UnixNano()
+	if id <= m.lastOperationID {
+		id = m.lastOperationID + 1
+	}
+	m.lastOperationID = id
+	return fmt.Sprintf("%016x", id)
+}
+
+// asyncWorkers returns the number of workers applying the operations
+func (m *Manager) asyncWorkers() int {
+	if m.AsyncWorkers < 1 {
+		return 1
+	}
+	return m.AsyncWorkers
+}
+
+// asyncMaxAttempts returns the maximum number of times an operation is tried
+func (m *Manager) asyncMaxAttempts() int {
+	if m.AsyncMaxAttempts < 1 {
+		return 1
+	}
+	return m.AsyncMaxAttempts
+}
+
+// retryable tells if a write failed because of the DNS server rather than because of the request, e.g. a conflict
+func retryable(err error) bool {
+	e, ok := err.(*hookTypes.Error)
+	return !ok || e.Code >= http.StatusInternalServerError
+}
+
+// push queues the operation, waking the worker up
+func (q *operationQueue) push(op Operation) {
+	q.door.Lock()
+	q.pending = append(q.pending, op)
+	q.door.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop dequeues the oldest operation; false when none is queued
+func (q *operationQueue) pop() (Operation, bool) {
+	q.door.Lock()
+	defer q.door.Unlock()
+	if len(q.pending) == 0 {
+		return Operation{}, false
+	}
+	op := q.pending[0]
+	q.pending = q.pending[1:]
+	return op, true
+}
+
+// matches tells if the query matches the operation
+func (q OperationQuery) matches(op Operation) bool {
+	return (q.Name == "" || strings.EqualFold(q.Name, op.Record.Name)) &&
+		(q.Type == "" || strings.EqualFold(q.Type, op.Record.Type)) &&
+		(q.Status == "" || q.Status == op.Status)
+}
+
+// readOperation reads an operation from the local storage
+func (m *Manager) readOperation(fileName string) (op *Operation, err error) {
+	var o []byte
+	o, err = m.Store.Get(fileName)
+	if err == nil {
+		err = json.Unmarshal(o, &op)
+	}
+	return
+}
+
+// writeOperation writes an operation to the local storage
+func (m *Manager) writeOperation(op Operation) error {
+	o, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	return m.Store.Put(m.getOperationFileName(op.ID), o)
+}
+
+// getOperationFileName return the name of the file holding the operation
+func (m *Manager) getOperationFileName(id string) string {
+	return fmt.Sprintf("%v.%v", id, OperationExtension)
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// FlakyZone defines a mock AzUpdater whose additions fail Failures times before reaching its MockZone
+type FlakyZone struct {
+	*MockZone
+	Failures int32
+}
+
+func (fz *FlakyZone) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	if atomic.AddInt32(&fz.Failures, -1) >= 0 {
+		return errors.New("azure: the DNS server is unavailable")
+	}
+	return fz.MockZone.AddRR(ctx, record, ttl)
+}
+
+// initOperationTest creates a Manager queuing its writes to a FlakyZone in its own storage
+func initOperationTest(t *testing.T, failures int32) (*Manager, *FlakyZone, func()) {
+	zone := &FlakyZone{MockZone: newMockZone(), Failures: failures}
+	b := &Builder{TTL: time.Hour, AsyncWrites: true, AsyncWorkers: 2, AsyncMaxAttempts: 3, AsyncRetryDelay: 10 * time.Millisecond, AsyncRetention: time.Hour}
+	m, cleanup := newTestManager(t, b, zone)
+	return m, zone, cleanup
+}
+
+// waitOperation waits for the operation to be applied or to fail
+func waitOperation(t *testing.T, m *Manager, id string) *Operation {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op, err := m.GetOperation(id)
+		if err != nil {
+			t.Fatalf("Expecting the operation '%s' to be found. Got err '%v'", id, err)
+		}
+		if op.Status != OperationPending || time.Now().After(deadline) {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubmitDisabled(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	if _, err := m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"}); err == nil {
+		t.Errorf("Expecting the submission to fail while the asynchronous writes are disabled")
+	}
+}
+
+func TestSubmitChecks(t *testing.T) {
+	router := &MockZoneRouter{MockDNSUpdater: new(MockDNSUpdater), Zones: []string{"test.com"}}
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour}, router)
+	defer cleanup()
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "www.test.com"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	m.AsyncWrites = true
+
+	_, err := m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.other.com", Type: "A", Value: "10.0.0.1"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Expecting a record outside the managed zones to be rejected right away with the HTTP status code 400. Got err '%v'", err)
+	}
+	_, err = m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "api.test.com"})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusConflict {
+		t.Errorf("Expecting an addition conflicting with the stored value to be rejected right away with the HTTP status code 409. Got err '%v'", err)
+	}
+	if _, err := m.SubmitUpdateDNSRecord(hookTypes.DNSRecord{Name: "alias.test.com", Type: "CNAME", Value: "api.test.com"}); err != nil {
+		t.Errorf("Expecting the update replacing the stored value to be queued. Got err '%v'", err)
+	}
+	if ops, err := m.ListOperations(OperationQuery{}); err != nil || len(ops) != 1 {
+		t.Errorf("Expecting only the update to be queued. Got %v and err '%v'", ops, err)
+	}
+}
+
+func TestAsyncWrites(t *testing.T) {
+	m, zone, cleanup := initOperationTest(t, 0)
+	defer cleanup()
+	if err := m.StartOperationWorkers(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if _, err := m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "MX", Value: "invalid"}); err == nil {
+		t.Errorf("Expecting an invalid record to be rejected right away")
+	}
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("Expecting the addition to be queued. Got err '%v'", err)
+		}
+	}
+	op, err := m.SubmitUpdateDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.3"})
+	if err != nil || op.Status != OperationPending || op.ID == "" {
+		t.Fatalf("Expecting the update to be queued. Got %v and err '%v'", op, err)
+	}
+	last := op.ID
+	op, _ = m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.4"})
+	if op.ID <= last {
+		t.Errorf("Expecting the IDs to sort in the order of submission. Got '%s' after '%s'", op.ID, last)
+	}
+
+	if op = waitOperation(t, m, op.ID); op.Status != OperationApplied || op.Attempts != 1 {
+		t.Fatalf("Expecting the operation to be applied. Got %+v", op)
+	}
+	expected := []string{"10.0.0.3", "10.0.0.4"}
+	if r, err := m.GetRecord("www.test.com", "A"); err != nil || !reflect.DeepEqual(r.Values, expected) {
+		t.Errorf("Expecting the operations of the record set to be applied in order. Got %v and err '%v'", r, err)
+	}
+	if rs := zone.RecordSets[reconcileKey("www.test.com", "A")]; !reflect.DeepEqual(rs.Values, expected) {
+		t.Errorf("Expecting the operations to be applied to the zone. Got %v", rs.Values)
+	}
+	if ops, err := m.ListOperations(OperationQuery{Name: "WWW.test.com", Status: OperationApplied}); err != nil || len(ops) != 4 || ops[0].Record.Value != "10.0.0.1" {
+		t.Errorf("Expecting the applied operations to be listed in order. Got %v and err '%v'", ops, err)
+	}
+
+	m.purgeOperations(time.Now().Add(time.Hour))
+	if ops, err := m.ListOperations(OperationQuery{}); err != nil || len(ops) != 0 {
+		t.Errorf("Expecting the finished operations to be purged. Got %v and err '%v'", ops, err)
+	}
+}
+
+func TestAsyncWritesRetry(t *testing.T) {
+	m, _, cleanup := initOperationTest(t, 2)
+	defer cleanup()
+	_ = m.StartOperationWorkers()
+
+	op, _ := m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"})
+	if op = waitOperation(t, m, op.ID); op.Status != OperationApplied || op.Attempts != 3 || op.Error != "" {
+		t.Errorf("Expecting the operation to be applied once the DNS server recovered. Got %+v", op)
+	}
+
+	atomic.StoreInt32(&m.DNSUpdater.(*FlakyZone).Failures, 3)
+	op, _ = m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.2"})
+	if op = waitOperation(t, m, op.ID); op.Status != OperationFailed || op.Attempts != 3 || op.Error != "azure: the DNS server is unavailable" {
+		t.Errorf("Expecting the operation to fail after the maximum number of attempts. Got %+v", op)
+	}
+	if r, _ := m.GetRecord("www.test.com", "A"); !reflect.DeepEqual(r.Values, []string{"10.0.0.1"}) {
+		t.Errorf("Expecting the failed operation to be left out of the local storage. Got %v", r)
+	}
+}
+
+func TestResumeOperations(t *testing.T) {
+	m, zone, cleanup := initOperationTest(t, 0)
+	defer cleanup()
+
+	// submitted before the workers start, as on a restart the operation is only found in the local storage
+	op, err := m.SubmitAddDNSRecord(hookTypes.DNSRecord{Name: "www.test.com", Type: "A", Value: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(zone.RecordSets) != 0 {
+		t.Fatalf("Expecting the operation to wait for the workers")
+	}
+
+	if err := m.StartOperationWorkers(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if op = waitOperation(t, m, op.ID); op.Status != OperationApplied || !m.HasDNSRecord("www.test.com", "A") {
+		t.Errorf("Expecting the operation left pending to be applied on the next startup. Got %+v", op)
+	}
+	if _, err := m.GetOperation("missing"); err == nil {
+		t.Errorf("Expecting an unknown operation to be missing")
+	}
+}
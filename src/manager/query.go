@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// RecordQuery filters the stored records; its zero value matches them all
+type RecordQuery struct {
+	// Type matches the records of the type
+	Type string
+	// Prefix matches the records whose name starts with it
+	Prefix string
+	// Zone matches the records of the managed zone
+	Zone string
+	// Owner matches the records last stored by the Bindman instance of the InstanceID
+	Owner string
+	// CreatedBefore matches the records first stored before it, when set
+	CreatedBefore time.Time
+	// CreatedAfter matches the records first stored after it, when set
+	CreatedAfter time.Time
+	// UpdatedBefore matches the records last written before it, when set
+	UpdatedBefore time.Time
+	// UpdatedAfter matches the records last written after it, when set
+	UpdatedAfter time.Time
+}
+
+// StoredRecord is a record set along with the times it was stored; the times are zero when the Store does not keep them
+type StoredRecord struct {
+	// Name the DNS host name
+	Name string `json:"name"`
+
+	// Type the record type
+	Type string `json:"type"`
+
+	// Values the values of this record set
+	Values []string `json:"values"`
+
+	// Owner is the InstanceID of the Bindman that last stored the record set; empty when none was set
+	Owner string `json:"owner,omitempty"`
+
+	// CreatedAt is when the record set was first stored
+	CreatedAt time.Time `json:"createdAt"`
+
+	// UpdatedAt is when the record set was last written
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RecordQuerier is implemented by the Stores able to filter the records themselves, keeping the times they were written.
+// They filter by Type, Prefix, Owner and the times, the Manager telling the zones apart
+type RecordQuerier interface {
+	QueryRecords(q RecordQuery) ([]StoredRecord, error)
+}
+
+// QueryRecords retrieves the stored records of the managed zones matched by the query, sorted by name and type.
+// Filtering by the time of the first or the last write requires a Store implementing RecordQuerier
+func (m *Manager) QueryRecords(q RecordQuery) (records []StoredRecord, err error) {
+	q.Type = strings.ToUpper(q.Type)
+	if querier, ok := m.Store.(RecordQuerier); ok {
+		m.Door.RLock()
+		records, err = querier.QueryRecords(q)
+		m.Door.RUnlock()
+	} else if !q.UpdatedBefore.IsZero() || !q.UpdatedAfter.IsZero() || !q.CreatedBefore.IsZero() || !q.CreatedAfter.IsZero() {
+		return nil, hookTypes.BadRequestError("filtering the records by the time of their first or last write requires the sqlite store", nil)
+	} else {
+		records, err = m.scanRecords(q)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zone := azure.UnFqdn(q.Zone)
+	result := make([]StoredRecord, 0, len(records))
+	for _, record := range records {
+		z, managed := m.zoneOf(record.Name)
+		if managed && (zone == "" || strings.EqualFold(azure.UnFqdn(z), zone)) {
+			result = append(result, record)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result, nil
+}
+
+// scanRecords reads all the stored records, keeping the ones of the type, prefix and owner of the query
+func (m *Manager) scanRecords(q RecordQuery) ([]StoredRecord, error) {
+	records, err := m.listRecords(func(string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	var result []StoredRecord
+	for _, record := range records {
+		if (q.Type == "" || record.Type == q.Type) && strings.HasPrefix(record.Name, q.Prefix) && (q.Owner == "" || record.Owner == q.Owner) {
+			result = append(result, StoredRecord{Name: record.Name, Type: record.Type, Values: record.Values, Owner: record.Owner})
+		}
+	}
+	return result, nil
+}
+
+// decodeStoredRecord decodes the record stored as value
+func decodeStoredRecord(value []byte, createdAt, updatedAt time.Time) (StoredRecord, error) {
+	var record Record
+	if err := json.Unmarshal(value, &record); err != nil {
+		return StoredRecord{}, err
+	}
+	return StoredRecord{Name: record.Name, Type: record.Type, Values: record.Values, Owner: record.Owner, CreatedAt: createdAt, UpdatedAt: updatedAt}, nil
+}
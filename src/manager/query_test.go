@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestQueryRecords(t *testing.T) {
+	for _, storeType := range []string{DiskvStore, SQLiteStore} {
+		t.Run(storeType, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "bindman-query")
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			defer os.RemoveAll(dir)
+			updater := &MockZoneRouter{MockDNSUpdater: new(MockDNSUpdater), Zones: []string{"test.com", "sub.test.com"}}
+			m, err := (&Builder{StoreType: storeType}).New(updater, dir)
+			if err != nil {
+				t.Fatalf("Expecting the Manager to be created. Got err '%v'", err)
+			}
+			defer m.Shutdown()
+
+			for _, record := range []hookTypes.DNSRecord{
+				{Name: "www.test.com", Type: "A", Value: "10.0.0.1"},
+				{Name: "www.test.com", Type: "TXT", Value: "v=spf1 -all"},
+				{Name: "api.test.com", Type: "A", Value: "10.0.0.2"},
+				{Name: "www.sub.test.com", Type: "A", Value: "10.0.0.3"},
+			} {
+				if err := m.AddDNSRecord(record); err != nil {
+					t.Fatalf("got error %v", err)
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			since := time.Now()
+			if err := m.UpdateDNSRecord(hookTypes.DNSRecord{Name: "api.test.com", Type: "A", Value: "10.0.0.4"}); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			for _, tc := range []struct {
+				query    RecordQuery
+				expected []string
+			}{
+				{RecordQuery{}, []string{"api.test.com/A", "www.sub.test.com/A", "www.test.com/A", "www.test.com/TXT"}},
+				{RecordQuery{Type: "a"}, []string{"api.test.com/A", "www.sub.test.com/A", "www.test.com/A"}},
+				{RecordQuery{Prefix: "www."}, []string{"www.sub.test.com/A", "www.test.com/A", "www.test.com/TXT"}},
+				{RecordQuery{Zone: "test.com."}, []string{"api.test.com/A", "www.test.com/A", "www.test.com/TXT"}},
+				{RecordQuery{Zone: "sub.test.com", Type: "A"}, []string{"www.sub.test.com/A"}},
+			} {
+				records, err := m.QueryRecords(tc.query)
+				if err != nil {
+					t.Fatalf("Expecting the query %+v to succeed. Got err '%v'", tc.query, err)
+				}
+				got := make([]string, 0, len(records))
+				for _, record := range records {
+					got = append(got, record.Name+"/"+record.Type)
+				}
+				if !reflect.DeepEqual(got, tc.expected) {
+					t.Errorf("Expecting the query %+v to match %v. Got %v", tc.query, tc.expected, got)
+				}
+			}
+
+			records, err := m.QueryRecords(RecordQuery{UpdatedAfter: since})
+			if storeType == DiskvStore {
+				if err == nil {
+					t.Errorf("Expecting the diskv store to reject the filters by the time of the last write")
+				}
+				return
+			}
+			if err != nil || len(records) != 1 || records[0].Name != "api.test.com" || !reflect.DeepEqual(records[0].Values, []string{"10.0.0.4"}) {
+				t.Fatalf("Expecting only the updated record to be written after %v. Got %+v and err '%v'", since, records, err)
+			}
+			if !records[0].CreatedAt.Before(since) || records[0].UpdatedAt.Before(since) {
+				t.Errorf("Expecting the creation to be kept by the update. Got %+v", records[0])
+			}
+			if records, err = m.QueryRecords(RecordQuery{UpdatedBefore: since}); err != nil || len(records) != 3 {
+				t.Errorf("Expecting the 3 records left untouched to be written before %v. Got %+v and err '%v'", since, records, err)
+			}
+			if records, err = m.QueryRecords(RecordQuery{CreatedAfter: since}); err != nil || len(records) != 0 {
+				t.Errorf("Expecting no record to be created after %v. Got %+v and err '%v'", since, records, err)
+			}
+			if records, err = m.QueryRecords(RecordQuery{CreatedBefore: since, Type: "A"}); err != nil || len(records) != 3 {
+				t.Errorf("Expecting the 3 records of type A to be created before %v. Got %+v and err '%v'", since, records, err)
+			}
+		})
+	}
+}
+
+func TestQueryRecordsOwner(t *testing.T) {
+	for _, storeType := range []string{DiskvStore, SQLiteStore} {
+		t.Run(storeType, func(t *testing.T) {
+			m, cleanup := newTestManager(t, &Builder{StoreType: storeType, InstanceID: "blue"}, new(MockDNSUpdater))
+			defer cleanup()
+
+			for _, name := range []string{"blue.test.com", "green.test.com"} {
+				m.InstanceID = strings.TrimSuffix(name, ".test.com")
+				if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+					t.Fatalf("got error %v", err)
+				}
+			}
+			records, err := m.QueryRecords(RecordQuery{Owner: "green"})
+			if err != nil || len(records) != 1 || records[0].Name != "green.test.com" || records[0].Owner != "green" {
+				t.Errorf("Expecting only the record stored by the instance to match. Got %+v and err '%v'", records, err)
+			}
+			if records, err = m.QueryRecords(RecordQuery{}); err != nil || len(records) != 2 || records[0].Owner != "blue" {
+				t.Errorf("Expecting the records of all the instances without owner. Got %+v and err '%v'", records, err)
+			}
+			if _, err := m.QueryRecords(RecordQuery{CreatedAfter: time.Now()}); storeType == DiskvStore && err == nil {
+				t.Errorf("Expecting the diskv store to reject the filters by the time of the first write")
+			}
+		})
+	}
+}
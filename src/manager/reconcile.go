@@ -0,0 +1,227 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	"github.com/sirupsen/logrus"
+)
+
+// ReconcileReport tells the differences found between the local storage and the zones by a reconciliation
+type ReconcileReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// DryRun tells if the differences were only reported, leaving the zones untouched
+	DryRun bool `json:"dryRun"`
+	// Checked is the number of records of the local storage compared with the zones
+	Checked int `json:"checked"`
+	// Missing are the records of the local storage not found in the zones
+	Missing []Record `json:"missing"`
+	// Modified are the records of the local storage found in the zones with other values or another TTL
+	Modified []Record `json:"modified"`
+	// Extra are the record sets written by Bindman found in the zones but not in the local storage
+	Extra []Record `json:"extra"`
+	// Repaired are the missing and modified records written back to the zones
+	Repaired []Record `json:"repaired"`
+	// Errors tells the records that could not be repaired and why
+	Errors []string `json:"errors,omitempty"`
+}
+
+// StartReconciler reconciles the local storage with the zones every ReconcileInterval until the Manager shuts down.
+// Does nothing when no ReconcileInterval is set
+func (m *Manager) StartReconciler() {
+	if m.ReconcileInterval <= 0 {
+		return
+	}
+	m.jobs.Add(1)
+	go func() {
+		defer m.jobs.Done()
+		ticker := time.NewTicker(m.ReconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := m.Reconcile(m.ctx, m.ReconcileDryRun); err != nil {
+					logrus.Errorf("Error occurred while reconciling the records with the DNS server: %v", err)
+				}
+			}
+		}
+	}()
+	logrus.Infof("Records to be reconciled with the DNS server every %v", m.ReconcileInterval)
+}
+
+// Reconcile compares the records of the local storage with the record sets of the zones, writing back the missing and
+// modified ones unless dryRun is set. The record sets written by Bindman but missing from the local storage are only reported
+func (m *Manager) Reconcile(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	lister, ok := m.DNSUpdater.(azure.RecordSetLister)
+	if !ok {
+		return nil, errors.New("not possible to reconcile the records; the DNSUpdater cannot list the record sets of the zones")
+	}
+	m.reconciling.Lock()
+	defer m.reconciling.Unlock()
+
+	report := &ReconcileReport{StartedAt: time.Now().UTC(), DryRun: dryRun, Missing: []Record{}, Modified: []Record{}, Extra: []Record{}, Repaired: []Record{}}
+	listCtx, cancel := m.operationContext(ctx)
+	recordSets, err := lister.ListRecordSets(listCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	remote := map[string]azure.ZoneRecordSet{}
+	for _, rs := range recordSets {
+		remote[reconcileKey(rs.Name, rs.Type)] = rs
+	}
+
+	records, err := m.listRecords(func(string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	report.Checked = len(records)
+	var repairs []Record
+	for _, record := range records {
+		key := reconcileKey(record.Name, record.Type)
+		rs, found := remote[key]
+		delete(remote, key)
+		switch {
+		case !found:
+			report.Missing = append(report.Missing, record)
+			logrus.Warnf("Record '%s' of type '%s' missing from the DNS server", record.Name, record.Type)
+		case !sameValues(record.Type, record.Values, rs.Values) || int64(rs.TTL.Seconds()) != int64(m.TTL.Seconds()):
+			report.Modified = append(report.Modified, record)
+			logrus.Warnf("Record '%s' of type '%s' modified in the DNS server: %v with TTL %v instead of %v with TTL %v", record.Name, record.Type, rs.Values, rs.TTL, record.Values, m.TTL)
+		default:
+			continue
+		}
+		if !dryRun {
+			repairs = append(repairs, record)
+		}
+	}
+	report.Repaired, report.Errors = m.repairAll(ctx, repairs)
+
+	for _, rs := range remote {
+		if rs.Owned {
+			report.Extra = append(report.Extra, Record{Name: rs.Name, Type: rs.Type, Values: rs.Values})
+			logrus.Warnf("Record '%s' of type '%s' written by Bindman found in the DNS server but not in the local storage", rs.Name, rs.Type)
+		}
+	}
+	sortRecords(report.Extra)
+	report.FinishedAt = time.Now().UTC()
+	logrus.Infof("Records reconciled with the DNS server: %d checked, %d missing, %d modified, %d extra, %d repaired, %d errors",
+		report.Checked, len(report.Missing), len(report.Modified), len(report.Extra), len(report.Repaired), len(report.Errors))
+
+	m.reports.Lock()
+	m.lastReport = report
+	m.reports.Unlock()
+	return report, nil
+}
+
+// ReapplyRecords makes sure every record of the local storage exists in the DNS server with its values and TTL when
+// ReapplyOnStartup is set, writing back the records stored but never confirmed by the DNS server, e.g. because of an outage.
+// Meant to run on startup, before serving the webhook
+func (m *Manager) ReapplyRecords() error {
+	if !m.ReapplyOnStartup {
+		return nil
+	}
+	logrus.Infof("Re-applying the stored records to the DNS server, %d at a time", m.reconcileConcurrency())
+	report, err := m.Reconcile(m.ctx, m.ReconcileDryRun)
+	if err != nil {
+		return err
+	}
+	for _, e := range report.Errors {
+		logrus.Errorf("Error occurred while re-applying the stored records: %s", e)
+	}
+	return nil
+}
+
+// LastReconcileReport returns the report of the last reconciliation; nil when none ran yet
+func (m *Manager) LastReconcileReport() *ReconcileReport {
+	m.reports.Lock()
+	defer m.reports.Unlock()
+	return m.lastReport
+}
+
+// repairAll repairs the records, at most ReconcileConcurrency at once, returning the ones repaired along with the errors
+func (m *Manager) repairAll(ctx context.Context, records []Record) (repaired []Record, errs []string) {
+	repaired = []Record{}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, m.reconcileConcurrency())
+	for _, record := range records {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(record Record) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			err := m.repair(ctx, record)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("record '%s' of type '%s' not repaired: %v", record.Name, record.Type, err))
+				return
+			}
+			repaired = append(repaired, record)
+		}(record)
+	}
+	wg.Wait()
+	sortRecords(repaired)
+	sort.Strings(errs)
+	return
+}
+
+// reconcileConcurrency returns the maximum number of records repaired at once
+func (m *Manager) reconcileConcurrency() int {
+	if m.ReconcileConcurrency < 1 {
+		return 1
+	}
+	return m.ReconcileConcurrency
+}
+
+// repair writes the record set to the DNS server with all the values of the local storage, replacing the ones found there.
+// The record is left alone when it changed in the local storage since the reconciliation started
+func (m *Manager) repair(ctx context.Context, record Record) (err error) {
+	current, err := m.GetRecord(record.Name, record.Type)
+	if err != nil || !sameValues(record.Type, current.Values, record.Values) {
+		return errors.New("changed in the local storage in the meantime")
+	}
+	defer func() {
+		m.audit(AuditEntry{Action: AuditRepair, Name: record.Name, Type: record.Type, Source: SourceReconcile, NewValues: record.Values,
+			Message: "written back by a reconciliation"}, err)
+	}()
+
+	return m.writeValues(azure.WithOverwrite(ctx), record, m.TTL)
+}
+
+// writeValues writes the record set to the DNS server with all its values and the TTL at once, replacing the ones found there
+func (m *Manager) writeValues(ctx context.Context, record Record, ttl time.Duration) error {
+	ctx, cancel := m.operationContext(ctx)
+	defer cancel()
+	return updaterError(ctx, m.DNSUpdater.SetRR(ctx, record.Name, record.Type, record.Values, ttl))
+}
+
+// reconcileKey identifies a record set in both the local storage and the zones, whose names are case insensitive
+func reconcileKey(name, recordType string) string {
+	return strings.ToLower(azure.UnFqdn(name)) + "/" + recordType
+}
+
+// sortRecords sorts the records by name and type
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return reconcileKey(records[i].Name, records[i].Type) < reconcileKey(records[j].Name, records[j].Type)
+	})
+}
+
+// sameValues tells if both record sets hold the same values in any order
+func sameValues(recordType string, values, others []string) bool {
+	return azure.SameValues(recordType, values, others)
+}
@@ -0,0 +1,239 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// MockZone defines a mock AzUpdater keeping the record sets of its zone in memory
+type MockZone struct {
+	RecordSets map[string]azure.ZoneRecordSet
+	Writes     int
+	// Delay is the time each replacement of a record set takes, tracking the most replacements in progress at once
+	Delay       time.Duration
+	inFlight    int32
+	MaxInFlight int32
+	door        sync.Mutex
+}
+
+func newMockZone() *MockZone {
+	return &MockZone{RecordSets: map[string]azure.ZoneRecordSet{}}
+}
+
+func (mz *MockZone) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	mz.door.Lock()
+	defer mz.door.Unlock()
+	key := reconcileKey(record.Name, record.Type)
+	rs, found := mz.RecordSets[key]
+	if !found {
+		rs = azure.ZoneRecordSet{Name: record.Name, Type: record.Type, Owned: true}
+	}
+	rs.Values, rs.TTL = azure.AddValue(record.Type, rs.Values, record.Value), ttl
+	mz.RecordSets[key] = rs
+	mz.Writes++
+	return nil
+}
+
+func (mz *MockZone) UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	return mz.SetRR(ctx, record.Name, record.Type, []string{record.Value}, ttl)
+}
+
+func (mz *MockZone) SetRR(ctx context.Context, name, recordType string, values []string, ttl time.Duration) error {
+	inFlight := atomic.AddInt32(&mz.inFlight, 1)
+	defer atomic.AddInt32(&mz.inFlight, -1)
+	for max := atomic.LoadInt32(&mz.MaxInFlight); inFlight > max && !atomic.CompareAndSwapInt32(&mz.MaxInFlight, max, inFlight); {
+		max = atomic.LoadInt32(&mz.MaxInFlight)
+	}
+	time.Sleep(mz.Delay)
+
+	mz.door.Lock()
+	defer mz.door.Unlock()
+	mz.RecordSets[reconcileKey(name, recordType)] = azure.ZoneRecordSet{Name: name, Type: recordType, TTL: ttl, Values: append([]string{}, values...), Owned: true}
+	mz.Writes++
+	return nil
+}
+
+func (mz *MockZone) RemoveRR(ctx context.Context, name, recordType, value string) error {
+	mz.door.Lock()
+	defer mz.door.Unlock()
+	delete(mz.RecordSets, reconcileKey(name, recordType))
+	return nil
+}
+
+func (mz *MockZone) ListRecordSets(ctx context.Context) ([]azure.ZoneRecordSet, error) {
+	mz.door.Lock()
+	defer mz.door.Unlock()
+	var result []azure.ZoneRecordSet
+	for _, rs := range mz.RecordSets {
+		result = append(result, rs)
+	}
+	return result, nil
+}
+
+func (mz *MockZone) GetRecordSet(ctx context.Context, name, recordType string) (*azure.ZoneRecordSet, error) {
+	mz.door.Lock()
+	defer mz.door.Unlock()
+	rs, found := mz.RecordSets[reconcileKey(name, recordType)]
+	if !found {
+		return nil, nil
+	}
+	return &rs, nil
+}
+
+// initReconcileTest creates a Manager of a MockZone holding drifted records in its own storage
+func initReconcileTest(t *testing.T) (*Manager, *MockZone, func()) {
+	zone := newMockZone()
+	m, cleanup := newTestManager(t, &Builder{TTL: time.Hour}, zone)
+
+	for _, record := range []hookTypes.DNSRecord{
+		{Name: "ok.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "missing.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "missing.test.com", Type: "A", Value: "10.0.0.2"},
+		{Name: "modified.test.com", Type: "TXT", Value: "v=spf1 -all"},
+		{Name: "ttl.test.com", Type: "CNAME", Value: "www.test.com"},
+	} {
+		if err := m.AddDNSRecord(record); err != nil {
+			t.Fatalf("Expecting the addition of the record '%v' to succeed. Got err '%v'", record, err)
+		}
+	}
+	delete(zone.RecordSets, reconcileKey("missing.test.com", "A"))
+	zone.RecordSets[reconcileKey("modified.test.com", "TXT")] = azure.ZoneRecordSet{Name: "modified.test.com", Type: "TXT", TTL: time.Hour, Values: []string{"changed by hand"}, Owned: true}
+	rs := zone.RecordSets[reconcileKey("ttl.test.com", "CNAME")]
+	rs.TTL = time.Minute
+	zone.RecordSets[reconcileKey("ttl.test.com", "CNAME")] = rs
+	zone.RecordSets[reconcileKey("extra.test.com", "A")] = azure.ZoneRecordSet{Name: "extra.test.com", Type: "A", TTL: time.Hour, Values: []string{"10.0.0.3"}, Owned: true}
+	zone.RecordSets[reconcileKey("foreign.test.com", "A")] = azure.ZoneRecordSet{Name: "foreign.test.com", Type: "A", TTL: time.Hour, Values: []string{"10.0.0.4"}}
+	zone.Writes = 0
+
+	return m, zone, cleanup
+}
+
+func TestReconcile(t *testing.T) {
+	m, zone, cleanup := initReconcileTest(t)
+	defer cleanup()
+
+	report, err := m.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expecting the reconciliation to succeed. Got err '%v'", err)
+	}
+	expectedMissing := []Record{{Name: "missing.test.com", Type: "A", Values: []string{"10.0.0.1", "10.0.0.2"}}}
+	if !reflect.DeepEqual(report.Missing, expectedMissing) {
+		t.Errorf("Expecting the missing records %v. Got %v", expectedMissing, report.Missing)
+	}
+	if len(report.Modified) != 2 {
+		t.Errorf("Expecting the records with other values or another TTL to be reported as modified. Got %v", report.Modified)
+	}
+	expectedExtra := []Record{{Name: "extra.test.com", Type: "A", Values: []string{"10.0.0.3"}}}
+	if !reflect.DeepEqual(report.Extra, expectedExtra) {
+		t.Errorf("Expecting only the extra record sets written by Bindman to be reported. Got %v", report.Extra)
+	}
+	if len(report.Repaired) != 3 || len(report.Errors) != 0 {
+		t.Errorf("Expecting the missing and modified records to be repaired. Got %v and errors %v", report.Repaired, report.Errors)
+	}
+	if zone.Writes != 3 {
+		t.Errorf("Expecting each repaired record set to be written at once. Got %d writes", zone.Writes)
+	}
+
+	if got := zone.RecordSets[reconcileKey("missing.test.com", "A")].Values; !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expecting the missing record to be written back with all its values. Got %v", got)
+	}
+	if got := zone.RecordSets[reconcileKey("modified.test.com", "TXT")].Values; !reflect.DeepEqual(got, []string{"v=spf1 -all"}) {
+		t.Errorf("Expecting the modified record to be written back. Got %v", got)
+	}
+	if got := zone.RecordSets[reconcileKey("ttl.test.com", "CNAME")].TTL; got != time.Hour {
+		t.Errorf("Expecting the TTL to be written back. Got %v", got)
+	}
+	if _, found := zone.RecordSets[reconcileKey("extra.test.com", "A")]; !found {
+		t.Errorf("Expecting the extra record set to be left in the zone")
+	}
+	if m.LastReconcileReport() != report {
+		t.Errorf("Expecting the last report to be kept")
+	}
+
+	report, err = m.Reconcile(context.Background(), false)
+	if err != nil || len(report.Missing) != 0 || len(report.Modified) != 0 || len(report.Repaired) != 0 {
+		t.Errorf("Expecting no drift left after the reconciliation. Got %+v and err '%v'", report, err)
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	m, zone, cleanup := initReconcileTest(t)
+	defer cleanup()
+
+	report, err := m.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Expecting the reconciliation to succeed. Got err '%v'", err)
+	}
+	if !report.DryRun || len(report.Missing) != 1 || len(report.Modified) != 2 || len(report.Extra) != 1 {
+		t.Errorf("Expecting the differences to be reported. Got %+v", report)
+	}
+	if len(report.Repaired) != 0 || zone.Writes != 0 {
+		t.Errorf("Expecting the zone to be left untouched. Got %d writes", zone.Writes)
+	}
+}
+
+func TestReconcileWithoutLister(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	if _, err := m.Reconcile(context.Background(), false); err == nil {
+		t.Errorf("Expecting the reconciliation to fail when the DNSUpdater cannot list the record sets")
+	}
+}
+
+func TestStartReconciler(t *testing.T) {
+	m, _, cleanup := initReconcileTest(t)
+	defer cleanup()
+	m.ReconcileInterval = 10 * time.Millisecond
+	m.ReconcileDryRun = true
+
+	m.StartReconciler()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.LastReconcileReport() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if report := m.LastReconcileReport(); report == nil || !report.DryRun {
+		t.Errorf("Expecting the reconciler to run periodically in dry-run mode. Got %+v", report)
+	}
+	m.Shutdown()
+}
+
+func TestReapplyRecords(t *testing.T) {
+	m, zone, cleanup := initReconcileTest(t)
+	defer cleanup()
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("unconfirmed%d.test.com", i)
+		if err := m.saveRecord(Record{Name: name, Type: "A", Values: []string{"10.0.0.1"}}, AuditUpdate); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+
+	if err := m.ReapplyRecords(); err != nil || zone.Writes != 0 {
+		t.Fatalf("Expecting nothing to be re-applied unless ReapplyOnStartup is set. Got %d writes and err '%v'", zone.Writes, err)
+	}
+
+	m.ReapplyOnStartup = true
+	m.ReconcileConcurrency = 2
+	zone.Delay = 20 * time.Millisecond
+	if err := m.ReapplyRecords(); err != nil {
+		t.Fatalf("Expecting the stored records to be re-applied. Got err '%v'", err)
+	}
+	report := m.LastReconcileReport()
+	if report == nil || report.Checked != 10 || len(report.Repaired) != 9 || len(report.Errors) != 0 {
+		t.Fatalf("Expecting the unconfirmed, missing and modified records to be re-applied. Got %+v", report)
+	}
+	for i := 0; i < 6; i++ {
+		if _, found := zone.RecordSets[reconcileKey(fmt.Sprintf("unconfirmed%d.test.com", i), "A")]; !found {
+			t.Errorf("Expecting the unconfirmed record %d to be written to the zone", i)
+		}
+	}
+	if max := atomic.LoadInt32(&zone.MaxInFlight); max != 2 {
+		t.Errorf("Expecting at most 2 records to be re-applied at once. Got %d", max)
+	}
+}
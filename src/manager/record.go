@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"encoding/json"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// Record defines a record set being managed, holding all the values registered for its name and type
+type Record struct {
+	// Name the DNS host name
+	Name string `json:"name"`
+
+	// Type the record type
+	Type string `json:"type"`
+
+	// Values the values of this record set
+	Values []string `json:"values"`
+
+	// Owner is the InstanceID of the Bindman that last stored the record set; empty when none was set
+	Owner string `json:"owner,omitempty"`
+}
+
+// UnmarshalJSON decodes a Record, accepting the single valued format used by earlier versions
+func (r *Record) UnmarshalJSON(data []byte) error {
+	type record Record
+	aux := struct {
+		*record
+		Value string `json:"value"`
+	}{record: (*record)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(r.Values) == 0 && aux.Value != "" {
+		r.Values = []string{aux.Value}
+	}
+	return nil
+}
+
+// DNSRecords returns one DNSRecord for each value of the record set
+func (r *Record) DNSRecords() []hookTypes.DNSRecord {
+	records := make([]hookTypes.DNSRecord, 0, len(r.Values))
+	for _, value := range r.Values {
+		records = append(records, hookTypes.DNSRecord{Name: r.Name, Type: r.Type, Value: value})
+	}
+	return records
+}
+
+// HasValue tells if the record set holds the value
+func (r *Record) HasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// addValue adds the value to the record set; single valued and alias record sets get their value replaced
+func (r *Record) addValue(value string) {
+	r.Values = azure.AddValue(r.Type, r.Values, value)
+}
+
+// removeValue removes the value from the record set
+func (r *Record) removeValue(value string) {
+	values := make([]string, 0, len(r.Values))
+	for _, v := range r.Values {
+		if v != value {
+			values = append(values, v)
+		}
+	}
+	r.Values = values
+}
@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRecordUnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected Record
+	}{
+		{
+			"values",
+			`{"name":"a.test.com","type":"A","values":["10.0.0.1","10.0.0.2"]}`,
+			Record{Name: "a.test.com", Type: "A", Values: []string{"10.0.0.1", "10.0.0.2"}},
+		},
+		{
+			"single value from earlier versions",
+			`{"name":"a.test.com","type":"A","value":"10.0.0.1"}`,
+			Record{Name: "a.test.com", Type: "A", Values: []string{"10.0.0.1"}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var r Record
+			if err := json.Unmarshal([]byte(test.data), &r); err != nil {
+				t.Fatalf("Expecting the record to be decoded. Got err '%v'", err)
+			}
+			if !reflect.DeepEqual(r, test.expected) {
+				t.Errorf("got = %v, want %v", r, test.expected)
+			}
+		})
+	}
+}
+
+func TestRecordAddAndRemoveValue(t *testing.T) {
+	r := Record{Name: "a.test.com", Type: "A"}
+	r.addValue("10.0.0.1")
+	r.addValue("10.0.0.2")
+	r.addValue("10.0.0.1")
+	if !reflect.DeepEqual(r.Values, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expecting values [10.0.0.1 10.0.0.2]. Got %v", r.Values)
+	}
+
+	r.removeValue("10.0.0.1")
+	if !reflect.DeepEqual(r.Values, []string{"10.0.0.2"}) {
+		t.Errorf("Expecting values [10.0.0.2]. Got %v", r.Values)
+	}
+
+	c := Record{Name: "c.test.com", Type: "CNAME"}
+	c.addValue("a.test.com")
+	c.addValue("b.test.com")
+	if !reflect.DeepEqual(c.Values, []string{"b.test.com"}) {
+		t.Errorf("Expecting values [b.test.com]. Got %v", c.Values)
+	}
+
+	alias := "/subscriptions/sub-value/resourceGroups/rg-value/providers/Microsoft.Network/publicIPAddresses/ip-value"
+	r.addValue(alias)
+	if !reflect.DeepEqual(r.Values, []string{alias}) {
+		t.Errorf("Expecting the alias to replace all values. Got %v", r.Values)
+	}
+}
@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RemovalExtension sets the extension of the files holding the delayed removals in progress
+	RemovalExtension = "removal"
+	// minRemovalRetryDelay bounds how often a delayed removal the DNS server failed to apply is retried
+	minRemovalRetryDelay = time.Second
+)
+
+// Removal defines a delayed removal of a record set, kept in the local storage until it is applied to the DNS server
+// so that it survives the restarts
+type Removal struct {
+	// Name the DNS host name
+	Name string `json:"name"`
+
+	// Type the record type
+	Type string `json:"type"`
+
+	// Values the values the record set held when its removal was scheduled
+	Values []string `json:"values"`
+
+	// DueAt is when the record set is to be removed from the DNS server
+	DueAt time.Time `json:"dueAt"`
+}
+
+// PendingRemovals retrieves the delayed removals in progress, the soonest due first
+func (m *Manager) PendingRemovals() (removals []Removal, err error) {
+	m.Door.RLock()
+	defer m.Door.RUnlock()
+
+	keys, err := m.Store.List("." + RemovalExtension)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		r, err := m.readRemoval(key)
+		if err != nil {
+			return nil, err
+		}
+		removals = append(removals, *r)
+	}
+	sort.Slice(removals, func(i, j int) bool {
+		if !removals[i].DueAt.Equal(removals[j].DueAt) {
+			return removals[i].DueAt.Before(removals[j].DueAt)
+		}
+		return reconcileKey(removals[i].Name, removals[i].Type) < reconcileKey(removals[j].Name, removals[j].Type)
+	})
+	return
+}
+
+// ResumeRemovals resumes the delayed removals left in progress by the last run, e.g. interrupted by a restart.
+// The ones already due are applied right away
+func (m *Manager) ResumeRemovals() error {
+	removals, err := m.PendingRemovals()
+	if err != nil {
+		return err
+	}
+	for _, removal := range removals {
+		m.startRemoval(removal)
+	}
+	if len(removals) > 0 {
+		logrus.Infof("%d delayed removals resumed", len(removals))
+	}
+	return nil
+}
+
+// GetRemoval retrieves the delayed removal in progress of the record set identified by name and type
+func (m *Manager) GetRemoval(name, recordType string) (*Removal, error) {
+	m.Door.RLock()
+	defer m.Door.RUnlock()
+
+	if !m.removalPending(name, recordType) {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No pending removal found with name '%s' and type '%s'", name, recordType), nil)
+	}
+	return m.readRemoval(m.getRemovalFileName(name, recordType))
+}
+
+// CancelRemoval cancels the delayed removal in progress of the record set, storing the record set back
+// with the values it held unless it was added again meanwhile
+func (m *Manager) CancelRemoval(name, recordType string) (*Removal, error) {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	if !m.removalPending(name, recordType) {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No pending removal found with name '%s' and type '%s'", name, recordType), nil)
+	}
+	removal, err := m.readRemoval(m.getRemovalFileName(name, recordType))
+	if err != nil {
+		return nil, err
+	}
+	err = m.Store.Update(func(b Bucket) error {
+		if !b.Has(m.getRecordFileName(name, recordType)) {
+			if err := m.putRecord(b, Record{Name: removal.Name, Type: removal.Type, Values: removal.Values}, AuditCancelRemoval); err != nil {
+				return err
+			}
+		}
+		return b.Delete(m.getRemovalFileName(name, recordType))
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.audit(AuditEntry{Action: AuditCancelRemoval, Name: name, Type: recordType, Source: SourceAdmin, NewValues: removal.Values}, nil)
+	logrus.Infof("Delayed removal of '%s' '%s' cancelled", name, recordType)
+	return removal, nil
+}
+
+// ForceRemoval removes the record set from the DNS server right away, without waiting for its delayed removal to be due.
+// A record set still stored is erased from the local storage first, ctx bounding the call to the DNSUpdater.
+// A record set added again since its removal was scheduled is kept: the stale removal is cancelled instead, failing with
+// the HTTP status code 409
+func (m *Manager) ForceRemoval(ctx context.Context, name, recordType string) (*Removal, error) {
+	if m.HasDNSRecord(name, recordType) {
+		if stale, err := m.GetRemoval(name, recordType); err == nil {
+			m.forgetRemoval(*stale)
+			m.audit(AuditEntry{Action: AuditCancelRemoval, Name: name, Type: recordType, Source: SourceAdmin, NewValues: m.storedValues(name, recordType),
+				Message: "the record was added again"}, nil)
+			return nil, &hookTypes.Error{
+				Message: fmt.Sprintf("the record with name '%s' and type '%s' was added again since its removal was scheduled; the removal is cancelled, remove the record first to force it", name, recordType),
+				Code:    http.StatusConflict,
+			}
+		}
+	}
+	removal, err := m.GetRemoval(name, recordType)
+	if err != nil {
+		if !m.HasDNSRecord(name, recordType) {
+			return nil, err
+		}
+		if removal, err = m.scheduleRemoval(name, recordType); err != nil {
+			return nil, err
+		}
+		m.startRemoval(*removal) // retries later in case the DNS server fails now
+	}
+	ctx, cancel := m.operationContext(azure.WithStoredValues(ctx, removal.Values))
+	defer cancel()
+	err = updaterError(ctx, m.DNSUpdater.RemoveRR(ctx, name, recordType, ""))
+	m.audit(AuditEntry{Action: AuditDelete, Name: name, Type: recordType, Source: SourceAdmin, OldValues: removal.Values, Message: "forced ahead of the delayed removal"}, err)
+	if err != nil {
+		return nil, err
+	}
+	m.forgetRemoval(*removal)
+	logrus.Infof("record name '%s' and type '%s' removed successfully ahead of its delayed removal", name, recordType)
+	return removal, nil
+}
+
+// scheduleRemoval erases the record set from the local storage, keeping its delayed removal in its place
+func (m *Manager) scheduleRemoval(name, recordType string) (*Removal, error) {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	if !m.HasDNSRecord(name, recordType) {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s", name, recordType), nil)
+	}
+	record, err := m.readRecord(name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	removal := &Removal{Name: record.Name, Type: record.Type, Values: record.Values, DueAt: time.Now().UTC().Add(m.RemovalDelay)}
+	r, err := json.Marshal(removal)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Store.Update(func(b Bucket) error {
+		if err := b.Put(m.getRemovalFileName(name, recordType), r); err != nil {
+			return err
+		}
+		return m.deleteRecord(b, name, recordType, AuditScheduleRemoval)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removal, nil
+}
+
+// startRemoval waits for the delayed removal to be due in the background
+func (m *Manager) startRemoval(removal Removal) {
+	m.removals.Add(1)
+	go m.delayRemove(removal)
+}
+
+// isPending tells if the delayed removal is still the one in progress for its record set, i.e. neither applied,
+// cancelled nor replaced by a later one; callers must hold the Door
+func (m *Manager) isPending(removal Removal) bool {
+	r, err := m.readRemoval(m.getRemovalFileName(removal.Name, removal.Type))
+	return err == nil && r.DueAt.Equal(removal.DueAt)
+}
+
+// forgetRemoval erases the delayed removal from the local storage, unless it was replaced by a later one
+func (m *Manager) forgetRemoval(removal Removal) {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	if !m.isPending(removal) {
+		return
+	}
+	removalFileName := m.getRemovalFileName(removal.Name, removal.Type)
+	if err := m.Store.Delete(removalFileName); err != nil {
+		logrus.Errorf("error to erase removal '%s': %s", removalFileName, err)
+	}
+}
+
+// readRemoval reads a delayed removal from the local storage; callers must hold the Door
+func (m *Manager) readRemoval(fileName string) (removal *Removal, err error) {
+	var r []byte
+	r, err = m.Store.Get(fileName)
+	if err == nil {
+		err = json.Unmarshal(r, &removal)
+	}
+	return
+}
+
+// removalRetryDelay returns the time to wait before retrying a delayed removal the DNS server failed to apply
+func (m *Manager) removalRetryDelay() time.Duration {
+	if m.RemovalDelay < minRemovalRetryDelay {
+		return minRemovalRetryDelay
+	}
+	return m.RemovalDelay
+}
+
+// getRemovalFileName return the name of the file holding the delayed removal of the record
+func (m *Manager) getRemovalFileName(recordName, recordType string) string {
+	return fmt.Sprintf("%v.%v.%v", recordName, recordType, RemovalExtension)
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-azure-dns-manager/src/azure"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestResumeRemovals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-removal")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	updater := new(MockDNSUpdater)
+	m, _ := (&Builder{RemovalDelay: 200 * time.Millisecond}).New(updater, dir)
+	for _, record := range []hookTypes.DNSRecord{
+		{Name: "first.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "second.test.com", Type: "TXT", Value: "v=spf1 -all"},
+	} {
+		if err := m.AddDNSRecord(record); err != nil {
+			t.Fatalf("Expecting the addition of the record '%v' to succeed. Got err '%v'", record, err)
+		}
+	}
+	start := time.Now()
+	if err := m.RemoveDNSRecord("first.test.com", "A"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	m.RemovalDelay = time.Hour
+	if err := m.RemoveDNSRecord("second.test.com", "TXT"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	m.Shutdown()
+
+	removals, err := m.PendingRemovals()
+	if err != nil || len(removals) != 2 {
+		t.Fatalf("Expecting the removals interrupted by the shutdown to be kept. Got %v and err '%v'", removals, err)
+	}
+	if r := removals[0]; r.Name != "first.test.com" || r.Type != "A" || len(r.Values) != 1 || r.Values[0] != "10.0.0.1" {
+		t.Errorf("Expecting the soonest removal to be listed first with the values of its record set. Got %+v", r)
+	}
+	if due := removals[0].DueAt.Sub(start); due < 200*time.Millisecond || due > time.Minute {
+		t.Errorf("Expecting the removal to be due after the removal delay. Got %v", due)
+	}
+	if atomic.LoadUint64(&updater.RemovalCount) != 0 || m.HasDNSRecord("first.test.com", "A") {
+		t.Errorf("Expecting the record to be erased from the storage but not from the DNS server yet")
+	}
+
+	// restart
+	time.Sleep(300 * time.Millisecond)
+	m, _ = (&Builder{RemovalDelay: time.Hour}).New(updater, dir)
+	defer m.Shutdown()
+	if err := m.ResumeRemovals(); err != nil {
+		t.Fatalf("Expecting the removals to be resumed. Got err '%v'", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&updater.RemovalCount) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if count := atomic.LoadUint64(&updater.RemovalCount); count != 1 {
+		t.Errorf("Expecting only the removal already due to be applied. Got %d removals", count)
+	}
+	removals, _ = m.PendingRemovals()
+	if len(removals) != 1 || removals[0].Name != "second.test.com" || !m.removalPending("second.test.com", "TXT") {
+		t.Errorf("Expecting only the removal not yet due to be left. Got %v", removals)
+	}
+}
+
+func TestDelayRemoveCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-removal")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	updater := new(MockDNSUpdater)
+	m, _ := (&Builder{RemovalDelay: 100 * time.Millisecond}).New(updater, dir)
+	defer m.Shutdown()
+	record := hookTypes.DNSRecord{Name: "back.test.com", Type: "A", Value: "10.0.0.1"}
+	if err := m.AddDNSRecord(record); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.RemoveDNSRecord(record.Name, record.Type); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	if err := m.AddDNSRecord(record); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.removalPending(record.Name, record.Type) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.removalPending(record.Name, record.Type) || atomic.LoadUint64(&updater.RemovalCount) != 0 || !m.HasDNSRecord(record.Name, record.Type) {
+		t.Errorf("Expecting the removal to be cancelled by the addition of the record")
+	}
+}
+
+func TestDelayRemoveForeign(t *testing.T) {
+	updater := new(MockDNSUpdater)
+	m, cleanup := newTestManager(t, &Builder{RemovalDelay: 50 * time.Millisecond}, updater)
+	defer cleanup()
+	if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "foreign.test.com", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	updater.Error = &azure.ForeignRecordError{Name: "foreign.test.com", Type: "A"}
+	if err := m.RemoveDNSRecord("foreign.test.com", "A"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&updater.RemovalCount) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if removal, err := m.GetRemoval("foreign.test.com", "A"); err != nil || removal.Values[0] != "10.0.0.1" {
+		t.Errorf("Expecting the removal refused as foreign to be kept pending. Got %v and err '%v'", removal, err)
+	}
+}
+
+func TestForceRemovalAddedAgain(t *testing.T) {
+	updater := new(MockDNSUpdater)
+	m, cleanup := newTestManager(t, &Builder{RemovalDelay: time.Hour}, updater)
+	defer cleanup()
+	record := hookTypes.DNSRecord{Name: "again.test.com", Type: "A", Value: "10.0.0.1"}
+	if err := m.AddDNSRecord(record); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := m.RemoveDNSRecord(record.Name, record.Type); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	if err := m.AddDNSRecord(record); err != nil {
+		t.Fatalf("Expecting the record to be added again. Got err '%v'", err)
+	}
+
+	_, err := m.ForceRemoval(context.Background(), record.Name, record.Type)
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusConflict {
+		t.Errorf("Expecting the forced removal of a record added again to fail with the HTTP status code 409. Got err '%v'", err)
+	}
+	if count := atomic.LoadUint64(&updater.RemovalCount); count != 0 || !m.HasDNSRecord(record.Name, record.Type) {
+		t.Errorf("Expecting the record added again to be kept. Got %d removals", count)
+	}
+	if m.removalPending(record.Name, record.Type) {
+		t.Errorf("Expecting the stale removal to be cancelled")
+	}
+}
+
+func TestCancelRemoval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-removal")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	updater := new(MockDNSUpdater)
+	m, _ := (&Builder{RemovalDelay: 100 * time.Millisecond}).New(updater, dir)
+	defer m.Shutdown()
+	for _, value := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: "kept.test.com", Type: "A", Value: value}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+
+	if _, err := m.CancelRemoval("kept.test.com", "A"); err == nil {
+		t.Errorf("Expecting the cancellation to fail when no removal is pending")
+	}
+	if err := m.RemoveDNSRecord("kept.test.com", "A"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+	removal, err := m.CancelRemoval("kept.test.com", "A")
+	if err != nil || removal.Name != "kept.test.com" {
+		t.Fatalf("Expecting the removal to be cancelled. Got %v and err '%v'", removal, err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if atomic.LoadUint64(&updater.RemovalCount) != 0 || m.removalPending("kept.test.com", "A") {
+		t.Errorf("Expecting the record set to be left in the DNS server")
+	}
+	if r, err := m.GetRecord("kept.test.com", "A"); err != nil || len(r.Values) != 2 {
+		t.Errorf("Expecting the record set to be stored back with all its values. Got %v and err '%v'", r, err)
+	}
+}
+
+func TestForceRemoval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-removal")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	updater := new(MockDNSUpdater)
+	m, _ := (&Builder{RemovalDelay: time.Hour}).New(updater, dir)
+	defer m.Shutdown()
+	for _, name := range []string{"pending.test.com", "stored.test.com"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := m.RemoveDNSRecord("pending.test.com", "A"); err != nil {
+		t.Fatalf("Expecting the removal of the record to be scheduled. Got err '%v'", err)
+	}
+
+	for i, name := range []string{"pending.test.com", "stored.test.com"} {
+		if _, err := m.ForceRemoval(context.Background(), name, "A"); err != nil {
+			t.Fatalf("Expecting the record '%s' to be removed right away. Got err '%v'", name, err)
+		}
+		if count := atomic.LoadUint64(&updater.RemovalCount); count != uint64(i+1) || m.removalPending(name, "A") || m.HasDNSRecord(name, "A") {
+			t.Errorf("Expecting the record '%s' to be removed from the DNS server and the storage. Got %d removals", name, count)
+		}
+	}
+	_, err = m.ForceRemoval(context.Background(), "unknown.test.com", "A")
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusNotFound {
+		t.Errorf("Expecting the forced removal of an unknown record to fail with the HTTP status code 404. Got err '%v'", err)
+	}
+}
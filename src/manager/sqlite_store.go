@@ -0,0 +1,295 @@
+package manager
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteFileName is the name of the file of the SQLiteStore in the data directory
+const sqliteFileName = "bindman.sqlite"
+
+// sqliteMigrations are the changes of the schema of the SQLiteStore, in order. The database tells how many were applied
+// by its user_version; append new ones, never change the applied ones
+var sqliteMigrations = []string{
+	`CREATE TABLE entries (
+		key        TEXT PRIMARY KEY,
+		value      BLOB NOT NULL,
+		kind       TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		type       TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX entries_kind_type ON entries (kind, type, name);
+	CREATE INDEX entries_kind_name ON entries (kind, name);
+	CREATE INDEX entries_kind_updated_at ON entries (kind, updated_at);`,
+	`CREATE INDEX entries_kind_created_at ON entries (kind, created_at);`,
+	`ALTER TABLE entries ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	CREATE INDEX entries_kind_owner ON entries (kind, owner, name);`,
+}
+
+// sqliteDataMigrations fill the data of the schema version they are keyed by, once its migration is applied
+var sqliteDataMigrations = map[int]func(tx *sql.Tx) error{
+	3: fillOwners,
+}
+
+// sqliteStore keeps all the keys in a single SQLite file, along with the names, types and times of the records
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the Store kept in the SQLite file at path, creating it when missing and migrating its schema
+func NewSQLiteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	// the writes are serialized anyway; a single connection spares the busy errors
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// migrateSQLite applies the migrations the database is missing
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("the schema version %d of the database is newer than the %d supported", version, len(sqliteMigrations))
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration to the schema version %d failed: %v", version+1, err)
+		}
+		if fill, ok := sqliteDataMigrations[version+1]; ok {
+			if err := fill(tx); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("migration of the data to the schema version %d failed: %v", version+1, err)
+			}
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) Get(key string) ([]byte, error) {
+	return sqliteBucket{s.db}.Get(key)
+}
+
+func (s *sqliteStore) Has(key string) bool {
+	return sqliteBucket{s.db}.Has(key)
+}
+
+func (s *sqliteStore) Put(key string, value []byte) error {
+	return sqliteBucket{s.db}.Put(key, value)
+}
+
+func (s *sqliteStore) Delete(key string) error {
+	return sqliteBucket{s.db}.Delete(key)
+}
+
+func (s *sqliteStore) List(suffix string) ([]string, error) {
+	return sqliteBucket{s.db}.List(suffix)
+}
+
+func (s *sqliteStore) Update(fn func(b Bucket) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(sqliteBucket{tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// QueryRecords retrieves the records of the type and the owner, starting with the prefix and first and last written within the times of the query
+func (s *sqliteStore) QueryRecords(q RecordQuery) ([]StoredRecord, error) {
+	where, args := []string{"kind = ?"}, []interface{}{Extension}
+	if q.Type != "" {
+		where, args = append(where, "type = ?"), append(args, q.Type)
+	}
+	if q.Owner != "" {
+		where, args = append(where, "owner = ?"), append(args, q.Owner)
+	}
+	if q.Prefix != "" {
+		where, args = append(where, "name GLOB ?"), append(args, globEscape(q.Prefix)+"*")
+	}
+	if !q.UpdatedBefore.IsZero() {
+		where, args = append(where, "updated_at < ?"), append(args, q.UpdatedBefore.UnixNano())
+	}
+	if !q.UpdatedAfter.IsZero() {
+		where, args = append(where, "updated_at > ?"), append(args, q.UpdatedAfter.UnixNano())
+	}
+	if !q.CreatedBefore.IsZero() {
+		where, args = append(where, "created_at < ?"), append(args, q.CreatedBefore.UnixNano())
+	}
+	if !q.CreatedAfter.IsZero() {
+		where, args = append(where, "created_at > ?"), append(args, q.CreatedAfter.UnixNano())
+	}
+	rows, err := s.db.Query("SELECT value, created_at, updated_at FROM entries WHERE "+strings.Join(where, " AND ")+" ORDER BY name, type", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []StoredRecord
+	for rows.Next() {
+		var value []byte
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&value, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		record, err := decodeStoredRecord(value, time.Unix(0, createdAt).UTC(), time.Unix(0, updatedAt).UTC())
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// sqliteQuerier is implemented by both the database and its transactions
+type sqliteQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqliteBucket is the Bucket of the database or of one of its transactions
+type sqliteBucket struct {
+	db sqliteQuerier
+}
+
+func (b sqliteBucket) Get(key string) ([]byte, error) {
+	var value []byte
+	err := b.db.QueryRow("SELECT value FROM entries WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (b sqliteBucket) Has(key string) bool {
+	var found int
+	return b.db.QueryRow("SELECT 1 FROM entries WHERE key = ?", key).Scan(&found) == nil
+}
+
+func (b sqliteBucket) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	name, recordType, kind := splitKey(key)
+	now := time.Now().UnixNano()
+	_, err := b.db.Exec(`INSERT INTO entries (key, value, kind, name, type, owner, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, owner = excluded.owner, updated_at = excluded.updated_at`,
+		key, value, kind, name, recordType, entryOwner(kind, value), now, now)
+	return err
+}
+
+func (b sqliteBucket) Delete(key string) error {
+	_, err := b.db.Exec("DELETE FROM entries WHERE key = ?", key)
+	return err
+}
+
+func (b sqliteBucket) List(suffix string) ([]string, error) {
+	rows, err := b.db.Query("SELECT key FROM entries WHERE key GLOB ? ORDER BY key", "*"+globEscape(suffix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// entryOwner returns the owner of the record stored as value; empty for the other kinds of entries
+func entryOwner(kind string, value []byte) string {
+	if kind != Extension {
+		return ""
+	}
+	var record Record
+	if err := json.Unmarshal(value, &record); err != nil {
+		return ""
+	}
+	return record.Owner
+}
+
+// fillOwners fills the owner of the records stored before it had a column
+func fillOwners(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT key, value FROM entries WHERE kind = ?", Extension)
+	if err != nil {
+		return err
+	}
+	owners := map[string]string{}
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if owner := entryOwner(Extension, value); owner != "" {
+			owners[key] = owner
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for key, owner := range owners {
+		if _, err := tx.Exec("UPDATE entries SET owner = ? WHERE key = ?", owner, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitKey returns the record name, the record type and the kind, i.e. the extension, of a key such as www.test.com.A.bindman
+func splitKey(key string) (name, recordType, kind string) {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key, kind = key[:i], key[i+1:]
+	}
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[:i], key[i+1:], kind
+	}
+	return key, "", kind
+}
+
+// globEscape escapes the characters of s GLOB would take as wildcards
+func globEscape(s string) string {
+	return strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(s)
+}
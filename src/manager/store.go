@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DiskvStore keeps each record in its own file of the data directory
+	DiskvStore = "diskv"
+	// BoltStore keeps all the records in a single bbolt file of the data directory
+	BoltStore = "bolt"
+	// SQLiteStore keeps all the records in a single SQLite file of the data directory, able to filter them
+	SQLiteStore = "sqlite"
+	// importedKey marks the stores the records of the DiskvStore were imported into
+	importedKey = "diskv.imported"
+)
+
+// ErrNotFound is returned by the Stores reading a missing key
+var ErrNotFound = errors.New("key not found in the store")
+
+// Bucket holds values identified by keys
+type Bucket interface {
+	// Get reads the value of the key; fails with ErrNotFound when the key is missing
+	Get(key string) ([]byte, error)
+	// Has tells if the key is present
+	Has(key string) bool
+	// Put writes the value of the key, replacing the previous one
+	Put(key string, value []byte) error
+	// Delete removes the key; removing a missing key is not an error
+	Delete(key string) error
+	// List returns the keys ending with suffix, sorted
+	List(suffix string) ([]string, error)
+}
+
+// Store persists the records and the delayed removals of a Manager
+type Store interface {
+	Bucket
+	// Update runs fn in a transaction: the changes fn makes to the Bucket are applied only when it returns nil,
+	// and other changes to the Store wait for it
+	Update(fn func(b Bucket) error) error
+	// Close releases the Store; it cannot be used afterwards
+	Close() error
+}
+
+// OpenStore opens the store of the type in the data directory at basePath.
+// A BoltStore or SQLiteStore opened for the first time imports the records of the DiskvStore of the directory
+func OpenStore(storeType, basePath string) (Store, error) {
+	var open func(path string) (Store, error)
+	var fileName string
+	switch strings.ToLower(storeType) {
+	case DiskvStore, "":
+		return NewDiskvStore(basePath), nil
+	case BoltStore:
+		open, fileName = NewBoltStore, boltFileName
+	case SQLiteStore:
+		open, fileName = NewSQLiteStore, sqliteFileName
+	default:
+		return nil, fmt.Errorf("unknown store type '%s'; expecting %s, %s or %s", storeType, DiskvStore, BoltStore, SQLiteStore)
+	}
+
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, err
+	}
+	store, err := open(filepath.Join(basePath, fileName))
+	if err != nil {
+		return nil, err
+	}
+	imported, err := importStore(NewDiskvStore(basePath), store)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	if imported > 0 {
+		logrus.Infof("%d records and delayed removals imported from the %s store", imported, DiskvStore)
+	}
+	return store, nil
+}
+
+// importStore copies the records, the delayed removals, the histories and the asynchronous writes of from to to when to holds none yet,
+// e.g. when switching from a store type to another. Returns the number of keys copied.
+// The import runs once: to keeps the importedKey marker afterwards, so that emptying it later imports nothing again
+func importStore(from, to Store) (int, error) {
+	if _, err := to.Get(importedKey); err == nil {
+		return 0, nil
+	} else if err != ErrNotFound {
+		return 0, err
+	}
+	var keys []string
+	for _, suffix := range []string{"." + Extension, "." + RemovalExtension, "." + HistoryExtension, "." + OperationExtension} {
+		existing, err := to.List(suffix)
+		if err != nil {
+			return 0, err
+		}
+		if len(existing) > 0 {
+			keys = nil
+			break
+		}
+		found, err := from.List(suffix)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, found...)
+	}
+	return len(keys), to.Update(func(b Bucket) error {
+		for _, key := range keys {
+			value, err := from.Get(key)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return b.Put(importedKey, []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+}
@@ -0,0 +1,297 @@
+package manager
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// testStore checks the Store opened by open in a directory against the behavior expected of every Store
+func testStore(t *testing.T, open func(dir string) (Store, error)) {
+	newStore := func(t *testing.T) (Store, string, func()) {
+		dir, err := ioutil.TempDir("", "bindman-store")
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		s, err := open(dir)
+		if err != nil {
+			t.Fatalf("Expecting the store to be opened. Got err '%v'", err)
+		}
+		return s, dir, func() {
+			_ = s.Close()
+			_ = os.RemoveAll(dir)
+		}
+	}
+
+	t.Run("GetPutHasDelete", func(t *testing.T) {
+		s, _, cleanup := newStore(t)
+		defer cleanup()
+
+		if _, err := s.Get("www.test.com.A.bindman"); err != ErrNotFound || s.Has("www.test.com.A.bindman") {
+			t.Errorf("Expecting a missing key to be reported with ErrNotFound. Got err '%v'", err)
+		}
+		for _, value := range []string{"first", "second"} {
+			if err := s.Put("www.test.com.A.bindman", []byte(value)); err != nil {
+				t.Fatalf("Expecting the key to be written. Got err '%v'", err)
+			}
+			if got, err := s.Get("www.test.com.A.bindman"); err != nil || string(got) != value || !s.Has("www.test.com.A.bindman") {
+				t.Errorf("Expecting the value '%s' to be read back. Got '%s' and err '%v'", value, got, err)
+			}
+		}
+		if err := s.Put("empty.test.com.A.bindman", nil); err != nil || !s.Has("empty.test.com.A.bindman") {
+			t.Errorf("Expecting a key with an empty value to be present. Got err '%v'", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := s.Delete("www.test.com.A.bindman"); err != nil {
+				t.Errorf("Expecting the deletion %d of the key to succeed. Got err '%v'", i, err)
+			}
+		}
+		if _, err := s.Get("www.test.com.A.bindman"); err != ErrNotFound || s.Has("www.test.com.A.bindman") {
+			t.Errorf("Expecting the deleted key to be missing. Got err '%v'", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		s, _, cleanup := newStore(t)
+		defer cleanup()
+
+		if keys, err := s.List(".bindman"); err != nil || len(keys) != 0 {
+			t.Errorf("Expecting an empty store to list no keys. Got %v and err '%v'", keys, err)
+		}
+		for _, key := range []string{"b.test.com.A.bindman", "a.test.com.TXT.bindman", "a.test.com.A.removal"} {
+			if err := s.Put(key, []byte("{}")); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		}
+		keys, err := s.List(".bindman")
+		if expected := []string{"a.test.com.TXT.bindman", "b.test.com.A.bindman"}; err != nil || !reflect.DeepEqual(keys, expected) {
+			t.Errorf("Expecting the keys %v. Got %v and err '%v'", expected, keys, err)
+		}
+		if keys, err = s.List(""); err != nil || len(keys) != 3 {
+			t.Errorf("Expecting all the keys to be listed. Got %v and err '%v'", keys, err)
+		}
+	})
+
+	t.Run("UpdateCommits", func(t *testing.T) {
+		s, _, cleanup := newStore(t)
+		defer cleanup()
+		_ = s.Put("old.test.com.A.bindman", []byte("old"))
+
+		err := s.Update(func(b Bucket) error {
+			if err := b.Put("new.test.com.A.removal", []byte("new")); err != nil {
+				return err
+			}
+			if err := b.Delete("old.test.com.A.bindman"); err != nil {
+				return err
+			}
+			if value, err := b.Get("new.test.com.A.removal"); err != nil || string(value) != "new" {
+				t.Errorf("Expecting the transaction to read its own writes. Got '%s' and err '%v'", value, err)
+			}
+			if b.Has("old.test.com.A.bindman") {
+				t.Errorf("Expecting the transaction to see its own deletions")
+			}
+			if keys, err := b.List(""); err != nil || !reflect.DeepEqual(keys, []string{"new.test.com.A.removal"}) {
+				t.Errorf("Expecting the transaction to list its own changes. Got %v and err '%v'", keys, err)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expecting the transaction to be applied. Got err '%v'", err)
+		}
+		if !s.Has("new.test.com.A.removal") || s.Has("old.test.com.A.bindman") {
+			t.Errorf("Expecting all the changes of the transaction to be applied")
+		}
+	})
+
+	t.Run("UpdateRollsBack", func(t *testing.T) {
+		s, _, cleanup := newStore(t)
+		defer cleanup()
+		_ = s.Put("old.test.com.A.bindman", []byte("old"))
+
+		failure := errors.New("failure")
+		err := s.Update(func(b Bucket) error {
+			_ = b.Put("new.test.com.A.removal", []byte("new"))
+			_ = b.Delete("old.test.com.A.bindman")
+			return failure
+		})
+		if err != failure {
+			t.Errorf("Expecting the error of the transaction to be returned. Got err '%v'", err)
+		}
+		if s.Has("new.test.com.A.removal") || !s.Has("old.test.com.A.bindman") {
+			t.Errorf("Expecting none of the changes of the failed transaction to be applied")
+		}
+	})
+
+	t.Run("Persists", func(t *testing.T) {
+		s, dir, cleanup := newStore(t)
+		defer cleanup()
+		_ = s.Put("www.test.com.A.bindman", []byte("kept"))
+		if err := s.Close(); err != nil {
+			t.Fatalf("Expecting the store to be closed. Got err '%v'", err)
+		}
+
+		s, err := open(dir)
+		if err != nil {
+			t.Fatalf("Expecting the store to be opened again. Got err '%v'", err)
+		}
+		defer s.Close()
+		if value, err := s.Get("www.test.com.A.bindman"); err != nil || string(value) != "kept" {
+			t.Errorf("Expecting the value to survive the store being closed. Got '%s' and err '%v'", value, err)
+		}
+	})
+}
+
+func TestDiskvStore(t *testing.T) {
+	testStore(t, func(dir string) (Store, error) { return NewDiskvStore(dir), nil })
+}
+
+func TestBoltStore(t *testing.T) {
+	testStore(t, func(dir string) (Store, error) { return NewBoltStore(filepath.Join(dir, boltFileName)) })
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(dir string) (Store, error) { return NewSQLiteStore(filepath.Join(dir, sqliteFileName)) })
+}
+
+func TestSQLiteStoreMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-store")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, sqliteFileName)
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Expecting the store to be created. Got err '%v'", err)
+	}
+	var version int
+	if err := s.(*sqliteStore).db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != len(sqliteMigrations) {
+		t.Errorf("Expecting all the migrations to be applied. Got the schema version %d and err '%v'", version, err)
+	}
+	_, _ = s.(*sqliteStore).db.Exec("PRAGMA user_version = 99")
+	_ = s.Close()
+
+	if _, err := NewSQLiteStore(path); err == nil {
+		t.Errorf("Expecting a database of a newer schema to be rejected")
+	}
+}
+
+func TestSQLiteStoreOwnerMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-store")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, sqliteFileName)
+
+	// a database of the schema version 2, before the owners had a column
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	for _, statement := range append(sqliteMigrations[:2:2], "PRAGMA user_version = 2",
+		`INSERT INTO entries (key, value, kind, name, type, created_at, updated_at)
+			VALUES ('www.test.com.A.bindman', '{"name":"www.test.com","type":"A","values":["10.0.0.1"],"owner":"blue"}', 'bindman', 'www.test.com', 'A', 1, 1)`) {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Expecting the statement %q to succeed. Got err '%v'", statement, err)
+		}
+	}
+	_ = db.Close()
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Expecting the store to be migrated. Got err '%v'", err)
+	}
+	defer s.Close()
+	records, err := s.(RecordQuerier).QueryRecords(RecordQuery{Owner: "blue"})
+	if err != nil || len(records) != 1 || records[0].Name != "www.test.com" {
+		t.Errorf("Expecting the owner of the stored record to be filled. Got %+v and err '%v'", records, err)
+	}
+	if records, err = s.(RecordQuerier).QueryRecords(RecordQuery{Owner: "green"}); err != nil || len(records) != 0 {
+		t.Errorf("Expecting no record of another owner. Got %+v and err '%v'", records, err)
+	}
+
+	var plan string
+	rows, err := s.(*sqliteStore).db.Query("EXPLAIN QUERY PLAN SELECT value FROM entries WHERE kind = ? AND owner = ?", Extension, "blue")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		plan += detail
+	}
+	_ = rows.Close()
+	if !strings.Contains(plan, "entries_kind_owner") {
+		t.Errorf("Expecting the records to be looked up by owner through the index. Got the plan %q", plan)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindman-store")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := OpenStore("unknown", dir); err == nil {
+		t.Errorf("Expecting an unknown store type to be rejected")
+	}
+
+	// records kept by the diskv store are imported by the bolt store opened for the first time
+	m, _ := (&Builder{RemovalDelay: time.Hour}).New(new(MockDNSUpdater), dir)
+	for _, name := range []string{"kept.test.com", "removed.test.com"} {
+		if err := m.AddDNSRecord(hookTypes.DNSRecord{Name: name, Type: "A", Value: "10.0.0.1"}); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := m.RemoveDNSRecord("removed.test.com", "A"); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	m.Shutdown()
+
+	m, err = (&Builder{StoreType: BoltStore, RemovalDelay: time.Hour}).New(new(MockDNSUpdater), dir)
+	if err != nil {
+		t.Fatalf("Expecting the Manager to open the bolt store. Got err '%v'", err)
+	}
+	if _, isBolt := m.Store.(*boltStore); !isBolt {
+		t.Fatalf("Expecting the bolt store to be opened. Got %T", m.Store)
+	}
+	if records, err := m.GetDNSRecords(); err != nil || len(records) != 1 || records[0].Name != "kept.test.com" {
+		t.Errorf("Expecting the stored records to be imported. Got %v and err '%v'", records, err)
+	}
+	if removals, err := m.PendingRemovals(); err != nil || len(removals) != 1 || removals[0].Name != "removed.test.com" {
+		t.Errorf("Expecting the pending removals to be imported. Got %v and err '%v'", removals, err)
+	}
+
+	// the diskv files left in place are not imported again once the bolt store is emptied
+	for _, suffix := range []string{"." + Extension, "." + RemovalExtension, "." + HistoryExtension} {
+		keys, _ := m.Store.List(suffix)
+		for _, key := range keys {
+			if err := m.Store.Delete(key); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		}
+	}
+	m.Shutdown()
+	m, err = (&Builder{StoreType: BoltStore, RemovalDelay: time.Hour}).New(new(MockDNSUpdater), dir)
+	if err != nil {
+		t.Fatalf("Expecting the Manager to open the bolt store. Got err '%v'", err)
+	}
+	defer m.Shutdown()
+	if records, err := m.GetDNSRecords(); err != nil || len(records) != 0 {
+		t.Errorf("Expecting the records to be imported only once. Got %v and err '%v'", records, err)
+	}
+}